@@ -1,77 +1,475 @@
 package banking
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"math/rand"
-	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
+// DefaultAccountID identifies the account that is used by operations
+// which do not name a specific account, such as the original /balance,
+// /deposit, and /withdraw routes. It is always present in a Bank.
+const DefaultAccountID = "primary"
+
+// AnyVersion may be given as the expected version of an account to
+// operations that accept one, so that they are performed regardless of
+// the account's version. Every account has a version of at least one.
+const AnyVersion uint64 = 0
+
 // Bank represents an institution that offers basic financial accounts
-// to customers. For the sake of simplicity in this demo, a given bank
-// only has a single customer. This source file contains the business
-// logic for managing the account and persisting the balance across
-// sessions. The service.go file contains logic for exposing methods
-// for account management over a network through a basic HTTP API.
-// Implementation note: At present, idempotency keys are only retained
-// for the lifetime of the service; they are not persisted during the
-// current session and therefore values used then are not available for
-// checking in the next session.
+// to customers. A bank holds any number of accounts, each identified
+// by an account ID, and always has a default account so that callers
+// which predate multi-account support continue to work. This source
+// file contains the business logic for managing the accounts and
+// persisting them across sessions; features such as the ledger, holds,
+// and interest are described in their own files. The service.go file
+// contains logic for exposing methods for account management over a
+// network through a basic HTTP API. A Bank is safe for use by multiple
+// goroutines.
 type Bank struct {
 	name         string
-	balance      int
-	requests     map[string]string // idempotency keys => transaction IDs
-	requestsLock sync.Mutex 
+	lock         sync.RWMutex // held by each operation, exclusively if it changes data
+	accounts     map[string]*account
+	accountsLock sync.Mutex
+	ledger       []LedgerEntry
+	ledgerLock   sync.Mutex
+	requests     map[string]idempotencyRecord // idempotency keys => transactions
+	requestOrder []string                     // idempotency keys, oldest first
+	requestsLock sync.Mutex
+
+	idempotencyTTL     time.Duration
+	idempotencyMaxKeys int
+
+	rates ExchangeRateProvider
+	fees  *FeeSchedule // nil if no fees are charged
+	clock Clock
+
+	holds      map[string]*Hold
+	holdsLock  sync.Mutex
+	holdExpiry time.Duration
+
+	interestPeriod time.Duration
+	interestTask   *backgroundTask // accrues interest, once started
+
+	schedules     map[string]*Schedule
+	schedulesLock sync.Mutex
+	scheduleTask  *backgroundTask // runs schedules, once started
+
+	fraudRules        *FraudRules // nil if every transaction is approved
+	fraudRulesPath    string      // the file of rules being watched, if any
+	fraudRulesModTime time.Time   // when that file was modified, as of the last load
+	fraudRulesTask    *backgroundTask
+	reviews           map[string]*Review
+	reviewsLock       sync.Mutex
+
+	storage          Storage
+	walLock          sync.Mutex      // serializes changes recorded in the log
+	walSequence      uint64          // sequence number of the last change
+	walLength        int             // number of changes since the last snapshot
+	pending          []pendingChange // changes waiting to be written to the log
+	flushing         bool            // whether a caller is writing pending changes
+	logFailed        bool            // whether a change could not be written, until the data is reloaded
+	groupCommit      bool
+	snapshotInterval int
 }
 
-// NewBank returns a Bank instance for the named account. The balance
-// for that account will be the same as in the previous session, or
-// if there was no previous session, it will be zero (in which case
-// you might call the Deposit method to provide initial funding).
+// account holds the state of a single account within a Bank
+type account struct {
+	ID             string           `json:"id"`
+	Currency       string           `json:"currency"`
+	Balance        Money            `json:"balance"`
+	OverdraftLimit Money            `json:"overdraftLimit,omitempty"` // how far below zero the balance may go
+	Limits         AccountLimits    `json:"limits"`
+	Interest       *accountInterest `json:"interest,omitempty"` // nil unless given an interest rate
+	State          *AccountState    `json:"state,omitempty"`    // nil if the account has always been open
+	Opened         time.Time        `json:"opened"`             // zero if opened before this was recorded
+	Version        uint64           `json:"version"`            // incremented each time the account changes
+}
+
+// bankData is the representation of a Bank that is persisted to disk
+type bankData struct {
+	Accounts  map[string]*account          `json:"accounts"`
+	Ledger    []LedgerEntry                `json:"ledger"`
+	Requests  map[string]idempotencyRecord `json:"idempotencyKeys"`
+	Holds     map[string]*Hold             `json:"holds,omitempty"`
+	Schedules map[string]*Schedule         `json:"schedules,omitempty"`
+	Reviews   map[string]*Review           `json:"reviews,omitempty"`
+
+	// the sequence number of the last change from the write-ahead log
+	// that is included in this data
+	WALSequence uint64 `json:"walSequence,omitempty"`
+}
+
+// NewBank returns a Bank instance for the named customer, which
+// persists its data in a file in the working directory. The balance
+// for each account will be the same as in the previous session, or
+// if there was no previous session, the bank will have only the
+// default account and its balance will be zero (in which case you
+// might call the Deposit method to provide initial funding).
 func NewBank(name string) *Bank {
+	return NewBankWithStorage(name, NewFileStorage(dataPath(name, "dat")))
+}
+
+// NewBankWithStorage returns a Bank instance for the named customer,
+// which persists its data in the specified storage backend. Otherwise,
+// it is the same as NewBank.
+func NewBankWithStorage(name string, storage Storage) *Bank {
 	bank := Bank{
 		name:     name,
-		balance:  0,
-		requests: make(map[string]string),
+		accounts: make(map[string]*account),
+		requests: make(map[string]idempotencyRecord),
+
+		idempotencyTTL:     DefaultIdempotencyTTL,
+		idempotencyMaxKeys: DefaultIdempotencyMaxKeys,
+
+		rates: NewStaticRateProvider(),
+		clock: SystemClock{},
+
+		holds:      make(map[string]*Hold),
+		holdExpiry: DefaultHoldExpiry,
+
+		schedules: make(map[string]*Schedule),
+		reviews:   make(map[string]*Review),
+
+		storage:          storage,
+		snapshotInterval: DefaultSnapshotInterval,
 	}
 
-	previousBalance, err := bank.load()
+	err := bank.load()
 	if err != nil {
 		log.Printf("ERROR: Failed to load account data from previous session: %v\n", err)
 	}
 
-	bank.balance = previousBalance
+	bank.addDefaultAccount()
+
+	err = bank.reconcileLedger()
+	if err != nil {
+		log.Printf("ERROR: Account data from previous session is inconsistent: %v\n", err)
+	}
 
 	return &bank
 }
 
+// Adds the default account if it does not exist, such as when nothing
+// has been saved yet
+func (bank *Bank) addDefaultAccount() {
+	if _, exists := bank.accounts[DefaultAccountID]; !exists {
+		bank.accounts[DefaultAccountID] = &account{ID: DefaultAccountID, Currency: DefaultCurrency, Opened: bank.now().UTC(), Version: 1}
+	}
+}
+
+// Close waits for any changes that are still being written to become
+// durable, and then releases the resources held by the bank's storage
+// backend. The bank must not be used after it is closed.
+func (bank *Bank) Close() error {
+	bank.stopBackgroundTasks()
+
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	if err := bank.awaitLog(); err != nil {
+		return err
+	}
+
+	return bank.storage.Close()
+}
+
+// Stops the tasks that the bank performs in the background, waiting for
+// any that are in progress to finish. The caller must not hold lock,
+// since the tasks acquire it.
+func (bank *Bank) stopBackgroundTasks() {
+	bank.lock.Lock()
+	tasks := []*backgroundTask{bank.interestTask, bank.scheduleTask, bank.fraudRulesTask}
+	bank.interestTask = nil
+	bank.scheduleTask = nil
+	bank.fraudRulesTask = nil
+	bank.lock.Unlock()
+
+	for _, task := range tasks {
+		task.Stop()
+	}
+}
+
 // GetName returns the name used when creating the instance
 func (bank *Bank) GetName() string {
 	return bank.name
 }
 
-// GetBalance returns the current account balance
-func (bank *Bank) GetBalance() int {
-	return bank.balance
+// GetBalance returns the current balance of the default account
+func (bank *Bank) GetBalance() Money {
+	balance, _ := bank.GetAccountBalance(DefaultAccountID)
+	return balance
+}
+
+// GetAccountBalance returns the current balance of the specified
+// account, or an AccountNotFoundError if there is no such account.
+// The balance may include a change that is still being written to the
+// log by another operation, which is undone if it cannot be written
+// (see recoverFromLogFailure); GetTransaction and GetRequestOutcome
+// wait for a transaction to be durable before reporting it.
+func (bank *Bank) GetAccountBalance(accountID string) (Money, error) {
+	bank.lock.RLock()
+	defer bank.lock.RUnlock()
+
+	acct, err := bank.getAccount(accountID)
+	if err != nil {
+		return -1, err
+	}
+
+	return acct.Balance, nil
+}
+
+// GetBalanceAndVersion returns the current balance of the specified
+// account along with its version, which increases each time the
+// account changes, or an AccountNotFoundError if there is no such
+// account. Passing the version to DepositToAccount or
+// WithdrawFromAccount makes the operation conditional on the account
+// being unchanged, so that a caller acting on the balance it saw does
+// not overwrite changes made by others in the meantime. As described
+// for GetAccountBalance, the balance may include a change that is not
+// yet durable.
+func (bank *Bank) GetBalanceAndVersion(accountID string) (Money, uint64, error) {
+	bank.lock.RLock()
+	defer bank.lock.RUnlock()
+
+	acct, err := bank.getAccount(accountID)
+	if err != nil {
+		return -1, 0, err
+	}
+
+	return acct.Balance, acct.Version, nil
+}
+
+// GetAccountCurrency returns the currency code of the specified
+// account, or an AccountNotFoundError if there is no such account.
+func (bank *Bank) GetAccountCurrency(accountID string) (string, error) {
+	bank.lock.RLock()
+	defer bank.lock.RUnlock()
+
+	acct, err := bank.getAccount(accountID)
+	if err != nil {
+		return "", err
+	}
+
+	return acct.Currency, nil
+}
+
+// GetOverdraftLimit returns how far below zero the balance of the
+// specified account may go, or an AccountNotFoundError if there is no
+// such account.
+func (bank *Bank) GetOverdraftLimit(accountID string) (Money, error) {
+	bank.lock.RLock()
+	defer bank.lock.RUnlock()
+
+	acct, err := bank.getAccount(accountID)
+	if err != nil {
+		return -1, err
+	}
+
+	return acct.OverdraftLimit, nil
+}
+
+// SetOverdraftLimit changes how far below zero the balance of the
+// specified account may go; a limit of zero means that the account
+// has no overdraft. Lowering the limit does not affect a balance that
+// is already below the new limit, but prevents further withdrawals
+// until the balance recovers. It returns an error if the limit is
+// negative or an AccountNotFoundError if there is no such account.
+func (bank *Bank) SetOverdraftLimit(accountID string, limit Money) error {
+	if limit < 0 {
+		return fmt.Errorf("invalid overdraft limit: %s", limit)
+	}
+
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	acct, err := bank.getAccount(accountID)
+	if err != nil {
+		return err
+	}
+
+	acct.OverdraftLimit = limit
+	acct.Version++
+
+	err = bank.commit(walRecord{Accounts: []account{*acct}})
+	if err != nil {
+		log.Printf("ERROR: could not save account data following overdraft change: %v\n", err)
+		return err
+	}
+
+	log.Printf("Set overdraft limit for '%s' account '%s' to %s %s", bank.name, accountID, limit, acct.Currency)
+	return nil
+}
+
+// SetExchangeRateProvider replaces the provider of the exchange rates
+// used to convert amounts given in a currency other than that of the
+// account. By default, a bank uses a StaticRateProvider with a small
+// built-in table of rates.
+func (bank *Bank) SetExchangeRateProvider(rates ExchangeRateProvider) {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	bank.rates = rates
+}
+
+// ListAccounts returns the IDs of all accounts in the bank, sorted
+// alphabetically.
+func (bank *Bank) ListAccounts() []string {
+	bank.lock.RLock()
+	defer bank.lock.RUnlock()
+
+	return bank.listAccounts()
+}
+
+// Returns the IDs of all accounts, as described for ListAccounts
+func (bank *Bank) listAccounts() []string {
+	bank.accountsLock.Lock()
+	defer bank.accountsLock.Unlock()
+
+	ids := make([]string, 0, len(bank.accounts))
+	for id := range bank.accounts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// OpenAccount creates a new account with the specified ID and a zero
+// balance in the specified currency (or DefaultCurrency if empty). It
+// returns an error if the ID or currency is invalid or if an account
+// with that ID already exists.
+func (bank *Bank) OpenAccount(accountID string, currency string) error {
+	if !isValidAccountID(accountID) {
+		return fmt.Errorf("invalid account ID: '%s'", accountID)
+	}
+
+	currency = normalizeCurrency(currency)
+	if !isValidCurrency(currency) {
+		return fmt.Errorf("invalid currency: '%s'", currency)
+	}
+
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	bank.accountsLock.Lock()
+	if existing, exists := bank.accounts[accountID]; exists {
+		bank.accountsLock.Unlock()
+		if existing.status() == AccountClosed {
+			return fmt.Errorf("account '%s' already exists and is closed", accountID)
+		}
+		return fmt.Errorf("account '%s' already exists", accountID)
+	}
+	acct := &account{ID: accountID, Currency: currency, Opened: bank.now().UTC(), Version: 1}
+	bank.accounts[accountID] = acct
+	bank.accountsLock.Unlock()
+
+	err := bank.commit(walRecord{Accounts: []account{*acct}})
+	if err != nil {
+		log.Printf("ERROR: could not save account data following open: %v\n", err)
+		return err
+	}
+
+	log.Printf("Opened %s account '%s' at '%s' bank", currency, accountID, bank.name)
+	return nil
 }
 
-// Deposit adds the specified amount to the balance. The
-// idempotency key is used to identify duplicate requests.
-// This returns the transaction ID if successful or will return an
-// error if the amount is invalid (zero or negative).
-func (bank *Bank) Deposit(amount int, idempotencyKey string) (string, error) {
-	if amount < 1 {
-		return "", fmt.Errorf("Invalid amount - %d", amount)
+// CloseAccount closes the account with the specified ID at the request
+// of its owner, after which it refuses deposits and withdrawals with an
+// AccountClosedError (see SetAccountStatus). An account can only be
+// closed once its balance is zero and nothing is on hold, and the
+// default account can never be closed this way. Any schedules for the
+// account that have not completed are cancelled. It returns an
+// AccountNotFoundError if there is no such account.
+func (bank *Bank) CloseAccount(accountID string) error {
+	if accountID == DefaultAccountID {
+		return fmt.Errorf("the default account cannot be closed")
+	}
+
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	acct, err := bank.getAccount(accountID)
+	if err != nil {
+		return err
+	}
+
+	// an account that is already closed accepts nothing more
+	err = acct.checkCanDeposit()
+	if err != nil {
+		return err
+	}
+
+	if acct.Balance != 0 {
+		msg := "account '%s' cannot be closed while its balance is %s %s"
+		return fmt.Errorf(msg, accountID, acct.Balance, acct.Currency)
+	}
+
+	if held := bank.heldAmount(accountID, bank.now()); held != 0 {
+		msg := "account '%s' cannot be closed while %s %s is on hold"
+		return fmt.Errorf(msg, accountID, held, acct.Currency)
+	}
+
+	return bank.changeAccountStatus(acct, AccountClosed, "closed at the request of the account holder")
+}
+
+// Deposit adds the specified amount to the balance of the default
+// account. See DepositToAccount for details.
+func (bank *Bank) Deposit(amount Money, idempotencyKey string) (string, error) {
+	return bank.DepositToAccount(DefaultAccountID, amount, "", idempotencyKey, AnyVersion)
+}
+
+// DepositToAccount adds the specified amount to the balance of the
+// specified account. The amount is in the specified currency, or the
+// account's currency if empty; an amount in another currency is
+// converted, less the conversion fee, before it is credited. Any fee
+// for the deposit in the bank's fee schedule is then charged as a
+// separate ledger entry (see GetTransactionFee). The idempotency key is
+// used to identify duplicate requests, which are not charged again.
+// Unless the expected version is AnyVersion, the deposit is only made
+// if the account is still at that version. This returns the
+// transaction ID if successful or will return an error if the account
+// does not exist, the amount is invalid (zero or negative, or not
+// enough to cover the fee), the amount could not be converted, the
+// account is not at the expected version (a PreconditionFailedError),
+// the deposit would exceed the account's daily deposit limit (a
+// LimitExceededError), or the account is closed (an AccountClosedError).
+// Finally, the deposit is evaluated by the bank's fraud rules (see
+// FraudRules), which may decline it with a FraudSuspectedError or hold
+// it for review with a PendingReviewError.
+func (bank *Bank) DepositToAccount(accountID string, amount Money, currency string, idempotencyKey string, expectedVersion uint64) (string, error) {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	return bank.depositToAccount(accountID, amount, currency, idempotencyKey, expectedVersion)
+}
+
+// Makes a deposit as described for DepositToAccount. The caller must
+// hold lock exclusively.
+func (bank *Bank) depositToAccount(accountID string, amount Money, currency string, idempotencyKey string, expectedVersion uint64) (string, error) {
+	if amount < Cents(1) {
+		return "", fmt.Errorf("Invalid amount - %s", amount)
+	}
+
+	acct, err := bank.getAccount(accountID)
+	if err != nil {
+		return "", err
 	}
 
 	// check idempotency key, only process deposit if it's unique. If it's a
 	// duplicate, return the transaction ID from the original deposit.
+	// Reusing a key for a different request is rejected.
+	fingerprint := requestFingerprint(TransactionDeposit, accountID, amount, acct.foreignCurrency(currency))
 	if idempotencyKey != "" {
-		previousTxID, keyExists := bank.requests[idempotencyKey]
+		previousTxID, keyExists, err := bank.lookupRequest(idempotencyKey, fingerprint)
+		if err != nil {
+			return "", err
+		}
 		if keyExists {
 			msg := "Duplicate request for idempotency key '%s', returning txID: '%s'"
 			log.Printf(msg, idempotencyKey, previousTxID)
@@ -79,41 +477,162 @@ func (bank *Bank) Deposit(amount int, idempotencyKey string) (string, error) {
 		}
 	}
 
-	bank.balance = bank.balance + amount
+	// a request that was held for review returns the outcome of the
+	// review, unless it is being made now because it was approved
+	reviewedTxID, approved, err := bank.checkReview(idempotencyKey, fingerprint)
+	if err != nil || reviewedTxID != "" {
+		return reviewedTxID, err
+	}
+
+	// a retried request returns the original result above, even though
+	// the original has since changed the account's version or status
+	err = acct.checkCanDeposit()
+	if err != nil {
+		return "", err
+	}
+
+	err = acct.checkVersion(expectedVersion)
+	if err != nil {
+		return "", err
+	}
+
+	fx, err := bank.convertForAccount(acct, amount, currency)
+	if err != nil {
+		return "", err
+	}
+
+	credit := amount
+	if fx != nil {
+		credit = fx.Converted - fx.Fee
+		if credit < Cents(1) {
+			return "", fmt.Errorf("Invalid amount - %s %s is worth nothing after conversion", amount, fx.OriginalCurrency)
+		}
+	}
+
+	err = bank.checkDepositLimits(acct, credit, bank.now())
+	if err != nil {
+		return "", err
+	}
+
+	fee, err := bank.fees.feeFor(TransactionDeposit, credit)
+	if err != nil {
+		return "", err
+	}
+	if fee >= credit {
+		return "", fmt.Errorf("Invalid amount - %s %s does not cover the fee of %s %s", credit, acct.Currency, fee, acct.Currency)
+	}
+
+	if !approved {
+		err = bank.screenTransaction(acct, Review{
+			AccountID:      accountID,
+			Type:           TransactionDeposit,
+			Amount:         amount,
+			Currency:       acct.foreignCurrency(currency),
+			IdempotencyKey: idempotencyKey,
+		}, credit)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	newBalance, err := acct.Balance.Add(credit)
+	if err != nil {
+		return "", err
+	}
+
+	acct.Balance = newBalance
 	txID := generateTransactionID("D", 10)
-	bank.requestsLock.Lock()
-	bank.requests[idempotencyKey] = txID
-	bank.requestsLock.Unlock()
+	entry := bank.appendToLedger(acct, LedgerEntry{
+		TransactionID:  txID,
+		Type:           TransactionDeposit,
+		Amount:         credit,
+		IdempotencyKey: idempotencyKey,
+	}.withConversion(fx))
+	entries := bank.chargeFee(acct, entry, fee)
+	bank.recordRequest(idempotencyKey, txID, fingerprint)
 
-	err := bank.save()
+	err = bank.commit(walRecord{
+		Accounts: []account{*acct},
+		Ledger:   entries,
+		Requests: bank.requestRecords(idempotencyKey),
+	})
 	if err != nil {
 		log.Printf("ERROR: could not save account data following deposit: %v\n", err)
 		return "", err
 	}
 
-	log.Printf("Deposited $%d into '%s' account (ID: %s)", amount, bank.name, txID)
+	log.Printf("Deposited %s %s into '%s' account '%s' (ID: %s)", credit, acct.Currency, bank.name, accountID, txID)
+	bank.logFees(entries)
 	return txID, nil
 }
 
-// Withdraw removes the specified amount from the balance. The
-// idempotency key is used to identify duplicate requests. This
-// returns a transaction ID if successful or will return an
-// error if the amount is invalid (either negative or greater
-// than the current balance).
-func (bank *Bank) Withdraw(amount int, idempotencyKey string) (string, error) {
-	if amount < 1 {
-		return "", fmt.Errorf("Invalid amount: %d", amount)
+// Withdraw removes the specified amount from the balance of the
+// default account. See WithdrawFromAccount for details.
+func (bank *Bank) Withdraw(amount Money, idempotencyKey string) (string, error) {
+	return bank.WithdrawFromAccount(DefaultAccountID, amount, "", idempotencyKey, AnyVersion)
+}
+
+// WithdrawFromAccount removes the specified amount from the balance
+// of the specified account. The amount is in the specified currency,
+// or the account's currency if empty; an amount in another currency is
+// converted, plus the conversion fee, before it is debited. Any fee for
+// the withdrawal in the bank's fee schedule is also debited, as a
+// separate ledger entry (see GetTransactionFee). The idempotency key is
+// used to identify duplicate requests, which are not charged again.
+// Unless the expected version is AnyVersion, the withdrawal is only
+// made if the account is still at that version. This returns a
+// transaction ID if successful or will return an error if the account
+// does not exist, the amount could not be converted, the amount is
+// invalid (either negative or, with the fee, greater than the current
+// balance), the account is not at the expected version (a
+// PreconditionFailedError), the withdrawal would exceed one of the
+// account's limits (a LimitExceededError), or the account is frozen or
+// dormant (an AccountRestrictedError) or closed (an AccountClosedError).
+// Finally, the withdrawal is evaluated by the bank's fraud rules (see
+// FraudRules), which may decline it with a FraudSuspectedError or hold
+// it for review with a PendingReviewError.
+func (bank *Bank) WithdrawFromAccount(accountID string, amount Money, currency string, idempotencyKey string, expectedVersion uint64) (string, error) {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	return bank.withdrawFromAccount(accountID, amount, currency, idempotencyKey, expectedVersion, TransactionWithdrawal)
+}
+
+// WithdrawForTransfer removes the specified amount from the balance of
+// the specified account as the first step of a transfer to another
+// bank. It is the same as WithdrawFromAccount, except that it is
+// charged the transfer fee from the bank's fee schedule rather than the
+// withdrawal fee, and its idempotency key may not be reused for an
+// ordinary withdrawal.
+func (bank *Bank) WithdrawForTransfer(accountID string, amount Money, currency string, idempotencyKey string, expectedVersion uint64) (string, error) {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	return bank.withdrawFromAccount(accountID, amount, currency, idempotencyKey, expectedVersion, transferRequest)
+}
+
+// Makes a withdrawal as described for WithdrawFromAccount, charging the
+// fee for the request type, which is TransactionWithdrawal or
+// transferRequest. The caller must hold lock exclusively.
+func (bank *Bank) withdrawFromAccount(accountID string, amount Money, currency string, idempotencyKey string, expectedVersion uint64, requestType TransactionType) (string, error) {
+	if amount < Cents(1) {
+		return "", fmt.Errorf("Invalid amount: %s", amount)
 	}
 
-	if amount > bank.balance {
-		msg := "insufficient funds: withdrawal amount $%d exceeds balance $%d"
-		return "", fmt.Errorf(msg, amount, bank.balance)
+	acct, err := bank.getAccount(accountID)
+	if err != nil {
+		return "", err
 	}
 
 	// check idempotency key, only process withdrawal if it's unique. If it's a
 	// duplicate, return the transaction ID from the original withdrawal.
+	// Reusing a key for a different request is rejected.
+	fingerprint := requestFingerprint(requestType, accountID, amount, acct.foreignCurrency(currency))
 	if idempotencyKey != "" {
-		previousTxID, keyExists := bank.requests[idempotencyKey]
+		previousTxID, keyExists, err := bank.lookupRequest(idempotencyKey, fingerprint)
+		if err != nil {
+			return "", err
+		}
 		if keyExists {
 			msg := "Duplicate request for idempotency key '%s', returning txID: '%s'"
 			log.Printf(msg, idempotencyKey, previousTxID)
@@ -121,22 +640,177 @@ func (bank *Bank) Withdraw(amount int, idempotencyKey string) (string, error) {
 		}
 	}
 
-	bank.balance = bank.balance - amount
+	// a request that was held for review returns the outcome of the
+	// review, unless it is being made now because it was approved
+	reviewedTxID, approved, err := bank.checkReview(idempotencyKey, fingerprint)
+	if err != nil || reviewedTxID != "" {
+		return reviewedTxID, err
+	}
+
+	err = acct.checkCanWithdraw()
+	if err != nil {
+		return "", err
+	}
+
+	err = acct.checkVersion(expectedVersion)
+	if err != nil {
+		return "", err
+	}
+
+	fx, err := bank.convertForAccount(acct, amount, currency)
+	if err != nil {
+		return "", err
+	}
+
+	debit := amount
+	if fx != nil {
+		debit, err = fx.Converted.Add(fx.Fee)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	now := bank.now()
+	err = bank.checkWithdrawalLimits(acct, debit, now)
+	if err != nil {
+		return "", err
+	}
+
+	// the fee is paid from the same funds as the withdrawal
+	fee, err := bank.fees.feeFor(requestType, debit)
+	if err != nil {
+		return "", err
+	}
+
+	total, err := debit.Add(fee)
+	if err != nil {
+		return "", err
+	}
+
+	err = acct.checkFunds(total, bank.heldAmount(accountID, now))
+	if err != nil {
+		return "", err
+	}
+
+	if !approved {
+		err = bank.screenTransaction(acct, Review{
+			AccountID:      accountID,
+			Type:           requestType,
+			Amount:         amount,
+			Currency:       acct.foreignCurrency(currency),
+			IdempotencyKey: idempotencyKey,
+		}, debit)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	acct.Balance = acct.Balance - debit
 	txID := generateTransactionID("W", 10)
-	bank.requestsLock.Lock()
-	bank.requests[idempotencyKey] = txID
-	bank.requestsLock.Unlock()
+	entry := bank.appendToLedger(acct, LedgerEntry{
+		TransactionID:  txID,
+		Type:           TransactionWithdrawal,
+		Amount:         debit,
+		IdempotencyKey: idempotencyKey,
+	}.withConversion(fx))
+	entries := bank.chargeFee(acct, entry, fee)
+	bank.recordRequest(idempotencyKey, txID, fingerprint)
 
-	err := bank.save()
+	err = bank.commit(walRecord{
+		Accounts: []account{*acct},
+		Ledger:   entries,
+		Requests: bank.requestRecords(idempotencyKey),
+	})
 	if err != nil {
 		log.Printf("ERROR: could not save account data following withdrawal: %v\n", err)
 		return "", err
 	}
 
-	log.Printf("Withdrew $%d from '%s' account (ID: %s)", amount, bank.name, txID)
+	log.Printf("Withdrew %s %s from '%s' account '%s' (ID: %s)", debit, acct.Currency, bank.name, accountID, txID)
+	bank.logFees(entries)
 	return txID, nil
 }
 
+// Returns a PreconditionFailedError unless the expected version is
+// AnyVersion or the account's current version
+func (acct *account) checkVersion(expectedVersion uint64) error {
+	if expectedVersion == AnyVersion || expectedVersion == acct.Version {
+		return nil
+	}
+
+	msg := "account '%s' has changed: it is at version %d, not the expected version %d"
+	return PreconditionFailedError{
+		message:        fmt.Sprintf(msg, acct.ID, acct.Version, expectedVersion),
+		currentVersion: acct.Version,
+	}
+}
+
+// Returns an InsufficientFundsError if debiting the amount would take
+// the balance, less the amount held, below zero, or below the overdraft
+// limit if there is one
+func (acct *account) checkFunds(debit Money, held Money) error {
+	available, err := acct.Balance.Add(acct.OverdraftLimit)
+	if err != nil {
+		return err
+	}
+	available = available - held
+
+	if debit <= available {
+		return nil
+	}
+
+	if acct.OverdraftLimit > 0 {
+		msg := "withdrawal amount %s %s would take balance %s %s beyond overdraft limit %s %s"
+		return InsufficientFundsError{
+			message:                fmt.Sprintf(msg, debit, acct.Currency, acct.Balance, acct.Currency, acct.OverdraftLimit, acct.Currency),
+			overdraftLimitExceeded: true,
+		}
+	}
+
+	if held > 0 {
+		msg := "withdrawal amount %s %s exceeds available balance %s %s (%s %s is on hold)"
+		return InsufficientFundsError{message: fmt.Sprintf(msg, debit, acct.Currency,
+			acct.Balance-held, acct.Currency, held, acct.Currency)}
+	}
+
+	msg := "withdrawal amount %s %s exceeds balance %s %s"
+	return InsufficientFundsError{message: fmt.Sprintf(msg, debit, acct.Currency, acct.Balance, acct.Currency)}
+}
+
+// Returns the account with the specified ID, or an AccountNotFoundError
+// if there is no such account.
+func (bank *Bank) getAccount(accountID string) (*account, error) {
+	bank.accountsLock.Lock()
+	defer bank.accountsLock.Unlock()
+
+	acct, exists := bank.accounts[accountID]
+	if !exists {
+		msg := fmt.Sprintf("no account with ID '%s' at '%s' bank", accountID, bank.name)
+		return nil, AccountNotFoundError{message: msg}
+	}
+
+	return acct, nil
+}
+
+// Reports whether the ID is acceptable for a new account. IDs are
+// used in URL paths, so they are limited to letters, digits, dashes,
+// and underscores.
+func isValidAccountID(accountID string) bool {
+	if accountID == "" || len(accountID) > 64 {
+		return false
+	}
+
+	for _, c := range accountID {
+		isAlpha := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		isDigit := c >= '0' && c <= '9'
+		if !isAlpha && !isDigit && c != '-' && c != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
 // Generates a transaction ID with the specified prefix and of
 // the specified length.
 func generateTransactionID(prefix string, length int) string {
@@ -149,10 +823,17 @@ func generateTransactionID(prefix string, length int) string {
 	return prefix + string(randChars)
 }
 
-// GetDataPath returns the path of the file where account data is persisted
+// GetDataPath returns a description of where account data is
+// persisted, which for the default file storage is the path of the file
 func (bank *Bank) GetDataPath() string {
+	return bank.storage.String()
+}
+
+// Returns the path of the file in the working directory where the named
+// bank persists its data, with the specified file name extension
+func dataPath(bankName string, extension string) string {
 	// TODO: strip non-alpha characters from string
-	fileName := fmt.Sprintf("bank-%s.dat", strings.ToLower(bank.name))
+	fileName := fmt.Sprintf("bank-%s.%s", strings.ToLower(bankName), extension)
 
 	// if possible, locate the file in the same directory as this source
 	dir, err := filepath.Abs("./")
@@ -163,56 +844,198 @@ func (bank *Bank) GetDataPath() string {
 	return fileName
 }
 
-// Load the account balance from the previous session. It returns
-// the balance from the previous session that was stored to disk
-// (and returns zero if no previous session data file exists).
-// It returns an error if the data file exists, but could not be
-// loaded for some reason (such as the data file being corrupted).
-func (bank *Bank) load() (int, error) {
-	// load initial data from a JSON file in current directory
-	dataFileName := bank.GetDataPath()
+// Load the account data, ledger, holds, schedules, reviews, and
+// idempotency keys from the previous session that was saved in the
+// bank's storage. If nothing was saved, the bank is left unchanged. A
+// data file written before multi-account support contains only a single
+// balance, which is loaded into the default account.
+// It returns an error if saved data exists, but could not be loaded
+// for some reason (such as the data file being corrupted).
+func (bank *Bank) load() error {
+	version, err := bank.read()
+	if err != nil {
+		return err
+	}
+
+	// saving a new snapshot now, which compacts the log, means that
+	// these changes need not be replayed again next time
+	if version < dataSchemaVersion || bank.walLength > 0 {
+		return bank.save()
+	}
+
+	return nil
+}
 
-	var balance = 0
-	if _, err := os.Stat(dataFileName); err == nil {
+// Reads the data that was saved in the bank's storage, and applies the
+// changes recorded in the write-ahead log since, as described for load.
+// It returns the schema version of the saved data.
+func (bank *Bank) read() (int, error) {
+	db, err := bank.storage.Load()
+	if err != nil {
+		log.Printf("ERROR: problem loading data from '%s': %v\n", bank.storage, err)
+		return 0, err
+	}
+
+	version := dataSchemaVersion
+	snapshotSequence := uint64(0)
+	if db != nil {
 		// data from previous session exists, load it
-		log.Printf("Loading '%s' account data from file '%s'\n", bank.name, dataFileName)
+		log.Printf("Loading '%s' account data from '%s'\n", bank.name, bank.storage)
 
-		db, err := os.ReadFile(dataFileName)
+		var data bankData
+		data, version, err = decodeDataFile(db)
 		if err != nil {
-			log.Printf("ERROR: problem loading file '%s': %v\n", dataFileName, err)
-			return -1, err
+			log.Printf("ERROR: could not unmarshal account info: %v\n", err)
+
+			// keep a copy of the data, so that whatever it contains can still
+			// be recovered after it is overwritten by the next save
+			label := "corrupt-" + time.Now().UTC().Format("20060102T150405Z")
+			if backupErr := bank.storage.Backup(label, db); backupErr == nil {
+				log.Printf("ERROR: saved a copy of the unreadable data as '%s'\n", label)
+			}
+			return 0, err
 		}
 
-		err = json.Unmarshal([]byte(db), &balance)
-		if err != nil {
-			log.Printf("ERROR: could not unmarshal account info: %v\n", err)
-			return -1, err
+		for id, acct := range data.Accounts {
+			acct.ID = id
+			acct.Currency = normalizeCurrency(acct.Currency)
+			bank.accounts[id] = acct
+		}
+		bank.ledger = data.Ledger
+		for holdID, hold := range data.Holds {
+			bank.holds[holdID] = hold
+		}
+		for scheduleID, schedule := range data.Schedules {
+			bank.schedules[scheduleID] = schedule
 		}
+		for reviewID, review := range data.Reviews {
+			bank.reviews[reviewID] = review
+		}
+
+		// data files written before idempotency keys were persisted with
+		// their creation time still record each key in the ledger entry for
+		// the resulting transaction
+		requests := data.Requests
+		if requests == nil {
+			requests = make(map[string]idempotencyRecord)
+			for _, entry := range data.Ledger {
+				if entry.IdempotencyKey != "" {
+					requests[entry.IdempotencyKey] = idempotencyRecord{
+						TransactionID: entry.TransactionID,
+						Fingerprint:   requestFingerprint(entry.Type, entry.AccountID, entry.Amount, ""),
+						Created:       entry.Timestamp,
+					}
+				}
+			}
+		}
+		bank.restoreRequests(requests)
+		snapshotSequence = data.WALSequence
+
+		if version < dataSchemaVersion {
+			// keep a copy of the original file in case the migration needs
+			// to be undone; it is rewritten in the current format below
+			label := fmt.Sprintf("v%d.bak", version)
+			err = bank.storage.Backup(label, db)
+			if err != nil {
+				log.Printf("ERROR: could not back up data before migrating it: %v\n", err)
+				return 0, err
+			}
+
+			log.Printf("Migrating data in '%s' from schema version %d to %d (original saved as '%s')\n",
+				bank.storage, version, dataSchemaVersion, label)
+		}
+	}
+
+	// apply the changes made since the snapshot was saved
+	replayed, err := bank.replayLog(snapshotSequence)
+	if err != nil {
+		log.Printf("ERROR: could not replay log in '%s': %v\n", bank.storage, err)
+		return 0, err
 	}
 
-	return balance, nil
+	if replayed > 0 {
+		log.Printf("Replayed %d changes to '%s' account data from the log\n", replayed, bank.name)
+	}
+
+	// accounts saved before they had versions start at the first one
+	for _, acct := range bank.accounts {
+		if acct.Version == AnyVersion {
+			acct.Version = 1
+		}
+	}
+
+	return version, nil
 }
 
-// Save the current account balance to disk so that it can be
-// loaded in a future session. This returns an error if the data
-// file could not be written for some reason.
+// Save a snapshot of the current account balances, ledger, holds,
+// schedules, reviews, and idempotency keys to the bank's storage so
+// that they can be loaded in a future session, and then compact the
+// write-ahead log, whose changes the snapshot includes. The saved data
+// is replaced atomically, so a crash while saving leaves the data from
+// either before or after the save, never a mix of the two. This
+// returns an error if the data could not be saved for some reason.
 func (bank *Bank) save() error {
-	dataFileName := bank.GetDataPath()
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	return bank.snapshot()
+}
+
+// Saves a snapshot and compacts the log, as described for save. The
+// caller must hold lock exclusively, and no change may be waiting to
+// be written to the log (see snapshotLog), so that the snapshot
+// includes every change that has been recorded in the log and no
+// others.
+func (bank *Bank) snapshot() error {
+	bank.walLock.Lock()
+	defer bank.walLock.Unlock()
+
+	log.Printf("Writing account info to database '%s'\n", bank.storage)
 
-	log.Printf("Writing account info to database '%s'\n", dataFileName)
-	enc := json.NewEncoder(os.Stdout)
-	enc.Encode(bank.balance)
+	bank.expireHolds(bank.now())
 
-	data, _ := json.MarshalIndent(bank.balance, "", "  ")
-	file, err := os.Create(dataFileName)
+	bank.accountsLock.Lock()
+	bank.ledgerLock.Lock()
+	bank.requestsLock.Lock()
+	bank.holdsLock.Lock()
+	bank.schedulesLock.Lock()
+	bank.reviewsLock.Lock()
+	content, err := encodeDataFile(bank.name, bankData{
+		Accounts:    bank.accounts,
+		Ledger:      bank.ledger,
+		Requests:    bank.requests,
+		Holds:       bank.holds,
+		Schedules:   bank.schedules,
+		Reviews:     bank.reviews,
+		WALSequence: bank.walSequence,
+	})
+	bank.reviewsLock.Unlock()
+	bank.schedulesLock.Unlock()
+	bank.holdsLock.Unlock()
+	bank.requestsLock.Unlock()
+	bank.ledgerLock.Unlock()
+	bank.accountsLock.Unlock()
+
+	if err != nil {
+		log.Printf("ERROR: failed to encode account data: %v\n", err)
+		return err
+	}
+
+	err = bank.storage.Save(content)
 	if err != nil {
-		log.Fatalf("failed to write account data to DB: %v", err)
+		log.Printf("ERROR: failed to write account data to '%s': %v\n", bank.storage, err)
+		return err
 	}
-	defer file.Close()
 
-	file.Write(data)
-	file.Sync()
-	log.Printf("Finished writing account info to database '%s'\n", dataFileName)
+	// records left in the log by a failure here are skipped when it is
+	// replayed, since the snapshot records the last sequence number
+	err = bank.storage.TruncateLog()
+	if err != nil {
+		log.Printf("ERROR: failed to compact log in '%s': %v\n", bank.storage, err)
+		return err
+	}
+	bank.walLength = 0
 
-	return err
+	log.Printf("Finished writing account info to database '%s'\n", bank.storage)
+	return nil
 }
@@ -0,0 +1,203 @@
+package banking
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAccountsHaveSeparateBalances(t *testing.T) {
+	discardLogOutput(t)
+	path := filepath.Join(t.TempDir(), "bank-test.dat")
+
+	bank := NewBankWithStorage("test", NewFileStorage(path))
+	if accounts := bank.ListAccounts(); !reflect.DeepEqual(accounts, []string{DefaultAccountID}) {
+		t.Errorf("new bank has accounts %v, want only the default account", accounts)
+	}
+
+	for _, accountID := range []string{"savings", "checking"} {
+		if err := bank.OpenAccount(accountID, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bank.OpenAccount("savings", ""); err == nil {
+		t.Error("opened an account that already exists")
+	}
+	for _, accountID := range []string{"", "two words", "semi;colon", strings.Repeat("a", 65)} {
+		if err := bank.OpenAccount(accountID, ""); err == nil {
+			t.Errorf("opened an account with invalid ID '%s'", accountID)
+		}
+	}
+	if accounts := bank.ListAccounts(); !reflect.DeepEqual(accounts, []string{"checking", DefaultAccountID, "savings"}) {
+		t.Errorf("accounts are %v, want them sorted", accounts)
+	}
+
+	if _, err := bank.DepositToAccount("savings", Dollars(50), "", "", AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bank.Deposit(Dollars(5), ""); err != nil {
+		t.Fatal(err)
+	}
+	var insufficientFunds InsufficientFundsError
+	if _, err := bank.WithdrawFromAccount("checking", Dollars(1), "", "", AnyVersion); !errors.As(err, &insufficientFunds) {
+		t.Errorf("withdrawal from empty account returned %v, want an InsufficientFundsError", err)
+	}
+
+	var notFound AccountNotFoundError
+	if _, err := bank.DepositToAccount("missing", Dollars(1), "", "", AnyVersion); !errors.As(err, &notFound) {
+		t.Errorf("deposit to unknown account returned %v, want an AccountNotFoundError", err)
+	}
+	if _, err := bank.GetAccountBalance("missing"); !errors.As(err, &notFound) {
+		t.Errorf("balance of unknown account returned %v, want an AccountNotFoundError", err)
+	}
+
+	// each account keeps its own balance across sessions
+	if err := bank.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bank = NewBankWithStorage("test", NewFileStorage(path))
+	t.Cleanup(func() { bank.Close() })
+
+	want := map[string]Money{DefaultAccountID: Dollars(5), "savings": Dollars(50), "checking": 0}
+	for accountID, balance := range want {
+		if actual, err := bank.GetAccountBalance(accountID); err != nil || actual != balance {
+			t.Errorf("balance of '%s' after restart is %s (error: %v), want %s", accountID, actual, err, balance)
+		}
+	}
+	checkLedger(t, bank)
+}
+
+func TestClientManagesAccounts(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	client, _ := newTestClient(t, bank)
+
+	if err := client.OpenAccount("savings", ""); err != nil {
+		t.Fatal(err)
+	}
+	if accounts, err := client.ListAccounts(); err != nil || !reflect.DeepEqual(accounts, []string{DefaultAccountID, "savings"}) {
+		t.Errorf("accounts are %v (error: %v), want the default account and savings", accounts, err)
+	}
+
+	if _, err := client.DepositToAccount("savings", Cents(1234), "", "", AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	if balance, err := client.GetAccountBalance("savings"); err != nil || balance != Cents(1234) {
+		t.Errorf("balance of savings is %s (error: %v), want 12.34", balance, err)
+	}
+	if balance, err := client.GetBalance(); err != nil || balance != 0 {
+		t.Errorf("balance of default account is %s (error: %v), want 0.00", balance, err)
+	}
+
+	var notFound AccountNotFoundError
+	if _, err := client.WithdrawFromAccount("missing", Dollars(1), "", "", AnyVersion); !errors.As(err, &notFound) {
+		t.Errorf("withdrawal from unknown account returned %v, want an AccountNotFoundError", err)
+	}
+}
+
+func TestOverdraftLimit(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	if _, err := bank.Deposit(Dollars(20), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// without an overdraft, the balance cannot go below zero
+	var insufficientFunds InsufficientFundsError
+	_, err := bank.Withdraw(Dollars(21), "")
+	if !errors.As(err, &insufficientFunds) || insufficientFunds.OverdraftLimitExceeded() {
+		t.Errorf("withdrawal beyond balance returned %v, want an InsufficientFundsError without an overdraft", err)
+	}
+
+	if err := bank.SetOverdraftLimit(DefaultAccountID, Dollars(50)); err != nil {
+		t.Fatal(err)
+	}
+	if limit, err := bank.GetOverdraftLimit(DefaultAccountID); err != nil || limit != Dollars(50) {
+		t.Errorf("overdraft limit is %s (error: %v), want 50.00", limit, err)
+	}
+	if _, err := bank.Withdraw(Dollars(60), ""); err != nil {
+		t.Fatalf("withdrawal within overdraft failed: %v", err)
+	}
+	if balance := bank.GetBalance(); balance != Dollars(-40) {
+		t.Errorf("balance after overdrawing is %s, want -40.00", balance)
+	}
+	_, err = bank.Withdraw(Cents(1001), "")
+	if !errors.As(err, &insufficientFunds) || !insufficientFunds.OverdraftLimitExceeded() {
+		t.Errorf("withdrawal beyond overdraft returned %v, want an InsufficientFundsError for the overdraft limit", err)
+	}
+	if _, err := bank.Withdraw(Dollars(10), ""); err != nil {
+		t.Errorf("withdrawal up to the overdraft limit failed: %v", err)
+	}
+
+	// lowering the limit leaves the balance, but prevents withdrawals
+	if err := bank.SetOverdraftLimit(DefaultAccountID, Dollars(10)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bank.Withdraw(Cents(1), ""); !errors.As(err, &insufficientFunds) {
+		t.Errorf("withdrawal below the lowered limit returned %v, want an InsufficientFundsError", err)
+	}
+	if balance := bank.GetBalance(); balance != Dollars(-50) {
+		t.Errorf("balance after lowering the limit is %s, want -50.00", balance)
+	}
+
+	if err := bank.SetOverdraftLimit(DefaultAccountID, Dollars(-1)); err == nil {
+		t.Error("set a negative overdraft limit")
+	}
+	var notFound AccountNotFoundError
+	if err := bank.SetOverdraftLimit("missing", Dollars(1)); !errors.As(err, &notFound) {
+		t.Errorf("setting the limit of an unknown account returned %v, want an AccountNotFoundError", err)
+	}
+
+	// the client reports whether the overdraft limit was exceeded
+	client, _ := newTestClient(t, bank)
+	if err := client.SetOverdraftLimit(DefaultAccountID, Dollars(60)); err != nil {
+		t.Fatal(err)
+	}
+	if limit, err := client.GetOverdraftLimit(DefaultAccountID); err != nil || limit != Dollars(60) {
+		t.Errorf("client returned overdraft limit %s (error: %v), want 60.00", limit, err)
+	}
+	_, err = client.Withdraw(Dollars(11), "")
+	if !errors.As(err, &insufficientFunds) || !insufficientFunds.OverdraftLimitExceeded() {
+		t.Errorf("client withdrawal beyond overdraft returned %v, want an InsufficientFundsError for the overdraft limit", err)
+	}
+	checkLedger(t, bank)
+}
+
+func TestClientErrorTypeIgnoresRequestInput(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	client, _ := newTestClient(t, bank)
+
+	// the messages repeat account IDs that look like error codes
+	var notFound AccountNotFoundError
+	if _, err := client.GetAccountBalance("INSUFFICIENT_FUNDS"); !errors.As(err, &notFound) {
+		t.Errorf("balance of unknown account returned %v, want an AccountNotFoundError", err)
+	}
+	if err := client.OpenAccount("ACCOUNT_NOT_FOUND", ""); err != nil {
+		t.Fatal(err)
+	}
+	var insufficientFunds InsufficientFundsError
+	_, err := client.WithdrawFromAccount("ACCOUNT_NOT_FOUND", Dollars(1), "", "", AnyVersion)
+	if !errors.As(err, &insufficientFunds) || insufficientFunds.OverdraftLimitExceeded() {
+		t.Errorf("withdrawal from empty account returned %v, want an InsufficientFundsError", err)
+	}
+
+	// only a code at the start of the response identifies the error
+	tests := []struct {
+		content string
+		code    string
+		message string
+		ok      bool
+	}{
+		{"ERROR: HOLD_NOT_FOUND: no hold with ID 'H1'\n", "HOLD_NOT_FOUND", "no hold with ID 'H1'", true},
+		{"ERROR: INVALID_AMOUNT\n", "", "", false},
+		{"failed: ERROR: INSUFFICIENT_FUNDS: too little", "", "", false},
+		{"", "", "", false},
+	}
+	for _, test := range tests {
+		code, message, ok := parseErrorResponse(test.content)
+		if code != test.code || message != test.message || ok != test.ok {
+			t.Errorf("error response '%s' parsed as (%s, %s, %v), want (%s, %s, %v)",
+				test.content, code, message, ok, test.code, test.message, test.ok)
+		}
+	}
+}
@@ -6,9 +6,11 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // BankClient allows a caller to invoke operations (such as Withdraw
@@ -47,10 +49,15 @@ func (client *BankClient) GetName() (string, error) {
 	return name, nil
 }
 
-// GetBalance returns the current account balance
-func (client *BankClient) GetBalance() (int, error) {
-	base := "http://%s:%d/balance"
-	url := fmt.Sprintf(base, client.host, client.port)
+// GetBalance returns the current balance of the default account
+func (client *BankClient) GetBalance() (Money, error) {
+	return client.GetAccountBalance(DefaultAccountID)
+}
+
+// GetAccountBalance returns the current balance of the specified account
+func (client *BankClient) GetAccountBalance(accountID string) (Money, error) {
+	base := "http://%s:%d/accounts/%s/balance"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(accountID))
 
 	content, err := callService(url)
 	if err != nil {
@@ -59,7 +66,7 @@ func (client *BankClient) GetBalance() (int, error) {
 	}
 
 	_, balanceString, _ := strings.Cut(content, "=")
-	balance, err := strconv.Atoi(balanceString)
+	balance, err := ParseMoney(balanceString)
 	if err != nil {
 		fmt.Printf("failed to parse balance from service response: %v\n", err)
 		return -1, err
@@ -68,13 +75,284 @@ func (client *BankClient) GetBalance() (int, error) {
 	return balance, nil
 }
 
+// GetBalanceAndVersion returns the current balance of the specified
+// account along with its version, which may be passed to
+// DepositToAccount or WithdrawFromAccount to make them conditional on
+// the account being unchanged
+func (client *BankClient) GetBalanceAndVersion(accountID string) (Money, uint64, error) {
+	base := "http://%s:%d/accounts/%s/balance"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(accountID))
+
+	content, header, err := callServiceWithHeader(url)
+	if err != nil {
+		fmt.Printf("Error retrieving balance: %v\n", err)
+		return -1, 0, err
+	}
+
+	_, balanceString, _ := strings.Cut(content, "=")
+	balance, err := ParseMoney(balanceString)
+	if err != nil {
+		fmt.Printf("failed to parse balance from service response: %v\n", err)
+		return -1, 0, err
+	}
+
+	version, err := parseETag(header.Get("ETag"))
+	if err != nil {
+		return -1, 0, fmt.Errorf("failed to parse version from service response: %w", err)
+	}
+
+	return balance, version, nil
+}
+
+// GetAccountCurrency returns the currency code of the specified account
+func (client *BankClient) GetAccountCurrency(accountID string) (string, error) {
+	base := "http://%s:%d/accounts/%s/currency"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(accountID))
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error retrieving currency: %v\n", err)
+		return "", err
+	}
+
+	_, currency, found := strings.Cut(content, "=")
+	if !found {
+		return "", fmt.Errorf("failed to parse currency from service response: %s", content)
+	}
+
+	return currency, nil
+}
+
+// GetOverdraftLimit returns how far below zero the balance of the
+// specified account may go
+func (client *BankClient) GetOverdraftLimit(accountID string) (Money, error) {
+	base := "http://%s:%d/accounts/%s/overdraft"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(accountID))
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error retrieving overdraft limit: %v\n", err)
+		return -1, err
+	}
+
+	_, limitString, _ := strings.Cut(content, "=")
+	limit, err := ParseMoney(limitString)
+	if err != nil {
+		fmt.Printf("failed to parse overdraft limit from service response: %v\n", err)
+		return -1, err
+	}
+
+	return limit, nil
+}
+
+// SetOverdraftLimit calls the banking service's admin API, requesting
+// that it changes how far below zero the balance of the specified
+// account may go. A limit of zero removes the overdraft.
+func (client *BankClient) SetOverdraftLimit(accountID string, limit Money) error {
+	base := "http://%s:%d/admin/accounts/%s/overdraft?limit=%s"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(accountID), limit)
+
+	_, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error setting overdraft limit: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetAccountLimits returns the limits on deposits to and withdrawals
+// from the specified account
+func (client *BankClient) GetAccountLimits(accountID string) (AccountLimits, error) {
+	base := "http://%s:%d/accounts/%s/limits"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(accountID))
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error retrieving account limits: %v\n", err)
+		return AccountLimits{}, err
+	}
+
+	fields := parseFields(content)
+	maxWithdrawal, maxErr := ParseMoney(fields["max-withdrawal"])
+	dailyWithdrawal, withdrawalErr := ParseMoney(fields["daily-withdrawal"])
+	dailyDeposit, depositErr := ParseMoney(fields["daily-deposit"])
+	if maxErr != nil || withdrawalErr != nil || depositErr != nil {
+		return AccountLimits{}, fmt.Errorf("failed to parse account limits from service response: %s", content)
+	}
+
+	limits := AccountLimits{
+		MaxWithdrawal:   maxWithdrawal,
+		DailyWithdrawal: dailyWithdrawal,
+		DailyDeposit:    dailyDeposit,
+	}
+
+	return limits, nil
+}
+
+// SetAccountLimits calls the banking service's admin API, requesting
+// that it replaces the limits on deposits to and withdrawals from the
+// specified account. A limit of zero means that there is no limit.
+func (client *BankClient) SetAccountLimits(accountID string, limits AccountLimits) error {
+	base := "http://%s:%d/admin/accounts/%s/limits?max-withdrawal=%s&daily-withdrawal=%s&daily-deposit=%s"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(accountID),
+		limits.MaxWithdrawal, limits.DailyWithdrawal, limits.DailyDeposit)
+
+	_, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error setting account limits: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetInterest returns the interest rate of the specified account and
+// the interest that it has accrued but not yet been paid
+func (client *BankClient) GetInterest(accountID string) (AccountInterest, error) {
+	base := "http://%s:%d/accounts/%s/interest"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(accountID))
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error retrieving interest: %v\n", err)
+		return AccountInterest{}, err
+	}
+
+	fields := parseFields(content)
+	accrued, err := ParseMoney(fields["accrued"])
+	if err != nil || fields["apr"] == "" {
+		return AccountInterest{}, fmt.Errorf("failed to parse interest from service response: %s", content)
+	}
+
+	return AccountInterest{APR: fields["apr"], Accrued: accrued}, nil
+}
+
+// SetInterestRate calls the banking service's admin API, requesting
+// that it changes the annual percentage rate, such as "4.5", at which
+// the specified account earns interest. A rate of zero stops the
+// account from earning interest.
+func (client *BankClient) SetInterestRate(accountID string, apr string) error {
+	base := "http://%s:%d/admin/accounts/%s/interest?apr=%s"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(accountID), url.QueryEscape(apr))
+
+	_, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error setting interest rate: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetAccountState calls the banking service, requesting the status of
+// the specified account and the reason that it last changed
+func (client *BankClient) GetAccountState(accountID string) (AccountState, error) {
+	base := "http://%s:%d/accounts/%s/status"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(accountID))
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error retrieving account status: %v\n", err)
+		return AccountState{}, err
+	}
+
+	return parseAccountState(content)
+}
+
+// SetAccountStatus calls the banking service's admin API, requesting
+// that it changes the status of the specified account, such as to
+// freeze or close it, for the specified reason.
+func (client *BankClient) SetAccountStatus(accountID string, status AccountStatus, reason string) error {
+	base := "http://%s:%d/admin/accounts/%s/status?status=%s&reason=%s"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(accountID),
+		url.QueryEscape(string(status)), url.QueryEscape(reason))
+
+	_, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error setting account status: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// ListAccounts returns the IDs of all accounts at the bank
+func (client *BankClient) ListAccounts() ([]string, error) {
+	base := "http://%s:%d/accounts"
+	url := fmt.Sprintf(base, client.host, client.port)
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error listing accounts: %v\n", err)
+		return nil, err
+	}
+
+	_, accounts, found := strings.Cut(content, "=")
+	if !found {
+		return nil, fmt.Errorf("failed to parse accounts from service response: %s", content)
+	}
+
+	if accounts == "" {
+		return []string{}, nil
+	}
+
+	return strings.Split(accounts, ","), nil
+}
+
+// OpenAccount calls the banking service, requesting that it creates
+// a new account with the specified ID and a zero balance in the
+// specified currency (or the bank's default currency if empty).
+func (client *BankClient) OpenAccount(accountID string, currency string) error {
+	base := "http://%s:%d/accounts/%s/open?currency=%s"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(accountID), url.QueryEscape(currency))
+
+	_, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error opening account: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// CloseAccount calls the banking service, requesting that it closes
+// the account with the specified ID. The account balance must be zero,
+// and once closed, the account refuses deposits and withdrawals.
+func (client *BankClient) CloseAccount(accountID string) error {
+	base := "http://%s:%d/accounts/%s/close"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(accountID))
+
+	_, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error closing account: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
 // Deposit calls the banking service, requesting that it adds the
-// specified amount to the balance. The idempotency key is used to
-// identify duplicate requests. This returns the transaction ID
-// if successful or an error if it was not.
-func (client *BankClient) Deposit(amount int, idempotencyKey string) (string, error) {
-	base := "http://%s:%d/deposit?amount=%d&idempotency-key=%s"
-	url := fmt.Sprintf(base, client.host, client.port, amount, url.QueryEscape(idempotencyKey))
+// specified amount to the balance of the default account. See
+// DepositToAccount for details.
+func (client *BankClient) Deposit(amount Money, idempotencyKey string) (string, error) {
+	return client.DepositToAccount(DefaultAccountID, amount, "", idempotencyKey, AnyVersion)
+}
+
+// DepositToAccount calls the banking service, requesting that it adds
+// the specified amount to the balance of the specified account. The
+// amount is in the specified currency, or the account's currency if
+// empty. The idempotency key is used to identify duplicate requests.
+// Unless the expected version is AnyVersion, the deposit is only made
+// if the account is still at that version (see GetBalanceAndVersion).
+// This returns the transaction ID if successful or an error if it
+// was not, which is a PreconditionFailedError if the account has
+// changed, a FraudSuspectedError if it was declined by the bank's fraud
+// rules, or a PendingReviewError if it is held for review.
+func (client *BankClient) DepositToAccount(accountID string, amount Money, currency string, idempotencyKey string, expectedVersion uint64) (string, error) {
+	base := "http://%s:%d/accounts/%s/deposit?amount=%s&currency=%s&idempotency-key=%s&expected-version=%d"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(accountID),
+		amount, url.QueryEscape(currency), url.QueryEscape(idempotencyKey), expectedVersion)
 
 	content, err := callService(url)
 	if err != nil {
@@ -82,22 +360,51 @@ func (client *BankClient) Deposit(amount int, idempotencyKey string) (string, er
 		return "", err
 	}
 
-	_, transactionID, found := strings.Cut(content, "=")
-	if !found {
+	// the ID may be followed by the fee charged for the deposit
+	transactionID := parseFields(content)["transaction-id"]
+	if transactionID == "" {
 		return "", fmt.Errorf("failed to parse ID from service response: %s", content)
 	}
 
 	return transactionID, nil
 }
 
-// Withdraw removes the specified amount from the balance. The
-// idempotency key is used to identify duplicate requests. This
-// returns a transaction ID if successful or will return an
-// error if the amount is invalid (either negative or greater
-// than the current balance).
-func (client *BankClient) Withdraw(amount int, idempotencyKey string) (string, error) {
-	base := "http://%s:%d/withdraw?amount=%d&idempotency-key=%s"
-	url := fmt.Sprintf(base, client.host, client.port, amount, url.QueryEscape(idempotencyKey))
+// Withdraw removes the specified amount from the balance of the
+// default account. See WithdrawFromAccount for details.
+func (client *BankClient) Withdraw(amount Money, idempotencyKey string) (string, error) {
+	return client.WithdrawFromAccount(DefaultAccountID, amount, "", idempotencyKey, AnyVersion)
+}
+
+// WithdrawFromAccount removes the specified amount from the balance
+// of the specified account. The amount is in the specified currency,
+// or the account's currency if empty. The idempotency key is used to
+// identify duplicate requests. Unless the expected version is
+// AnyVersion, the withdrawal is only made if the account is still at
+// that version (see GetBalanceAndVersion). This returns a transaction
+// ID if successful or will return an error if the amount is invalid
+// (either negative or greater than the current balance), a
+// PreconditionFailedError if the account has changed, a
+// FraudSuspectedError if it was declined by the bank's fraud rules, or
+// a PendingReviewError if it is held for review.
+func (client *BankClient) WithdrawFromAccount(accountID string, amount Money, currency string, idempotencyKey string, expectedVersion uint64) (string, error) {
+	return client.withdraw(accountID, amount, currency, idempotencyKey, expectedVersion, false)
+}
+
+// WithdrawForTransfer calls the banking service, requesting that it
+// removes the specified amount from the balance of the specified
+// account as the first step of a transfer to another bank, for which
+// it charges its transfer fee rather than its withdrawal fee. Otherwise,
+// it is the same as WithdrawFromAccount.
+func (client *BankClient) WithdrawForTransfer(accountID string, amount Money, currency string, idempotencyKey string, expectedVersion uint64) (string, error) {
+	return client.withdraw(accountID, amount, currency, idempotencyKey, expectedVersion, true)
+}
+
+// Makes a withdrawal as described for WithdrawFromAccount, which begins
+// a transfer if specified
+func (client *BankClient) withdraw(accountID string, amount Money, currency string, idempotencyKey string, expectedVersion uint64, transfer bool) (string, error) {
+	base := "http://%s:%d/accounts/%s/withdraw?amount=%s&currency=%s&idempotency-key=%s&expected-version=%d&transfer=%t"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(accountID),
+		amount, url.QueryEscape(currency), url.QueryEscape(idempotencyKey), expectedVersion, transfer)
 
 	content, err := callService(url)
 	if err != nil {
@@ -105,6 +412,124 @@ func (client *BankClient) Withdraw(amount int, idempotencyKey string) (string, e
 		return "", err
 	}
 
+	// the ID may be followed by the fee charged for the withdrawal
+	transactionID := parseFields(content)["transaction-id"]
+	if transactionID == "" {
+		return "", fmt.Errorf("failed to parse ID from service response: %s", content)
+	}
+
+	return transactionID, nil
+}
+
+// GetAvailableBalance returns the balance of the specified account
+// less the amounts reserved by its active holds
+func (client *BankClient) GetAvailableBalance(accountID string) (Money, error) {
+	base := "http://%s:%d/accounts/%s/available"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(accountID))
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error retrieving available balance: %v\n", err)
+		return -1, err
+	}
+
+	_, balanceString, _ := strings.Cut(content, "=")
+	balance, err := ParseMoney(balanceString)
+	if err != nil {
+		fmt.Printf("failed to parse available balance from service response: %v\n", err)
+		return -1, err
+	}
+
+	return balance, nil
+}
+
+// AuthorizeHold calls the banking service, requesting that it reserves
+// the specified amount in the specified account so that it can later
+// be captured or released. The idempotency key is used to identify
+// duplicate requests. This returns the hold ID if successful or an
+// error if it was not.
+func (client *BankClient) AuthorizeHold(accountID string, amount Money, idempotencyKey string) (string, error) {
+	base := "http://%s:%d/accounts/%s/authorize?amount=%s&idempotency-key=%s"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(accountID),
+		amount, url.QueryEscape(idempotencyKey))
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error placing hold: %v\n", err)
+		return "", err
+	}
+
+	_, holdID, found := strings.Cut(content, "=")
+	if !found {
+		return "", fmt.Errorf("failed to parse hold ID from service response: %s", content)
+	}
+
+	return holdID, nil
+}
+
+// CaptureHold calls the banking service, requesting that it withdraws
+// funds reserved by the specified hold. An amount of zero captures the
+// full amount held; a smaller amount captures part of it and releases
+// the remainder. The idempotency key is used to identify duplicate
+// requests. This returns the transaction ID if successful or an error
+// if it was not.
+func (client *BankClient) CaptureHold(holdID string, amount Money, idempotencyKey string) (string, error) {
+	base := "http://%s:%d/holds/%s/capture?idempotency-key=%s"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(holdID), url.QueryEscape(idempotencyKey))
+	if amount != 0 {
+		url = url + "&amount=" + amount.String()
+	}
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error capturing hold: %v\n", err)
+		return "", err
+	}
+
+	// the ID may be followed by the fee charged for the capture
+	transactionID := parseFields(content)["transaction-id"]
+	if transactionID == "" {
+		return "", fmt.Errorf("failed to parse ID from service response: %s", content)
+	}
+
+	return transactionID, nil
+}
+
+// ReleaseHold calls the banking service, requesting that it cancels
+// the specified hold so that its funds become available again.
+func (client *BankClient) ReleaseHold(holdID string) error {
+	base := "http://%s:%d/holds/%s/release"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(holdID))
+
+	_, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error releasing hold: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// ReverseTransaction calls the banking service, requesting that it
+// undoes the specified deposit, withdrawal, or capture by posting a
+// compensating transaction. An amount of zero reverses whatever has not
+// already been reversed; a smaller amount reverses part of it, such as
+// for a partial refund. The idempotency key is used to identify
+// duplicate requests. This returns the transaction ID of the reversal
+// if successful or an error if it was not.
+func (client *BankClient) ReverseTransaction(txID string, amount Money, idempotencyKey string) (string, error) {
+	base := "http://%s:%d/transactions/%s/reverse?idempotency-key=%s"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(txID), url.QueryEscape(idempotencyKey))
+	if amount != 0 {
+		url = url + "&amount=" + amount.String()
+	}
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error reversing transaction: %v\n", err)
+		return "", err
+	}
+
 	_, transactionID, found := strings.Cut(content, "=")
 	if !found {
 		return "", fmt.Errorf("failed to parse ID from service response: %s", content)
@@ -113,6 +538,363 @@ func (client *BankClient) Withdraw(amount int, idempotencyKey string) (string, e
 	return transactionID, nil
 }
 
+// ListTransactions returns one page of the transactions that match the
+// filter, oldest first. To retrieve the next page, call it again with
+// the filter's Cursor set to the NextCursor of this page, which is empty
+// once there are no more matching transactions.
+func (client *BankClient) ListTransactions(filter TransactionFilter) (TransactionPage, error) {
+	query := url.Values{}
+	setParam := func(name string, value string, isSet bool) {
+		if isSet {
+			query.Set(name, value)
+		}
+	}
+	setParam("account-id", filter.AccountID, filter.AccountID != "")
+	setParam("type", string(filter.Type), filter.Type != "")
+	setParam("min-amount", filter.MinAmount.String(), filter.MinAmount != 0)
+	setParam("max-amount", filter.MaxAmount.String(), filter.MaxAmount != 0)
+	setParam("since", filter.Since.Format(time.RFC3339Nano), !filter.Since.IsZero())
+	setParam("until", filter.Until.Format(time.RFC3339Nano), !filter.Until.IsZero())
+	setParam("idempotency-key", filter.IdempotencyKey, filter.IdempotencyKey != "")
+	setParam("cursor", filter.Cursor, filter.Cursor != "")
+	setParam("limit", strconv.Itoa(filter.Limit), filter.Limit != 0)
+
+	base := "http://%s:%d/transactions?%s"
+	url := fmt.Sprintf(base, client.host, client.port, query.Encode())
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error listing transactions: %v\n", err)
+		return TransactionPage{}, err
+	}
+
+	// the first line summarizes the page, followed by one line per entry
+	lines := strings.Split(content, "\n")
+	page := TransactionPage{
+		Transactions: []LedgerEntry{},
+		NextCursor:   parseFields(lines[0])["next-cursor"],
+	}
+
+	for _, line := range lines[1:] {
+		entry, err := parseLedgerEntry(line)
+		if err != nil {
+			return TransactionPage{}, err
+		}
+		page.Transactions = append(page.Transactions, entry)
+	}
+
+	return page, nil
+}
+
+// GetTransaction returns the outcome of the transaction with the
+// specified ID, including its status, amount, and the balance that
+// resulted from it. This returns a TransactionNotFoundError if the bank
+// has no such transaction.
+func (client *BankClient) GetTransaction(txID string) (TransactionOutcome, error) {
+	base := "http://%s:%d/transactions/%s"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(txID))
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error retrieving transaction: %v\n", err)
+		return TransactionOutcome{}, err
+	}
+
+	return parseOutcome(content)
+}
+
+// GetRequestOutcome returns the outcome of the request that was made
+// with the specified idempotency key, including its status, amount, and
+// the balance that resulted from it. This resolves whether a request
+// whose response was lost, such as a Withdraw call that timed out, was
+// processed. This returns a RequestNotFoundError if the bank has no
+// record of the request, in which case it was not processed.
+func (client *BankClient) GetRequestOutcome(idempotencyKey string) (TransactionOutcome, error) {
+	base := "http://%s:%d/requests/%s"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(idempotencyKey))
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error retrieving request outcome: %v\n", err)
+		return TransactionOutcome{}, err
+	}
+
+	return parseOutcome(content)
+}
+
+// GetStatement returns the statement for the specified account, in the
+// specified format, covering the period from one time (inclusive) to
+// another (exclusive). A zero time leaves that end of the period open.
+func (client *BankClient) GetStatement(accountID string, from time.Time, to time.Time, format StatementFormat) (string, error) {
+	query := url.Values{}
+	query.Set("format", string(format))
+	if !from.IsZero() {
+		query.Set("from", from.Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		query.Set("to", to.Format(time.RFC3339))
+	}
+
+	base := "http://%s:%d/accounts/%s/statement?%s"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(accountID), query.Encode())
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error retrieving statement: %v\n", err)
+		return "", err
+	}
+
+	return content, nil
+}
+
+// GetHold returns the details of the specified hold, including its
+// current status
+func (client *BankClient) GetHold(holdID string) (Hold, error) {
+	base := "http://%s:%d/holds/%s"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(holdID))
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error retrieving hold: %v\n", err)
+		return Hold{}, err
+	}
+
+	fields := parseFields(content)
+	amount, amountErr := ParseMoney(fields["amount"])
+	captured, capturedErr := ParseMoney(fields["captured"])
+	expiresAt, expiresErr := time.Parse(time.RFC3339, fields["expires-at"])
+	if amountErr != nil || capturedErr != nil || expiresErr != nil {
+		return Hold{}, fmt.Errorf("failed to parse hold from service response: %s", content)
+	}
+
+	hold := Hold{
+		ID:        fields["hold-id"],
+		AccountID: fields["account-id"],
+		Amount:    amount,
+		Captured:  captured,
+		Status:    HoldStatus(fields["status"]),
+		ExpiresAt: expiresAt,
+	}
+
+	return hold, nil
+}
+
+// CreateSchedule calls the banking service, requesting that it registers
+// a standing order as described for Bank.CreateSchedule, and returns
+// the ID of the schedule. The idempotency key is used to identify
+// duplicate requests.
+func (client *BankClient) CreateSchedule(schedule Schedule, idempotencyKey string) (string, error) {
+	query := url.Values{}
+	query.Set("type", string(schedule.Type))
+	query.Set("amount", schedule.Amount.String())
+	if schedule.Currency != "" {
+		query.Set("currency", schedule.Currency)
+	}
+	if schedule.Cron != "" {
+		query.Set("cron", schedule.Cron)
+	}
+	if schedule.Every != 0 {
+		query.Set("every", schedule.Every.String())
+	}
+	if !schedule.NextRun.IsZero() {
+		query.Set("start", schedule.NextRun.Format(time.RFC3339Nano))
+	}
+	if idempotencyKey != "" {
+		query.Set("idempotency-key", idempotencyKey)
+	}
+
+	base := "http://%s:%d/accounts/%s/schedule?%s"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(schedule.AccountID), query.Encode())
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error creating schedule: %v\n", err)
+		return "", err
+	}
+
+	scheduleID := parseFields(content)["schedule-id"]
+	if scheduleID == "" {
+		return "", fmt.Errorf("failed to parse schedule ID from service response: %s", content)
+	}
+
+	return scheduleID, nil
+}
+
+// GetSchedule returns the schedule with the specified ID
+func (client *BankClient) GetSchedule(scheduleID string) (Schedule, error) {
+	base := "http://%s:%d/schedules/%s"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(scheduleID))
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error retrieving schedule: %v\n", err)
+		return Schedule{}, err
+	}
+
+	_, pairs, _ := strings.Cut(content, ": ")
+	return parseSchedule(pairs)
+}
+
+// ListSchedules returns the schedules for the specified account, or for
+// all accounts if the account ID is empty, ordered by creation time
+func (client *BankClient) ListSchedules(accountID string) ([]Schedule, error) {
+	path := "/schedules"
+	if accountID != "" {
+		path = "/accounts/" + url.PathEscape(accountID) + "/schedules"
+	}
+	url := fmt.Sprintf("http://%s:%d%s", client.host, client.port, path)
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error listing schedules: %v\n", err)
+		return nil, err
+	}
+
+	// the first line gives the count, followed by one line per schedule
+	schedules := []Schedule{}
+	for _, line := range strings.Split(content, "\n")[1:] {
+		schedule, err := parseSchedule(line)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, nil
+}
+
+// PauseSchedule calls the banking service, requesting that it stops the
+// specified schedule from running until it is resumed
+func (client *BankClient) PauseSchedule(scheduleID string) error {
+	return client.changeSchedule(scheduleID, "pause")
+}
+
+// ResumeSchedule calls the banking service, requesting that it allows
+// the specified paused schedule to run again
+func (client *BankClient) ResumeSchedule(scheduleID string) error {
+	return client.changeSchedule(scheduleID, "resume")
+}
+
+// CancelSchedule calls the banking service, requesting that it stops
+// the specified schedule from ever running again
+func (client *BankClient) CancelSchedule(scheduleID string) error {
+	return client.changeSchedule(scheduleID, "cancel")
+}
+
+// Calls the service's route for performing the action on the schedule
+func (client *BankClient) changeSchedule(scheduleID string, action string) error {
+	base := "http://%s:%d/schedules/%s/%s"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(scheduleID), action)
+
+	_, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error performing %s on schedule: %v\n", action, err)
+		return err
+	}
+
+	return nil
+}
+
+// GetReview calls the banking service's admin API, requesting the
+// review with the specified ID
+func (client *BankClient) GetReview(reviewID string) (Review, error) {
+	base := "http://%s:%d/admin/reviews/%s"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(reviewID))
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error retrieving review: %v\n", err)
+		return Review{}, err
+	}
+
+	_, pairs, _ := strings.Cut(content, ": ")
+	return parseReview(pairs)
+}
+
+// ListReviews calls the banking service's admin API, requesting the
+// reviews with the specified status, or all reviews if the status is
+// empty, ordered by creation time
+func (client *BankClient) ListReviews(status ReviewStatus) ([]Review, error) {
+	base := "http://%s:%d/admin/reviews?status=%s"
+	url := fmt.Sprintf(base, client.host, client.port, url.QueryEscape(string(status)))
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error listing reviews: %v\n", err)
+		return nil, err
+	}
+
+	// the first line gives the count, followed by one line per review
+	reviews := []Review{}
+	for _, line := range strings.Split(content, "\n")[1:] {
+		review, err := parseReview(line)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+
+	return reviews, nil
+}
+
+// ApproveReview calls the banking service's admin API, requesting that
+// it approves the specified review, with an optional note, and makes the
+// transaction that it holds. This returns the ID of the transaction.
+func (client *BankClient) ApproveReview(reviewID string, note string) (string, error) {
+	base := "http://%s:%d/admin/reviews/%s/approve?note=%s"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(reviewID), url.QueryEscape(note))
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error approving review: %v\n", err)
+		return "", err
+	}
+
+	transactionID := parseFields(content)["transaction-id"]
+	if transactionID == "" {
+		return "", fmt.Errorf("failed to parse ID from service response: %s", content)
+	}
+
+	return transactionID, nil
+}
+
+// DeclineReview calls the banking service's admin API, requesting that
+// it declines the specified review, with an optional note, so that the
+// transaction that it holds is never made
+func (client *BankClient) DeclineReview(reviewID string, note string) error {
+	base := "http://%s:%d/admin/reviews/%s/decline?note=%s"
+	url := fmt.Sprintf(base, client.host, client.port, url.PathEscape(reviewID), url.QueryEscape(note))
+
+	_, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error declining review: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// ReloadFraudRules calls the banking service's admin API, requesting
+// that it reloads its fraud rules from their file immediately. This
+// returns the number of rules that were loaded.
+func (client *BankClient) ReloadFraudRules() (int, error) {
+	base := "http://%s:%d/admin/fraud-rules/reload"
+	url := fmt.Sprintf(base, client.host, client.port)
+
+	content, err := callService(url)
+	if err != nil {
+		fmt.Printf("Error reloading fraud rules: %v\n", err)
+		return 0, err
+	}
+
+	count, err := strconv.Atoi(parseFields(content)["rules"])
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse rule count from service response: %s", content)
+	}
+
+	return count, nil
+}
+
 // IsServiceRunning returns true if the service is available, false otherwise
 func (client *BankClient) IsServiceRunning() bool {
 	base := "http://%s:%d/balance"
@@ -121,38 +903,311 @@ func (client *BankClient) IsServiceRunning() bool {
 	return err == nil
 }
 
+// utility function for parsing a service response that contains several
+// space-separated name=value pairs following the status prefix, such as
+// "SUCCESS: hold-id=H123 status=ACTIVE"
+func parseFields(content string) map[string]string {
+	_, pairs, _ := strings.Cut(content, ": ")
+	return parsePairs(pairs)
+}
+
+// Returns the schedule described by space-separated name=value pairs
+func parseSchedule(line string) (Schedule, error) {
+	fields := parsePairs(line)
+
+	amount, amountErr := ParseMoney(fields["amount"])
+	runs, runsErr := strconv.Atoi(fields["runs"])
+	created, createdErr := time.Parse(time.RFC3339Nano, fields["created"])
+	cron, cronErr := url.QueryUnescape(fields["cron"])
+	lastError, lastErrorErr := url.QueryUnescape(fields["last-error"])
+	if amountErr != nil || runsErr != nil || createdErr != nil || cronErr != nil || lastErrorErr != nil {
+		return Schedule{}, fmt.Errorf("failed to parse schedule from service response: %s", line)
+	}
+
+	schedule := Schedule{
+		ID:                fields["schedule-id"],
+		AccountID:         fields["account-id"],
+		Type:              TransactionType(fields["type"]),
+		Amount:            amount,
+		Currency:          fields["currency"],
+		Cron:              cron,
+		Status:            ScheduleStatus(fields["status"]),
+		Runs:              runs,
+		LastTransactionID: fields["last-tx-id"],
+		LastError:         lastError,
+		Created:           created,
+	}
+
+	var err error
+	if fields["every"] != "" {
+		if schedule.Every, err = time.ParseDuration(fields["every"]); err != nil {
+			return Schedule{}, fmt.Errorf("failed to parse schedule from service response: %s", line)
+		}
+	}
+
+	if fields["next-run"] != "" {
+		if schedule.NextRun, err = time.Parse(time.RFC3339Nano, fields["next-run"]); err != nil {
+			return Schedule{}, fmt.Errorf("failed to parse schedule from service response: %s", line)
+		}
+	}
+
+	return schedule, nil
+}
+
+// Returns the review described by space-separated name=value pairs
+func parseReview(line string) (Review, error) {
+	fields := parsePairs(line)
+
+	amount, amountErr := ParseMoney(fields["amount"])
+	created, createdErr := time.Parse(time.RFC3339Nano, fields["created"])
+	rule, ruleErr := url.QueryUnescape(fields["rule"])
+	reason, reasonErr := url.QueryUnescape(fields["reason"])
+	note, noteErr := url.QueryUnescape(fields["note"])
+	if amountErr != nil || createdErr != nil || ruleErr != nil || reasonErr != nil || noteErr != nil {
+		return Review{}, fmt.Errorf("failed to parse review from service response: %s", line)
+	}
+
+	review := Review{
+		ID:            fields["review-id"],
+		AccountID:     fields["account-id"],
+		Type:          TransactionType(fields["type"]),
+		Amount:        amount,
+		Currency:      fields["currency"],
+		Rule:          rule,
+		Reason:        reason,
+		Status:        ReviewStatus(fields["status"]),
+		Note:          note,
+		TransactionID: fields["transaction-id"],
+		Created:       created,
+	}
+
+	if fields["resolved"] != "" {
+		var err error
+		if review.Resolved, err = time.Parse(time.RFC3339Nano, fields["resolved"]); err != nil {
+			return Review{}, fmt.Errorf("failed to parse review from service response: %s", line)
+		}
+	}
+
+	return review, nil
+}
+
+// Returns the account state described by a service response
+func parseAccountState(content string) (AccountState, error) {
+	fields := parseFields(content)
+	status, statusErr := ParseAccountStatus(fields["status"])
+	reason, reasonErr := url.QueryUnescape(fields["reason"])
+	if statusErr != nil || reasonErr != nil {
+		return AccountState{}, fmt.Errorf("failed to parse account status from service response: %s", content)
+	}
+
+	state := AccountState{Status: status, Reason: reason}
+	if fields["changed"] != "" {
+		var err error
+		if state.Changed, err = time.Parse(time.RFC3339Nano, fields["changed"]); err != nil {
+			return AccountState{}, fmt.Errorf("failed to parse account status from service response: %s", content)
+		}
+	}
+
+	return state, nil
+}
+
+// Returns the outcome of a transaction described by a service response
+func parseOutcome(content string) (TransactionOutcome, error) {
+	_, pairs, _ := strings.Cut(content, ": ")
+	entry, err := parseLedgerEntry(pairs)
+	if err != nil {
+		return TransactionOutcome{}, err
+	}
+
+	fields := parsePairs(pairs)
+	reversedAmount, err := ParseMoney(fields["reversed-amount"])
+	if err != nil {
+		return TransactionOutcome{}, fmt.Errorf("failed to parse transaction from service response: %s", content)
+	}
+
+	outcome := TransactionOutcome{
+		LedgerEntry:    entry,
+		Status:         TransactionStatus(fields["status"]),
+		ReversedAmount: reversedAmount,
+	}
+
+	return outcome, nil
+}
+
+// Returns the ledger entry described by a line of name=value pairs in
+// a service response, or an error if the line cannot be parsed
+func parseLedgerEntry(line string) (LedgerEntry, error) {
+	fields := parsePairs(line)
+
+	amount, amountErr := ParseMoney(fields["amount"])
+	balance, balanceErr := ParseMoney(fields["balance"])
+	timestamp, timestampErr := time.Parse(time.RFC3339Nano, fields["timestamp"])
+	idempotencyKey, keyErr := url.QueryUnescape(fields["idempotency-key"])
+	if amountErr != nil || balanceErr != nil || timestampErr != nil || keyErr != nil {
+		return LedgerEntry{}, fmt.Errorf("failed to parse transaction from service response: %s", line)
+	}
+
+	entry := LedgerEntry{
+		TransactionID:  fields["tx-id"],
+		AccountID:      fields["account-id"],
+		Type:           TransactionType(fields["type"]),
+		Amount:         amount,
+		IdempotencyKey: idempotencyKey,
+		Timestamp:      timestamp,
+		Balance:        balance,
+		Currency:       fields["currency"],
+		HoldID:         fields["hold-id"],
+		ReversalOf:     fields["reversal-of"],
+		FeeFor:         fields["fee-for"],
+	}
+
+	if fields["original-currency"] != "" {
+		originalAmount, amountErr := ParseMoney(fields["original-amount"])
+		fee, feeErr := ParseMoney(fields["conversion-fee"])
+		if amountErr != nil || feeErr != nil {
+			return LedgerEntry{}, fmt.Errorf("failed to parse transaction from service response: %s", line)
+		}
+
+		entry.OriginalAmount = originalAmount
+		entry.OriginalCurrency = fields["original-currency"]
+		entry.ExchangeRate = fields["exchange-rate"]
+		entry.ConversionFee = fee
+	}
+
+	return entry, nil
+}
+
+// Returns the space-separated name=value pairs in the text as a map
+func parsePairs(pairs string) map[string]string {
+	fields := make(map[string]string)
+
+	for _, pair := range strings.Fields(pairs) {
+		name, value, found := strings.Cut(pair, "=")
+		if found {
+			fields[name] = value
+		}
+	}
+
+	return fields
+}
+
 // utility function for making calls to the banking service
 // Input is a valid URL (with URL-escaped parameters)
 // Output is the response as a string, or an error
 func callService(url string) (string, error) {
+	content, _, err := callServiceWithHeader(url)
+	return content, err
+}
+
+// Calls the service as described for callService, but also returns the
+// header of the response
+func callServiceWithHeader(url string) (string, http.Header, error) {
 	resp, err := http.Get(url)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	content := string(body)
 
 	status := resp.StatusCode
+	code, message, hasCode := parseErrorResponse(content)
+
+	// the request was accepted, but is held for review rather than made
+	if status == http.StatusAccepted && hasCode && code == "PENDING_REVIEW" {
+		reviewID := path.Base(resp.Header.Get("Location"))
+		return "", resp.Header, PendingReviewError{message: message, reviewID: reviewID}
+	}
+
 	if status >= 400 {
 		// Expose a specific type of business-level error so that it
 		// could be defined as non-retryable in a RetryPolicy
-		if strings.Contains(content, "INSUFFICIENT_FUNDS") {
-			re := regexp.MustCompile(`INSUFFICIENT_FUNDS:\s(.*)`)
-			matches := re.FindStringSubmatch(content)
-			return "", InsufficientFundsError{message: matches[1]}
+		if hasCode {
+			if err := typedError(code, message, resp.Header); err != nil {
+				return "", resp.Header, err
+			}
 		}
 
 		// some other type of error, such as a malformed request
 		message := fmt.Sprintf("HTTP Error %d: %s", status, content)
 
-		return "", errors.New(message)
+		return "", resp.Header, errors.New(message)
 	}
 
-	return content, nil
+	return content, resp.Header, nil
+}
+
+// matches an error response written by the service, which starts with
+// the code identifying the type of error, followed by its message
+var errorResponsePattern = regexp.MustCompile(`(?s)^ERROR: ([A-Z_]+): (.*)$`)
+
+// matches the name of the rule in the message of a FraudSuspectedError
+var fraudRulePattern = regexp.MustCompile(`fraud rule '([^']*)'`)
+
+// Returns the code and message of an error response written by the
+// service, or false if the content is not in that form. Only the start
+// of the content is considered, since the message may repeat input
+// from the request, such as an account ID, that looks like a code.
+func parseErrorResponse(content string) (string, string, bool) {
+	matches := errorResponsePattern.FindStringSubmatch(strings.TrimSuffix(content, "\n"))
+	if matches == nil {
+		return "", "", false
+	}
+
+	return matches[1], matches[2], true
+}
+
+// Returns the typed error for the code in an error response, or nil if
+// the code does not identify one
+func typedError(code string, message string, header http.Header) error {
+	switch code {
+	case "OVERDRAFT_LIMIT_EXCEEDED":
+		return InsufficientFundsError{message: message, overdraftLimitExceeded: true}
+	case "INSUFFICIENT_FUNDS":
+		return InsufficientFundsError{message: message}
+	case "LIMIT_EXCEEDED":
+		return LimitExceededError{message: message}
+	case "ACCOUNT_NOT_FOUND":
+		return AccountNotFoundError{message: message}
+	case "ACCOUNT_CLOSED":
+		return AccountClosedError{message: message}
+	case "ACCOUNT_FROZEN", "ACCOUNT_DORMANT":
+		status := AccountStatus(strings.TrimPrefix(code, "ACCOUNT_"))
+		return AccountRestrictedError{message: message, status: status}
+	case "FRAUD_SUSPECTED":
+		// the rule is named after the details of the transaction, so the
+		// last match is the rule even if those contain something similar
+		var rule string
+		if ruleMatches := fraudRulePattern.FindAllStringSubmatch(message, -1); ruleMatches != nil {
+			rule = ruleMatches[len(ruleMatches)-1][1]
+		}
+		return FraudSuspectedError{message: message, rule: rule}
+	case "HOLD_NOT_FOUND":
+		return HoldNotFoundError{message: message}
+	case "SCHEDULE_NOT_FOUND":
+		return ScheduleNotFoundError{message: message}
+	case "REVIEW_NOT_FOUND":
+		return ReviewNotFoundError{message: message}
+	case "TRANSACTION_NOT_FOUND":
+		return TransactionNotFoundError{message: message}
+	case "REQUEST_NOT_FOUND":
+		return RequestNotFoundError{message: message}
+	case "PRECONDITION_FAILED":
+		currentVersion, _ := parseETag(header.Get("ETag"))
+		return PreconditionFailedError{message: message, currentVersion: currentVersion}
+	case "IDEMPOTENCY_CONFLICT":
+		return IdempotencyConflictError{message: message}
+	}
+
+	return nil
+}
+
+// Returns the account version in an entity tag returned by the service
+func parseETag(etag string) (uint64, error) {
+	return strconv.ParseUint(strings.Trim(etag, `"`), 10, 64)
 }
@@ -0,0 +1,81 @@
+package banking
+
+import "time"
+
+// Clock supplies the current time to a Bank, which uses it to timestamp
+// ledger entries, expire holds and idempotency keys, and accrue
+// interest. Replacing the clock makes time-based behavior reproducible,
+// such as in tests that advance time by a month without waiting for it.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+}
+
+// SystemClock is a Clock that reports the time from the operating
+// system. It is the clock that a Bank uses unless configured otherwise.
+type SystemClock struct{}
+
+// Now returns the current local time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SetClock replaces the clock that the bank uses to tell the time. The
+// clock should not be moved backward, since entries are expected to be
+// appended to the ledger in the order of their timestamps.
+func (bank *Bank) SetClock(clock Clock) {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	bank.clock = clock
+}
+
+// Returns the current time according to the bank's clock. The caller
+// must hold lock, either shared or exclusively.
+func (bank *Bank) now() time.Time {
+	return bank.clock.Now()
+}
+
+// backgroundTask calls a function periodically in its own goroutine
+// until it is stopped
+type backgroundTask struct {
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// Returns a task that calls fn immediately and then at the specified
+// interval, measured by the system clock
+func startBackgroundTask(interval time.Duration, fn func()) *backgroundTask {
+	task := &backgroundTask{
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(task.stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			fn()
+
+			select {
+			case <-task.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return task
+}
+
+// Stops calling the function, waiting for a call in progress to finish.
+// A nil task has already stopped.
+func (task *backgroundTask) Stop() {
+	if task != nil {
+		close(task.stop)
+		<-task.stopped
+	}
+}
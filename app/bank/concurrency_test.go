@@ -0,0 +1,617 @@
+package banking
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// These tests make requests to a bank from many goroutines at once, as
+// when its service handles many clients concurrently, and check that
+// the result is the same as if the requests had been made one at a
+// time. Run them with the race detector: go test -race ./app/bank
+
+// The number of clients making requests concurrently in each test
+const concurrentClients = 300
+
+// Runs fn from the specified number of goroutines at once, passing each
+// its index, and waits for them all to finish
+func runConcurrently(clients int, fn func(client int)) {
+	var ready, done sync.WaitGroup
+	start := make(chan struct{})
+	ready.Add(clients)
+	done.Add(clients)
+	for i := 0; i < clients; i++ {
+		go func(client int) {
+			defer done.Done()
+			ready.Done()
+			<-start
+			fn(client)
+		}(i)
+	}
+
+	// release the clients together, so that their requests overlap
+	ready.Wait()
+	close(start)
+	done.Wait()
+}
+
+// Runs the test with and without group commit, which changes how the
+// operations wait for their changes to be written
+func forEachCommitMode(t *testing.T, test func(t *testing.T, groupCommit bool)) {
+	for _, groupCommit := range []bool{false, true} {
+		t.Run(fmt.Sprintf("group-commit=%v", groupCommit), func(t *testing.T) {
+			test(t, groupCommit)
+		})
+	}
+}
+
+func TestConcurrentWithdrawalsCannotOverdraw(t *testing.T) {
+	forEachCommitMode(t, func(t *testing.T, groupCommit bool) {
+		bank := newTestBank(t, StorageFile, groupCommit)
+		if _, err := bank.Deposit(Dollars(100), ""); err != nil {
+			t.Fatal(err)
+		}
+
+		// only 200 of the withdrawals can be covered by the balance
+		var succeeded, refused atomic.Int64
+		runConcurrently(concurrentClients, func(int) {
+			_, err := bank.Withdraw(Cents(50), "")
+			var insufficientFunds InsufficientFundsError
+			switch {
+			case err == nil:
+				succeeded.Add(1)
+			case errors.As(err, &insufficientFunds):
+				refused.Add(1)
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+
+		if succeeded.Load() != 200 || refused.Load() != concurrentClients-200 {
+			t.Errorf("%d withdrawals succeeded and %d were refused, want 200 and %d",
+				succeeded.Load(), refused.Load(), concurrentClients-200)
+		}
+
+		if balance := bank.GetBalance(); balance != 0 {
+			t.Errorf("balance is %s, want 0.00", balance)
+		}
+
+		checkLedger(t, bank)
+	})
+}
+
+func TestConcurrentWithdrawalsCannotExceedDailyLimit(t *testing.T) {
+	forEachCommitMode(t, func(t *testing.T, groupCommit bool) {
+		bank := newTestBank(t, StorageFile, groupCommit)
+		if _, err := bank.Deposit(Dollars(1000), ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := bank.SetAccountLimits(DefaultAccountID, AccountLimits{DailyWithdrawal: Dollars(100)}); err != nil {
+			t.Fatal(err)
+		}
+
+		// the balance covers every withdrawal, but the limit allows 200
+		var succeeded, refused atomic.Int64
+		runConcurrently(concurrentClients, func(int) {
+			_, err := bank.Withdraw(Cents(50), "")
+			var limitExceeded LimitExceededError
+			switch {
+			case err == nil:
+				succeeded.Add(1)
+			case errors.As(err, &limitExceeded):
+				refused.Add(1)
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+
+		if succeeded.Load() != 200 || refused.Load() != concurrentClients-200 {
+			t.Errorf("%d withdrawals succeeded and %d were refused, want 200 and %d",
+				succeeded.Load(), refused.Load(), concurrentClients-200)
+		}
+
+		if balance := bank.GetBalance(); balance != Dollars(900) {
+			t.Errorf("balance is %s, want 900.00", balance)
+		}
+
+		checkLedger(t, bank)
+	})
+}
+
+func TestConcurrentDuplicateRequestsAreProcessedOnce(t *testing.T) {
+	forEachCommitMode(t, func(t *testing.T, groupCommit bool) {
+		bank := newTestBank(t, StorageFile, groupCommit)
+
+		// every client retries the same deposit, except that a few reuse
+		// its key for a different amount, which must be rejected
+		txIDs := make([]string, concurrentClients)
+		var conflicts atomic.Int64
+		runConcurrently(concurrentClients, func(client int) {
+			amount := Dollars(10)
+			if client%10 == 0 {
+				amount = Dollars(20)
+			}
+
+			txID, err := bank.Deposit(amount, "duplicate-deposit")
+			var conflict IdempotencyConflictError
+			switch {
+			case err == nil:
+				txIDs[client] = txID
+			case errors.As(err, &conflict):
+				conflicts.Add(1)
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+
+		// whichever amount was processed first, the other was a conflict
+		processed := map[string]bool{}
+		for _, txID := range txIDs {
+			if txID != "" {
+				processed[txID] = true
+			}
+		}
+
+		if len(processed) != 1 {
+			t.Fatalf("deposit was processed %d times, want once", len(processed))
+		}
+
+		ledger, _ := bank.GetLedger(DefaultAccountID)
+		if len(ledger) != 1 {
+			t.Fatalf("ledger has %d entries, want 1", len(ledger))
+		}
+
+		wantConflicts := int64(concurrentClients / 10)
+		if ledger[0].Amount == Dollars(20) {
+			wantConflicts = concurrentClients - wantConflicts
+		}
+		if conflicts.Load() != wantConflicts {
+			t.Errorf("%d requests conflicted, want %d", conflicts.Load(), wantConflicts)
+		}
+
+		if balance := bank.GetBalance(); balance != ledger[0].Amount {
+			t.Errorf("balance is %s, want %s", balance, ledger[0].Amount)
+		}
+	})
+}
+
+func TestConcurrentHoldsCannotReserveMoreThanBalance(t *testing.T) {
+	forEachCommitMode(t, func(t *testing.T, groupCommit bool) {
+		bank := newTestBank(t, StorageFile, groupCommit)
+		if _, err := bank.Deposit(Dollars(100), ""); err != nil {
+			t.Fatal(err)
+		}
+
+		// holds compete with withdrawals for the same funds
+		var holdIDs sync.Map
+		var reserved atomic.Int64
+		runConcurrently(concurrentClients, func(client int) {
+			var err error
+			if client%2 == 0 {
+				var holdID string
+				holdID, err = bank.AuthorizeHold(DefaultAccountID, Dollars(1), "")
+				if err == nil {
+					holdIDs.Store(holdID, client)
+					reserved.Add(int64(Dollars(1)))
+				}
+			} else {
+				_, err = bank.Withdraw(Dollars(1), "")
+				if err == nil {
+					reserved.Add(int64(Dollars(1)))
+				}
+			}
+
+			var insufficientFunds InsufficientFundsError
+			if err != nil && !errors.As(err, &insufficientFunds) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+
+		if reserved.Load() != int64(Dollars(100)) {
+			t.Errorf("holds and withdrawals took %s, want 100.00", Money(reserved.Load()))
+		}
+
+		// each hold is captured by some clients, retrying with the same
+		// key, and released by others; only one of them can take effect
+		runConcurrently(concurrentClients, func(client int) {
+			holdIDs.Range(func(key, _ any) bool {
+				holdID := key.(string)
+				if client%2 == 0 {
+					bank.CaptureHold(holdID, 0, "capture-"+holdID)
+				} else {
+					bank.ReleaseHold(holdID)
+				}
+				return true
+			})
+		})
+
+		captures := map[string]int{}
+		entries, _ := bank.GetLedger(DefaultAccountID)
+		for _, entry := range entries {
+			if entry.Type == TransactionCapture {
+				captures[entry.HoldID]++
+			}
+		}
+
+		holdIDs.Range(func(key, _ any) bool {
+			hold, _ := bank.GetHold(key.(string))
+			wantCaptures := 0
+			if hold.Status == HoldCaptured {
+				wantCaptures = 1
+			} else if hold.Status != HoldReleased {
+				t.Errorf("hold %s is %s, want %s or %s", hold.ID, hold.Status, HoldCaptured, HoldReleased)
+			}
+
+			if captures[hold.ID] != wantCaptures {
+				t.Errorf("hold %s is %s, but was captured %d times", hold.ID, hold.Status, captures[hold.ID])
+			}
+			return true
+		})
+
+		available, _ := bank.GetAvailableBalance(DefaultAccountID)
+		if available != bank.GetBalance() {
+			t.Errorf("available balance is %s, want %s since no hold is active", available, bank.GetBalance())
+		}
+
+		checkLedger(t, bank)
+	})
+}
+
+func TestConcurrentOperationsAreDurable(t *testing.T) {
+	forEachCommitMode(t, func(t *testing.T, groupCommit bool) {
+		path := filepath.Join(t.TempDir(), "bank-test.dat")
+		discardLogOutput(t)
+
+		bank := NewBankWithStorage("test", NewFileStorage(path))
+		bank.SetGroupCommit(groupCommit)
+		bank.SetSnapshotInterval(100)
+
+		accounts := []string{"alpha", "bravo", "charlie", "delta"}
+		for _, accountID := range accounts {
+			if err := bank.OpenAccount(accountID, DefaultCurrency); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := bank.DepositToAccount(accountID, Dollars(50), "", "", AnyVersion); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// a mix of writers and readers, so that snapshots are taken while
+		// operations are in progress
+		runConcurrently(concurrentClients, func(client int) {
+			accountID := accounts[client%len(accounts)]
+			key := "request-" + strconv.Itoa(client)
+			switch client % 6 {
+			case 0:
+				bank.DepositToAccount(accountID, Cents(125), "", key, AnyVersion)
+			case 1:
+				bank.WithdrawFromAccount(accountID, Cents(75), "", key, AnyVersion)
+			case 2:
+				if holdID, err := bank.AuthorizeHold(accountID, Cents(40), key); err == nil {
+					bank.CaptureHold(holdID, Cents(30), "")
+				}
+			case 3:
+				if txID, err := bank.DepositToAccount(accountID, Cents(200), "", key, AnyVersion); err == nil {
+					bank.ReverseTransaction(txID, Cents(50), "")
+				}
+			case 4:
+				if _, err := bank.ListTransactions(TransactionFilter{AccountID: accountID}); err != nil {
+					t.Errorf("could not list transactions: %v", err)
+				}
+				bank.GetRequestOutcome("request-" + strconv.Itoa(client-4))
+			case 5:
+				if _, err := bank.GetStatement(accountID, time.Time{}, time.Time{}); err != nil {
+					t.Errorf("could not get statement: %v", err)
+				}
+				bank.GetAvailableBalance(accountID)
+			}
+		})
+
+		checkLedger(t, bank)
+
+		balances := map[string]Money{}
+		for _, accountID := range accounts {
+			balances[accountID], _ = bank.GetAccountBalance(accountID)
+		}
+		ledger, _ := bank.ListTransactions(TransactionFilter{Limit: MaxTransactionPageSize})
+		if err := bank.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// everything that succeeded must be there after a restart
+		reopened := NewBankWithStorage("test", NewFileStorage(path))
+		defer reopened.Close()
+
+		for _, accountID := range accounts {
+			balance, err := reopened.GetAccountBalance(accountID)
+			if err != nil || balance != balances[accountID] {
+				t.Errorf("balance of '%s' after restart is %s (%v), want %s", accountID, balance, err, balances[accountID])
+			}
+		}
+
+		reloaded, _ := reopened.ListTransactions(TransactionFilter{Limit: MaxTransactionPageSize})
+		if len(reloaded.Transactions) != len(ledger.Transactions) {
+			t.Errorf("ledger has %d entries after restart, want %d", len(reloaded.Transactions), len(ledger.Transactions))
+		}
+
+		checkLedger(t, reopened)
+	})
+}
+
+func TestConcurrentHTTPRequests(t *testing.T) {
+	bank := newTestBank(t, StorageFile, true)
+	if _, err := bank.Deposit(Dollars(100), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	client, _ := newTestClient(t, bank)
+
+	// each client withdraws twice, retrying the second withdrawal with
+	// the same key as if its first attempt had timed out
+	var withdrawn atomic.Int64
+	runConcurrently(concurrentClients, func(i int) {
+		if _, err := client.Withdraw(Cents(10), ""); err == nil {
+			withdrawn.Add(int64(Cents(10)))
+		}
+
+		key := "retry-" + strconv.Itoa(i)
+		first, err := client.Withdraw(Cents(25), key)
+		if err == nil {
+			withdrawn.Add(int64(Cents(25)))
+		}
+
+		retried, retryErr := client.Withdraw(Cents(25), key)
+		if (err == nil) != (retryErr == nil) || first != retried {
+			t.Errorf("retry returned (%s, %v), original returned (%s, %v)", retried, retryErr, first, err)
+		}
+	})
+
+	balance, err := client.GetBalance()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := Dollars(100) - Money(withdrawn.Load()); balance != want {
+		t.Errorf("balance is %s after withdrawing %s, want %s", balance, Money(withdrawn.Load()), want)
+	}
+
+	if balance < 0 {
+		t.Errorf("balance %s is overdrawn", balance)
+	}
+
+	checkLedger(t, bank)
+}
+
+func TestExpectedVersionPreventsLostUpdates(t *testing.T) {
+	bank := newTestBank(t, StorageFile, true)
+	if _, err := bank.Deposit(Dollars(100), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	client, serverURL := newTestClient(t, bank)
+	balance, version, err := client.GetBalanceAndVersion(DefaultAccountID)
+	if err != nil || balance != Dollars(100) {
+		t.Fatalf("balance is %s (%v), want 100.00", balance, err)
+	}
+
+	// every client saw the same balance and tries to spend most of it,
+	// but only the first withdrawal can be made at that version
+	var succeeded, refused atomic.Int64
+	runConcurrently(concurrentClients, func(i int) {
+		_, err := client.WithdrawFromAccount(DefaultAccountID, Dollars(60), "", "spend-"+strconv.Itoa(i), version)
+		var preconditionFailed PreconditionFailedError
+		switch {
+		case err == nil:
+			succeeded.Add(1)
+		case errors.As(err, &preconditionFailed):
+			if preconditionFailed.CurrentVersion() != version+1 {
+				t.Errorf("current version is %d, want %d", preconditionFailed.CurrentVersion(), version+1)
+			}
+			refused.Add(1)
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	if succeeded.Load() != 1 || refused.Load() != concurrentClients-1 {
+		t.Errorf("%d withdrawals succeeded and %d were refused, want 1 and %d",
+			succeeded.Load(), refused.Load(), concurrentClients-1)
+	}
+
+	// a retry of the withdrawal that succeeded returns its result, even
+	// though the account is no longer at the version it expected
+	txID, err := client.WithdrawFromAccount(DefaultAccountID, Dollars(10), "", "retry", version+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retriedTxID, err := client.WithdrawFromAccount(DefaultAccountID, Dollars(10), "", "retry", version+1)
+	if err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	if retriedTxID != txID {
+		t.Errorf("retry returned %s, want %s", retriedTxID, txID)
+	}
+
+	// the version may also be given in an If-Match header
+	balance, version, _ = client.GetBalanceAndVersion(DefaultAccountID)
+	for _, test := range []struct {
+		ifMatch    string
+		wantStatus int
+	}{
+		{versionETag(version - 1), http.StatusPreconditionFailed},
+		{"invalid", http.StatusBadRequest},
+		{versionETag(version), http.StatusOK},
+		{"*", http.StatusOK},
+	} {
+		request, _ := http.NewRequest(http.MethodGet, serverURL+"/accounts/primary/deposit?amount=1.00", nil)
+		request.Header.Set("If-Match", test.ifMatch)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+
+		if response.StatusCode != test.wantStatus {
+			t.Errorf("deposit with If-Match %s returned status %d, want %d", test.ifMatch, response.StatusCode, test.wantStatus)
+		}
+	}
+
+	if final := bank.GetBalance(); final != balance+Dollars(2) {
+		t.Errorf("balance is %s, want %s", final, balance+Dollars(2))
+	}
+}
+
+func TestOutcomeIsReportedOnceDurable(t *testing.T) {
+	discardLogOutput(t)
+	storage := &blockingStorage{
+		failingStorage: failingStorage{Storage: NewMemoryStorage()},
+		blocked:        make(chan struct{}),
+		release:        make(chan struct{}),
+	}
+	bank := NewBankWithStorage("test", storage)
+	t.Cleanup(func() { bank.Close() })
+	bank.SetSnapshotInterval(0)
+	bank.SetGroupCommit(false)
+
+	// the second deposit is applied, but waits behind the first to be
+	// written, and then cannot be
+	first := make(chan error, 1)
+	go func() {
+		_, err := bank.Deposit(Dollars(10), "first")
+		first <- err
+	}()
+	<-storage.blocked
+	second := make(chan error, 1)
+	go func() {
+		_, err := bank.Deposit(Dollars(20), "second")
+		second <- err
+	}()
+	for queued := false; !queued; runtime.Gosched() {
+		bank.walLock.Lock()
+		queued = len(bank.pending) > 0
+		bank.walLock.Unlock()
+	}
+
+	type result struct {
+		outcome TransactionOutcome
+		err     error
+	}
+	lookup := make(chan result, 1)
+	go func() {
+		outcome, err := bank.GetRequestOutcome("second")
+		lookup <- result{outcome, err}
+	}()
+	select {
+	case r := <-lookup:
+		close(storage.release)
+		t.Fatalf("outcome of deposit being written was returned before it was durable: %+v (error: %v)", r.outcome, r.err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	storage.failures.Store(1)
+	close(storage.release)
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-second; err == nil {
+		t.Error("deposit succeeded although it could not be written to the log")
+	}
+	if r := <-lookup; r.err == nil {
+		t.Errorf("outcome of deposit that could not be written is %+v, want an error", r.outcome)
+	}
+
+	var notFound RequestNotFoundError
+	if _, err := bank.GetRequestOutcome("second"); !errors.As(err, &notFound) {
+		t.Errorf("outcome of undone deposit returned %v, want a RequestNotFoundError", err)
+	}
+	if outcome, err := bank.GetRequestOutcome("first"); err != nil || outcome.Amount != Dollars(10) {
+		t.Errorf("outcome of first deposit is %+v (error: %v), want a deposit of 10.00", outcome, err)
+	}
+}
+
+// Checks that each account's balance is the sum of its ledger entries,
+// and that each entry's recorded balance follows from those before it
+func checkLedger(t *testing.T, bank *Bank) {
+	t.Helper()
+
+	bank.lock.RLock()
+	defer bank.lock.RUnlock()
+
+	derived := map[string]Money{}
+	for _, entry := range bank.ledger {
+		derived[entry.AccountID] += entry.delta()
+		if entry.Balance != derived[entry.AccountID] {
+			t.Errorf("ledger entry %s records balance %s, but entries sum to %s",
+				entry.TransactionID, entry.Balance, derived[entry.AccountID])
+		}
+	}
+
+	for id, acct := range bank.accounts {
+		if acct.Balance != derived[id] {
+			t.Errorf("balance of '%s' is %s, but its ledger entries sum to %s", id, acct.Balance, derived[id])
+		}
+	}
+}
+
+// Returns a client for a service for the bank, which handles all of the
+// service's requests, along with the URL of the service. The service is
+// stopped when the test finishes.
+func newTestClient(t *testing.T, bank *Bank) (*BankClient, string) {
+	svc := NewBankingService(bank, 0)
+	mux := http.NewServeMux()
+	svc.registerHandlers(mux)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return NewBankClient(host, portNumber), server.URL
+}
+
+// Returns a new bank using the specified kind of storage in a temporary
+// directory, which is closed when the test finishes. Snapshots are
+// disabled, and log output is discarded for the rest of the test.
+func newTestBank(tb testing.TB, kind string, groupCommit bool) *Bank {
+	tb.Helper()
+	discardLogOutput(tb)
+
+	var storage Storage
+	var err error
+	switch kind {
+	case StorageFile:
+		storage = NewFileStorage(filepath.Join(tb.TempDir(), "bank-test.dat"))
+	case StorageBolt:
+		storage, err = OpenBoltStorage(filepath.Join(tb.TempDir(), "bank-test.db"))
+	default:
+		storage, err = OpenStorage(kind, "test")
+	}
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	bank := NewBankWithStorage("test", storage)
+	tb.Cleanup(func() { bank.Close() })
+	bank.SetSnapshotInterval(0)
+	bank.SetGroupCommit(groupCommit)
+
+	return bank
+}
+
+// Discards log output until the test finishes
+func discardLogOutput(tb testing.TB) {
+	log.SetOutput(io.Discard)
+	tb.Cleanup(func() { log.SetOutput(os.Stderr) })
+}
@@ -0,0 +1,166 @@
+package banking
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// how far ahead to look for a time that matches a cron expression, so
+// that an expression that can never match (such as one for February 30)
+// does not search forever
+const cronSearchLimit = 5 * 365 * 24 * time.Hour
+
+// abbreviations for commonly used cron expressions
+var cronMacros = map[string]string{
+	"@yearly":  "0 0 1 1 *",
+	"@monthly": "0 0 1 * *",
+	"@weekly":  "0 0 * * 0",
+	"@daily":   "0 0 * * *",
+	"@hourly":  "0 * * * *",
+}
+
+// cronExpression is a parsed cron expression, which matches the times
+// whose minute, hour, day of month, month, and day of week (0 or 7 for
+// Sunday) are each in the corresponding set, interpreted in UTC. As in
+// traditional cron, if both the day of month and the day of week are
+// restricted, a day matches if either one does.
+type cronExpression struct {
+	minutes, hours, days, months, weekdays uint64 // bit i is set if i matches
+	anyDay, anyWeekday                     bool   // whether the field was "*"
+}
+
+// Parses a cron expression with five space-separated fields (minute,
+// hour, day of month, month, and day of week), each of which is "*" or
+// a comma-separated list of values, ranges such as "1-5", and steps such
+// as "*/15" or "0-30/10". The abbreviations @hourly, @daily, @weekly,
+// @monthly, and @yearly are also accepted.
+func parseCron(expr string) (cronExpression, error) {
+	text := strings.TrimSpace(expr)
+	if macro, found := cronMacros[text]; found {
+		text = macro
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) != 5 {
+		return cronExpression{}, fmt.Errorf("invalid cron expression '%s': expected 5 fields", expr)
+	}
+
+	var cron cronExpression
+	var err error
+	limits := []struct {
+		set       *uint64
+		low, high int
+	}{
+		{&cron.minutes, 0, 59},
+		{&cron.hours, 0, 23},
+		{&cron.days, 1, 31},
+		{&cron.months, 1, 12},
+		{&cron.weekdays, 0, 7},
+	}
+	for i, limit := range limits {
+		*limit.set, err = parseCronField(fields[i], limit.low, limit.high)
+		if err != nil {
+			return cronExpression{}, fmt.Errorf("invalid cron expression '%s': %w", expr, err)
+		}
+	}
+
+	// 7 is another way of writing Sunday
+	if cron.weekdays&(1<<7) != 0 {
+		cron.weekdays |= 1
+	}
+	cron.anyDay = fields[2] == "*"
+	cron.anyWeekday = fields[4] == "*"
+
+	return cron, nil
+}
+
+// Returns the set of values matched by a field of a cron expression
+func parseCronField(field string, low int, high int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangeText, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepText)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in '%s'", part)
+			}
+		}
+
+		first, last := low, high
+		if rangeText != "*" {
+			firstText, lastText, isRange := strings.Cut(rangeText, "-")
+			var err error
+			first, err = strconv.Atoi(firstText)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value in '%s'", part)
+			}
+
+			last = first
+			if isRange {
+				last, err = strconv.Atoi(lastText)
+				if err != nil {
+					return 0, fmt.Errorf("invalid range in '%s'", part)
+				}
+			} else if hasStep {
+				// as in "5/15", meaning every 15 starting at 5
+				last = high
+			}
+		}
+
+		if first < low || last > high || first > last {
+			return 0, fmt.Errorf("'%s' is outside the range %d-%d", part, low, high)
+		}
+
+		for value := first; value <= last; value += step {
+			set |= 1 << value
+		}
+	}
+
+	return set, nil
+}
+
+// Returns the first time after the specified one that matches the
+// expression, which is always at the start of a minute, or a zero time
+// if there is no such time within the next few years
+func (cron cronExpression) next(after time.Time) time.Time {
+	t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+	for t.Before(limit) {
+		switch {
+		case cron.months&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !cron.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case cron.hours&(1<<t.Hour()) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case cron.minutes&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// Reports whether the day of the time matches the expression's day of
+// month and day of week fields
+func (cron cronExpression) matchesDay(t time.Time) bool {
+	day := cron.days&(1<<t.Day()) != 0
+	weekday := cron.weekdays&(1<<int(t.Weekday())) != 0
+
+	switch {
+	case cron.anyDay && cron.anyWeekday:
+		return true
+	case cron.anyDay:
+		return weekday
+	case cron.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
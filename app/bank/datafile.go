@@ -0,0 +1,184 @@
+package banking
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// dataSchemaVersion is the version of the data file format written by
+// this code. Earlier versions are migrated when they are loaded:
+//
+//	0: a bare number, the balance of the only account
+//	1: the bankData object, without a version, metadata, or checksum
+//	2: a dataDocument wrapping the bankData object
+const dataSchemaVersion = 2
+
+// dataDocument is the top-level object in a data file. The checksum
+// covers the compact JSON encoding of Data, so that a file which was
+// truncated or altered is detected when it is loaded rather than being
+// loaded with missing or incorrect balances.
+type dataDocument struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Metadata      dataMetadata    `json:"metadata"`
+	Checksum      string          `json:"checksum"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// dataMetadata describes a data file, for the benefit of people reading
+// it; none of it is needed to load the file.
+type dataMetadata struct {
+	BankName     string    `json:"bankName"`
+	SavedAt      time.Time `json:"savedAt"`
+	AccountCount int       `json:"accountCount"`
+	LedgerLength int       `json:"ledgerLength"`
+}
+
+// Encodes the bank data as the contents of a data file in the current
+// format
+func encodeDataFile(bankName string, data bankData) ([]byte, error) {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(dataDocument{
+		SchemaVersion: dataSchemaVersion,
+		Metadata: dataMetadata{
+			BankName:     bankName,
+			SavedAt:      time.Now().UTC(),
+			AccountCount: len(data.Accounts),
+			LedgerLength: len(data.Ledger),
+		},
+		Checksum: checksum(content),
+		Data:     content,
+	}, "", "  ")
+}
+
+// Decodes the contents of a data file in any supported format, and
+// returns the bank data along with the schema version of the file. It
+// returns an error if the file is not valid, fails its checksum, or was
+// written in a newer format than this code supports.
+func decodeDataFile(content []byte) (bankData, int, error) {
+	var data bankData
+
+	// version 0 files contain only the balance of the default account
+	var legacyBalance Money
+	if err := json.Unmarshal(content, &legacyBalance); err == nil {
+		data.Accounts = map[string]*account{
+			DefaultAccountID: {ID: DefaultAccountID, Currency: DefaultCurrency, Balance: legacyBalance},
+		}
+		return data, 0, nil
+	}
+
+	var document dataDocument
+	if err := json.Unmarshal(content, &document); err != nil {
+		return data, 0, fmt.Errorf("could not parse data file: %w", err)
+	}
+
+	switch {
+	case document.SchemaVersion == 0:
+		// version 1 files are the bankData object itself
+		if err := json.Unmarshal(content, &data); err != nil {
+			return data, 1, fmt.Errorf("could not parse data file: %w", err)
+		}
+		return data, 1, nil
+	case document.SchemaVersion > dataSchemaVersion:
+		msg := "data file has schema version %d, but only versions up to %d are supported"
+		return data, document.SchemaVersion, fmt.Errorf(msg, document.SchemaVersion, dataSchemaVersion)
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, document.Data); err != nil {
+		return data, document.SchemaVersion, fmt.Errorf("could not parse data file: %w", err)
+	}
+
+	if sum := checksum(compact.Bytes()); sum != document.Checksum {
+		msg := "data file checksum %s does not match its contents (%s)"
+		return data, document.SchemaVersion, fmt.Errorf(msg, document.Checksum, sum)
+	}
+
+	if err := json.Unmarshal(compact.Bytes(), &data); err != nil {
+		return data, document.SchemaVersion, fmt.Errorf("could not parse data file: %w", err)
+	}
+
+	return data, document.SchemaVersion, nil
+}
+
+// Returns the checksum of the content, prefixed by the algorithm
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Replaces the file at the path with one containing the content, such
+// that a crash at any point leaves either the old file or the new one,
+// never a partially written one. The content is written to a temporary
+// file in the same directory, flushed to disk, and renamed over the
+// original; the directory is then flushed so that the rename itself
+// survives a crash.
+func writeFileAtomically(path string, content []byte) error {
+	dir := filepath.Dir(path)
+	temp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	// has no effect once the temporary file has been renamed
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(content); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(temp.Name(), 0644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// Flushes the directory to disk, so that files created or renamed in it
+// are durable. Windows does not support this, and does not need it.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// Removes temporary files left behind by writes to the data file at the
+// path that were interrupted by a crash
+func removeTempFiles(path string) {
+	matches, _ := filepath.Glob(path + ".tmp-*")
+	for _, match := range matches {
+		os.Remove(match)
+	}
+}
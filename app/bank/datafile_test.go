@@ -0,0 +1,176 @@
+package banking
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDataFileRoundTrip(t *testing.T) {
+	data := bankData{
+		Accounts: map[string]*account{
+			DefaultAccountID: {ID: DefaultAccountID, Currency: DefaultCurrency, Balance: Cents(1234), Version: 2},
+		},
+		Ledger: []LedgerEntry{{TransactionID: "D0000000001", AccountID: DefaultAccountID, Type: TransactionDeposit,
+			Amount: Cents(1234), Timestamp: time.Date(2026, time.March, 1, 9, 0, 0, 0, time.UTC), Balance: Cents(1234)}},
+		Requests:    map[string]idempotencyRecord{},
+		WALSequence: 7,
+	}
+
+	content, err := encodeDataFile("test", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, version, err := decodeDataFile(content)
+	if err != nil || version != dataSchemaVersion || !reflect.DeepEqual(decoded, data) {
+		t.Errorf("decoded data file is (%+v, %d, %v), want (%+v, %d, nil)", decoded, version, err, data, dataSchemaVersion)
+	}
+
+	var document dataDocument
+	if err := json.Unmarshal(content, &document); err != nil {
+		t.Fatal(err)
+	}
+	if document.Metadata.BankName != "test" || document.Metadata.AccountCount != 1 || document.Metadata.LedgerLength != 1 {
+		t.Errorf("data file metadata is %+v, want 1 account and 1 ledger entry at 'test'", document.Metadata)
+	}
+}
+
+func TestDecodeDataFileRejectsInvalidContent(t *testing.T) {
+	content, err := encodeDataFile("test", bankData{
+		Accounts: map[string]*account{DefaultAccountID: {Currency: DefaultCurrency, Balance: Dollars(10)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// reformatting does not affect the checksum, but changing the data
+	// does
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, content, "", "\t"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := decodeDataFile(indented.Bytes()); err != nil {
+		t.Errorf("decoding reformatted data file failed: %v", err)
+	}
+
+	invalid := map[string][]byte{
+		"altered":   bytes.Replace(content, []byte(`"balance": 10.00`), []byte(`"balance": 1000.00`), 1),
+		"truncated": content[:len(content)/2],
+		"newer":     bytes.Replace(content, []byte(`"schemaVersion": 2`), []byte(`"schemaVersion": 3`), 1),
+		"empty":     {},
+		"not JSON":  []byte("balance: 10"),
+	}
+	if bytes.Equal(invalid["altered"], content) || bytes.Equal(invalid["newer"], content) {
+		t.Fatalf("data file is not in the expected format:\n%s", content)
+	}
+	for name, content := range invalid {
+		if data, _, err := decodeDataFile(content); err == nil {
+			t.Errorf("decoded %s data file as %+v, want an error", name, data)
+		}
+	}
+}
+
+func TestLegacyDataFilesAreMigrated(t *testing.T) {
+	discardLogOutput(t)
+
+	v1 := `{"accounts":{"primary":{"balance":100},"savings":{"balance":5}},` +
+		`"ledger":[{"txID":"D0000000001","accountID":"primary","type":"DEPOSIT","amount":100,` +
+		`"idempotencyKey":"deposit-key","timestamp":"2026-01-05T09:00:00Z","balance":100},` +
+		`{"txID":"D0000000002","accountID":"savings","type":"DEPOSIT","amount":5,` +
+		`"timestamp":"2026-01-05T10:00:00Z","balance":5}]}`
+	tests := []struct {
+		version  int
+		content  string
+		balances map[string]Money
+	}{
+		{0, "250", map[string]Money{DefaultAccountID: Dollars(250)}},
+		{1, v1, map[string]Money{DefaultAccountID: Dollars(100), "savings": Dollars(5)}},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "bank-test.dat")
+		if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		bank := NewBankWithStorage("test", NewFileStorage(path))
+		for accountID, balance := range test.balances {
+			if actual, err := bank.GetAccountBalance(accountID); err != nil || actual != balance {
+				t.Errorf("balance of '%s' migrated from version %d is %s (error: %v), want %s",
+					accountID, test.version, actual, err, balance)
+			}
+		}
+		checkLedger(t, bank)
+
+		// the key of a transaction from the ledger is still recognized
+		// while it is retained
+		if test.version == 1 {
+			bank.SetClock(&fakeClock{now: time.Date(2026, time.January, 5, 12, 0, 0, 0, time.UTC)})
+			if txID, err := bank.Deposit(Dollars(100), "deposit-key"); err != nil || txID != "D0000000001" {
+				t.Errorf("retried deposit after migration returned (%s, %v), want (D0000000001, nil)", txID, err)
+			}
+		}
+		if err := bank.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// the original is kept, and the data file is in the current format
+		backupPath := fmt.Sprintf("%s.v%d.bak", path, test.version)
+		if backup, err := os.ReadFile(backupPath); err != nil || string(backup) != test.content {
+			t.Errorf("backup of version %d data file is '%s' (error: %v), want the original", test.version, backup, err)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, version, err := decodeDataFile(content); err != nil || version != dataSchemaVersion {
+			t.Errorf("data file migrated from version %d has version %d (error: %v), want %d",
+				test.version, version, err, dataSchemaVersion)
+		}
+	}
+}
+
+func TestCorruptDataFileIsKept(t *testing.T) {
+	discardLogOutput(t)
+	path := filepath.Join(t.TempDir(), "bank-test.dat")
+
+	bank := NewBankWithStorage("test", NewFileStorage(path))
+	bank.SetSnapshotInterval(1)
+	if _, err := bank.Deposit(Dollars(10), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := bank.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := bytes.Replace(content, []byte(`"balance": 10.00`), []byte(`"balance": 1000.00`), 1)
+	if bytes.Equal(corrupt, content) {
+		t.Fatalf("data file is not in the expected format:\n%s", content)
+	}
+	if err := os.WriteFile(path, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the altered balance is not loaded, but a copy of the file is kept
+	bank = NewBankWithStorage("test", NewFileStorage(path))
+	t.Cleanup(func() { bank.Close() })
+	if balance := bank.GetBalance(); balance == Dollars(1000) {
+		t.Errorf("loaded balance %s from a data file that fails its checksum", balance)
+	}
+
+	matches, _ := filepath.Glob(path + ".corrupt-*")
+	if len(matches) != 1 {
+		t.Fatalf("found backups %v of corrupt data file, want one", matches)
+	}
+	if backup, err := os.ReadFile(matches[0]); err != nil || !bytes.Equal(backup, corrupt) {
+		t.Errorf("backup of corrupt data file is '%s' (error: %v), want the original", backup, err)
+	}
+}
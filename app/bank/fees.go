@@ -0,0 +1,302 @@
+package banking
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+)
+
+// identifies withdrawals made as the first step of a transfer to
+// another bank, which are charged the transfer fee rather than the
+// withdrawal fee, in fee schedules and idempotency fingerprints; the
+// withdrawal itself is recorded in the ledger as a WITHDRAWAL
+const transferRequest TransactionType = "TRANSFER"
+
+// FeeSchedule determines the fee that a Bank charges for deposits,
+// withdrawals, and transfers, each of which may have its own rule. A
+// fee is posted to the ledger as a separate TransactionFee entry, which
+// names the transaction that it was charged for. Amounts in the schedule
+// are in the currency of the account being charged.
+type FeeSchedule struct {
+	rules map[TransactionType]feeRule
+}
+
+// feeRule charges a flat amount plus a percentage of the amount of a
+// transaction, or the flat amount and percentage of the first tier whose
+// upper bound is at least that amount. The fee is then raised to the
+// minimum or lowered to the maximum, where those are not zero.
+type feeRule struct {
+	flat  Money
+	rate  *big.Rat // a fraction, such as 0.01 for 1%
+	tiers []feeTier
+	min   Money
+	max   Money
+}
+
+// feeTier is the part of a tiered rule that applies to amounts up to
+// its upper bound, or to any amount if the bound is zero
+type feeTier struct {
+	upTo Money
+	flat Money
+	rate *big.Rat
+}
+
+// feeTable is the format of a file of fees, such as:
+//
+//	{
+//	  "deposit": { "flat": "0.25" },
+//	  "withdrawal": { "percent": "1", "min": "0.50", "max": "5.00" },
+//	  "transfer": {
+//	    "tiers": [
+//	      { "upTo": "100", "flat": "1.00" },
+//	      { "upTo": "1000", "flat": "2.50" },
+//	      { "percent": "0.25" }
+//	    ],
+//	    "max": "25.00"
+//	  }
+//	}
+type feeTable struct {
+	Deposit    *feeTableRule `json:"deposit"`
+	Withdrawal *feeTableRule `json:"withdrawal"`
+	Transfer   *feeTableRule `json:"transfer"`
+}
+
+type feeTableRule struct {
+	Flat    string         `json:"flat"`
+	Percent string         `json:"percent"`
+	Tiers   []feeTableTier `json:"tiers"`
+	Min     string         `json:"min"`
+	Max     string         `json:"max"`
+}
+
+type feeTableTier struct {
+	UpTo    string `json:"upTo"`
+	Flat    string `json:"flat"`
+	Percent string `json:"percent"`
+}
+
+// LoadFeeSchedule returns a FeeSchedule with the fees read from the
+// specified JSON file. Transactions for which the file has no rule are
+// free. It returns an error if the file could not be read or contains
+// an invalid rule.
+func LoadFeeSchedule(path string) (*FeeSchedule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var table feeTable
+	err = json.Unmarshal(data, &table)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse fee file '%s': %w", path, err)
+	}
+
+	return newFeeSchedule(table)
+}
+
+func newFeeSchedule(table feeTable) (*FeeSchedule, error) {
+	fees := FeeSchedule{rules: make(map[TransactionType]feeRule)}
+	for txType, tableRule := range map[TransactionType]*feeTableRule{
+		TransactionDeposit:    table.Deposit,
+		TransactionWithdrawal: table.Withdrawal,
+		transferRequest:       table.Transfer,
+	} {
+		if tableRule == nil {
+			continue
+		}
+
+		rule, err := parseFeeRule(*tableRule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s fee: %w", txType, err)
+		}
+		fees.rules[txType] = rule
+	}
+
+	return &fees, nil
+}
+
+func parseFeeRule(tableRule feeTableRule) (feeRule, error) {
+	var rule feeRule
+	var err error
+	for _, field := range []struct {
+		text  string
+		value *Money
+	}{
+		{tableRule.Flat, &rule.flat},
+		{tableRule.Min, &rule.min},
+		{tableRule.Max, &rule.max},
+	} {
+		if *field.value, err = parseFeeAmount(field.text); err != nil {
+			return feeRule{}, err
+		}
+	}
+
+	if rule.max != 0 && rule.max < rule.min {
+		return feeRule{}, fmt.Errorf("maximum %s is less than minimum %s", rule.max, rule.min)
+	}
+
+	if rule.rate, err = parseFeePercent(tableRule.Percent); err != nil {
+		return feeRule{}, err
+	}
+
+	for i, tableTier := range tableRule.Tiers {
+		var tier feeTier
+		if tier.upTo, err = parseFeeAmount(tableTier.UpTo); err != nil {
+			return feeRule{}, err
+		}
+		if tier.flat, err = parseFeeAmount(tableTier.Flat); err != nil {
+			return feeRule{}, err
+		}
+		if tier.rate, err = parseFeePercent(tableTier.Percent); err != nil {
+			return feeRule{}, err
+		}
+
+		// only the last tier may apply to any amount
+		last := i == len(tableRule.Tiers)-1
+		if (tier.upTo == 0 && !last) || (i > 0 && tier.upTo != 0 && tier.upTo <= rule.tiers[i-1].upTo) {
+			return feeRule{}, fmt.Errorf("tiers must be in increasing order of their upper bounds")
+		}
+		rule.tiers = append(rule.tiers, tier)
+	}
+
+	return rule, nil
+}
+
+// Parses an amount in a fee file, where an empty amount is zero
+func parseFeeAmount(text string) (Money, error) {
+	if text == "" {
+		return 0, nil
+	}
+
+	amount, err := ParseMoney(text)
+	if err != nil || amount < 0 {
+		return 0, fmt.Errorf("invalid amount: '%s'", text)
+	}
+
+	return amount, nil
+}
+
+// Parses a percentage in a fee file as a fraction, where an empty
+// percentage is zero
+func parseFeePercent(text string) (*big.Rat, error) {
+	if text == "" {
+		return new(big.Rat), nil
+	}
+
+	percent, ok := new(big.Rat).SetString(text)
+	if !ok || percent.Sign() < 0 {
+		return nil, fmt.Errorf("invalid percentage: '%s'", text)
+	}
+
+	return percent.Quo(percent, big.NewRat(100, 1)), nil
+}
+
+// Returns the fee for a transaction of the specified type (a deposit,
+// withdrawal, or transfer) and amount, rounded to the nearest cent. A
+// nil schedule charges no fees.
+func (fees *FeeSchedule) feeFor(txType TransactionType, amount Money) (Money, error) {
+	if fees == nil {
+		return 0, nil
+	}
+
+	rule, found := fees.rules[txType]
+	if !found {
+		return 0, nil
+	}
+
+	flat, rate := rule.flat, rule.rate
+	if len(rule.tiers) > 0 {
+		flat, rate = 0, new(big.Rat)
+		for _, tier := range rule.tiers {
+			if tier.upTo == 0 || amount <= tier.upTo {
+				flat, rate = tier.flat, tier.rate
+				break
+			}
+		}
+	}
+
+	percentage, err := multiply(amount, rate)
+	if err != nil {
+		return 0, err
+	}
+
+	fee, err := flat.Add(percentage)
+	if err != nil {
+		return 0, err
+	}
+
+	if fee < rule.min {
+		fee = rule.min
+	}
+	if rule.max != 0 && fee > rule.max {
+		fee = rule.max
+	}
+
+	return fee, nil
+}
+
+// SetFeeSchedule replaces the schedule of fees charged for deposits,
+// withdrawals, and transfers; a nil schedule means that no fees are
+// charged, which is the default. Fees already charged are not affected.
+func (bank *Bank) SetFeeSchedule(fees *FeeSchedule) {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	bank.fees = fees
+}
+
+// GetTransactionFee returns the ledger entry that records the fee
+// charged for the transaction with the specified ID, and whether a fee
+// was charged for it.
+func (bank *Bank) GetTransactionFee(txID string) (LedgerEntry, bool) {
+	bank.lock.RLock()
+	defer bank.lock.RUnlock()
+
+	bank.ledgerLock.Lock()
+	defer bank.ledgerLock.Unlock()
+
+	// the fee is posted immediately after the transaction, so it is
+	// usually among the most recent entries
+	for i := len(bank.ledger) - 1; i >= 0; i-- {
+		if entry := bank.ledger[i]; entry.FeeFor == txID && entry.Type == TransactionFee {
+			return entry, true
+		}
+	}
+
+	return LedgerEntry{}, false
+}
+
+// Debits the fee for the transaction recorded by the ledger entry from
+// the account, unless the fee is zero, and returns the entries to be
+// saved: that of the transaction, followed by that of the fee. The fee
+// shares the transaction's idempotency key, since it is charged once
+// for the request. The caller must have checked that the account has
+// the funds to pay it.
+func (bank *Bank) chargeFee(acct *account, entry LedgerEntry, fee Money) []LedgerEntry {
+	if fee == 0 {
+		return []LedgerEntry{entry}
+	}
+
+	acct.Balance = acct.Balance - fee
+	feeEntry := bank.appendToLedger(acct, LedgerEntry{
+		TransactionID:  generateTransactionID("F", 10),
+		Type:           TransactionFee,
+		Amount:         fee,
+		IdempotencyKey: entry.IdempotencyKey,
+		FeeFor:         entry.TransactionID,
+	})
+
+	return []LedgerEntry{entry, feeEntry}
+}
+
+// Logs the fees among the ledger entries, once they have been saved
+func (bank *Bank) logFees(entries []LedgerEntry) {
+	for _, entry := range entries {
+		if entry.Type == TransactionFee {
+			log.Printf("Charged fee of %s %s to '%s' account '%s' for %s (ID: %s)",
+				entry.Amount, entry.Currency, bank.name, entry.AccountID, entry.FeeFor, entry.TransactionID)
+		}
+	}
+}
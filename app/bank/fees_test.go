@@ -0,0 +1,184 @@
+package banking
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testFeeFile = `{
+  "deposit": { "flat": "0.25" },
+  "withdrawal": { "percent": "1", "min": "0.50", "max": "5.00" },
+  "transfer": {
+    "tiers": [
+      { "upTo": "100", "flat": "1.00" },
+      { "upTo": "1000", "flat": "2.50" },
+      { "percent": "0.25" }
+    ],
+    "max": "25.00"
+  }
+}`
+
+// Returns the fee schedule in testFeeFile
+func loadTestFees(t *testing.T) *FeeSchedule {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fees.json")
+	if err := os.WriteFile(path, []byte(testFeeFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fees, err := LoadFeeSchedule(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fees
+}
+
+func TestFeeSchedule(t *testing.T) {
+	fees := loadTestFees(t)
+	tests := []struct {
+		txType TransactionType
+		amount Money
+		want   Money
+	}{
+		{TransactionDeposit, Dollars(5000), Cents(25)},
+		{TransactionWithdrawal, Dollars(10), Cents(50)},
+		{TransactionWithdrawal, Cents(12345), Cents(123)},
+		{TransactionWithdrawal, Dollars(600), Dollars(5)},
+		{transferRequest, Dollars(100), Dollars(1)},
+		{transferRequest, Cents(10001), Cents(250)},
+		{transferRequest, Dollars(2000), Dollars(5)},
+		{transferRequest, Dollars(20000), Dollars(25)},
+		{TransactionCapture, Dollars(100), 0},
+	}
+
+	for _, test := range tests {
+		fee, err := fees.feeFor(test.txType, test.amount)
+		if err != nil || fee != test.want {
+			t.Errorf("fee for %s of %s is %s (error: %v), want %s", test.txType, test.amount, fee, err, test.want)
+		}
+	}
+
+	invalid := []feeTable{
+		{Deposit: &feeTableRule{Flat: "-1"}},
+		{Withdrawal: &feeTableRule{Percent: "one"}},
+		{Withdrawal: &feeTableRule{Min: "5", Max: "1"}},
+		{Transfer: &feeTableRule{Tiers: []feeTableTier{{Flat: "1"}, {UpTo: "100", Flat: "2"}}}},
+		{Transfer: &feeTableRule{Tiers: []feeTableTier{{UpTo: "100"}, {UpTo: "50"}}}},
+	}
+	for _, table := range invalid {
+		if _, err := newFeeSchedule(table); err == nil {
+			t.Errorf("accepted invalid fee schedule %+v", table)
+		}
+	}
+}
+
+func TestFeesAreChargedOncePerRequest(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	bank.SetFeeSchedule(loadTestFees(t))
+
+	// a deposit that does not cover its fee is refused
+	if _, err := bank.Deposit(Cents(25), ""); err == nil {
+		t.Error("made a deposit that does not cover its fee")
+	}
+
+	depositID, err := bank.Deposit(Dollars(1000), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fee, charged := bank.GetTransactionFee(depositID)
+	if !charged || fee.Amount != Cents(25) || fee.FeeFor != depositID {
+		t.Errorf("fee for deposit is %+v, want 0.25 for %s", fee, depositID)
+	}
+
+	// a retried withdrawal is not charged again
+	withdrawalID, err := bank.Withdraw(Dollars(200), "withdrawal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retriedID, err := bank.Withdraw(Dollars(200), "withdrawal"); err != nil || retriedID != withdrawalID {
+		t.Errorf("retried withdrawal returned (%s, %v), want (%s, nil)", retriedID, err, withdrawalID)
+	}
+	if balance := bank.GetBalance(); balance != Cents(79775) {
+		t.Errorf("balance after withdrawal is %s, want 797.75", balance)
+	}
+
+	// a transfer is charged the transfer fee, and its key may not be
+	// reused for an ordinary withdrawal
+	transferID, err := bank.WithdrawForTransfer(DefaultAccountID, Dollars(500), "", "transfer", AnyVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fee, _ := bank.GetTransactionFee(transferID); fee.Amount != Cents(250) {
+		t.Errorf("fee for transfer is %s, want 2.50", fee.Amount)
+	}
+	var conflict IdempotencyConflictError
+	if _, err := bank.Withdraw(Dollars(500), "transfer"); !errors.As(err, &conflict) {
+		t.Errorf("withdrawal with the key of a transfer returned %v, want an IdempotencyConflictError", err)
+	}
+
+	// the balance must cover the withdrawal and its fee
+	var insufficientFunds InsufficientFundsError
+	if _, err := bank.Withdraw(Cents(29525), ""); !errors.As(err, &insufficientFunds) {
+		t.Errorf("withdrawal of the balance returned %v, want an InsufficientFundsError", err)
+	}
+	if balance := bank.GetBalance(); balance != Cents(29525) {
+		t.Errorf("balance after transfer is %s, want 295.25", balance)
+	}
+	checkLedger(t, bank)
+}
+
+func TestCaptureIsChargedWithdrawalFee(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	bank.SetFeeSchedule(loadTestFees(t))
+	if _, err := bank.Deposit(Dollars(100), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// the fee is not reserved by the hold, so a hold on the whole
+	// balance cannot be captured
+	holdID, err := bank.AuthorizeHold(DefaultAccountID, Cents(9975), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var insufficientFunds InsufficientFundsError
+	if _, err := bank.CaptureHold(holdID, 0, ""); !errors.As(err, &insufficientFunds) {
+		t.Errorf("capture without funds for its fee returned %v, want an InsufficientFundsError", err)
+	}
+	if err := bank.ReleaseHold(holdID); err != nil {
+		t.Fatal(err)
+	}
+
+	// a retried capture is not charged again
+	holdID, err = bank.AuthorizeHold(DefaultAccountID, Dollars(50), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	captureID, err := bank.CaptureHold(holdID, Dollars(30), "capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retriedID, err := bank.CaptureHold(holdID, Dollars(30), "capture"); err != nil || retriedID != captureID {
+		t.Errorf("retried capture returned (%s, %v), want (%s, nil)", retriedID, err, captureID)
+	}
+	if fee, _ := bank.GetTransactionFee(captureID); fee.Amount != Cents(50) {
+		t.Errorf("fee for capture is %s, want 0.50", fee.Amount)
+	}
+	if balance := bank.GetBalance(); balance != Cents(6925) {
+		t.Errorf("balance after capture is %s, want 69.25", balance)
+	}
+
+	// the client reads the ID from a response that includes the fee
+	client, _ := newTestClient(t, bank)
+	holdID, err = bank.AuthorizeHold(DefaultAccountID, Dollars(10), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txID, err := client.CaptureHold(holdID, 0, ""); err != nil || !strings.HasPrefix(txID, "C") || strings.Contains(txID, " ") {
+		t.Errorf("client capture returned (%s, %v), want a capture ID", txID, err)
+	}
+	checkLedger(t, bank)
+}
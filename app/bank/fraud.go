@@ -0,0 +1,399 @@
+package banking
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// how often a bank that is watching a file of fraud rules checks whether
+// the file has changed
+const fraudRulesCheckInterval = 2 * time.Second
+
+// FraudRules are the rules that a Bank evaluates before it makes a
+// deposit or withdrawal. The rules are evaluated in order, and the first
+// whose conditions match the transaction decides its outcome: it is
+// approved, declined with a FraudSuspectedError, or held in the review
+// queue (see ListReviews) with a PendingReviewError. A transaction that
+// matches no rule is approved. Amounts in the rules are in the currency
+// of the account, and withdrawals include those that begin a transfer.
+type FraudRules struct {
+	rules []fraudRule
+}
+
+// fraudAction is the outcome of a transaction that matches a rule
+type fraudAction string
+
+const (
+	fraudApprove fraudAction = "APPROVE"
+	fraudDecline fraudAction = "DECLINE"
+	fraudReview  fraudAction = "REVIEW"
+)
+
+// the kinds of fraud rule, each of which matches transactions whose
+// amount is above the rule's minimum and, for all but fraudAmount, meet
+// a further condition
+const (
+	fraudAmount      = "amount"       // no further condition
+	fraudVelocity    = "velocity"     // more than count of its type within the window
+	fraudNewAccount  = "new-account"  // to or from an account opened within accountAge
+	fraudRoundAmount = "round-amount" // a multiple of multipleOf
+)
+
+// fraudRule is a single rule, which applies only to the types of
+// transaction and accounts that it lists, or to all if it lists none
+type fraudRule struct {
+	name         string
+	kind         string
+	action       fraudAction
+	transactions map[TransactionType]bool
+	accounts     map[string]bool
+	above        Money
+	count        int
+	window       time.Duration
+	accountAge   time.Duration
+	multipleOf   Money
+}
+
+// fraudRuleTable is the format of a file of fraud rules, such as:
+//
+//	{
+//	  "rules": [
+//	    { "name": "payroll", "type": "amount", "accounts": ["payroll"], "action": "approve" },
+//	    { "name": "rapid-withdrawals", "type": "velocity", "transactions": ["withdrawal"],
+//	      "count": 3, "window": "10m", "action": "decline" },
+//	    { "name": "large-new-account", "type": "new-account", "above": "1000",
+//	      "accountAge": "7d", "action": "review" },
+//	    { "name": "round-amounts", "type": "round-amount", "multipleOf": "1000", "action": "review" }
+//	  ]
+//	}
+//
+// Durations are a number of days (such as "7d") or a Go duration (such
+// as "10m"), as for ParseScheduleInterval.
+type fraudRuleTable struct {
+	Rules []fraudTableRule `json:"rules"`
+}
+
+type fraudTableRule struct {
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	Action       string   `json:"action"`
+	Transactions []string `json:"transactions"` // "deposit" or "withdrawal"
+	Accounts     []string `json:"accounts"`
+	Above        string   `json:"above"`
+	Count        int      `json:"count"`
+	Window       string   `json:"window"`
+	AccountAge   string   `json:"accountAge"`
+	MultipleOf   string   `json:"multipleOf"`
+}
+
+// LoadFraudRules returns the FraudRules read from the specified JSON
+// file. It returns an error if the file could not be read or contains
+// an invalid rule.
+func LoadFraudRules(path string) (*FraudRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var table fraudRuleTable
+	err = json.Unmarshal(data, &table)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse fraud rule file '%s': %w", path, err)
+	}
+
+	return newFraudRules(table)
+}
+
+func newFraudRules(table fraudRuleTable) (*FraudRules, error) {
+	names := make(map[string]bool)
+	rules := FraudRules{}
+	for i, tableRule := range table.Rules {
+		rule, err := parseFraudRule(tableRule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fraud rule %d: %w", i+1, err)
+		}
+
+		if names[rule.name] {
+			return nil, fmt.Errorf("invalid fraud rule %d: duplicate name '%s'", i+1, rule.name)
+		}
+		names[rule.name] = true
+		rules.rules = append(rules.rules, rule)
+	}
+
+	return &rules, nil
+}
+
+func parseFraudRule(tableRule fraudTableRule) (fraudRule, error) {
+	rule := fraudRule{
+		name:   strings.TrimSpace(tableRule.Name),
+		kind:   tableRule.Type,
+		action: fraudAction(strings.ToUpper(tableRule.Action)),
+	}
+
+	if rule.name == "" {
+		return fraudRule{}, fmt.Errorf("a name is required")
+	}
+
+	switch rule.action {
+	case fraudApprove, fraudDecline, fraudReview:
+	default:
+		return fraudRule{}, fmt.Errorf("invalid action: '%s' (must be approve, decline, or review)", tableRule.Action)
+	}
+
+	for _, name := range tableRule.Transactions {
+		txType := TransactionType(strings.ToUpper(name))
+		if txType != TransactionDeposit && txType != TransactionWithdrawal {
+			return fraudRule{}, fmt.Errorf("invalid transaction type: '%s' (must be deposit or withdrawal)", name)
+		}
+		if rule.transactions == nil {
+			rule.transactions = make(map[TransactionType]bool)
+		}
+		rule.transactions[txType] = true
+	}
+
+	for _, accountID := range tableRule.Accounts {
+		if rule.accounts == nil {
+			rule.accounts = make(map[string]bool)
+		}
+		rule.accounts[accountID] = true
+	}
+
+	var err error
+	if rule.above, err = parseFeeAmount(tableRule.Above); err != nil {
+		return fraudRule{}, err
+	}
+
+	switch rule.kind {
+	case fraudAmount:
+	case fraudVelocity:
+		if tableRule.Count < 0 {
+			return fraudRule{}, fmt.Errorf("invalid count: %d", tableRule.Count)
+		}
+		rule.count = tableRule.Count
+		if rule.window, err = ParseScheduleInterval(tableRule.Window); err != nil {
+			return fraudRule{}, err
+		}
+	case fraudNewAccount:
+		if rule.accountAge, err = ParseScheduleInterval(tableRule.AccountAge); err != nil {
+			return fraudRule{}, err
+		}
+	case fraudRoundAmount:
+		if rule.multipleOf, err = parseFeeAmount(tableRule.MultipleOf); err != nil {
+			return fraudRule{}, err
+		}
+		if rule.multipleOf == 0 {
+			return fraudRule{}, fmt.Errorf("a round-amount rule must have a multipleOf amount")
+		}
+	default:
+		return fraudRule{}, fmt.Errorf("invalid type: '%s' (must be %s, %s, %s, or %s)",
+			tableRule.Type, fraudAmount, fraudVelocity, fraudNewAccount, fraudRoundAmount)
+	}
+
+	return rule, nil
+}
+
+// Describes the condition under which the rule matches a transaction of
+// the specified type
+func (rule *fraudRule) describe(txType TransactionType) string {
+	var condition string
+	switch rule.kind {
+	case fraudVelocity:
+		condition = fmt.Sprintf("more than %d %ss within %s", rule.count, strings.ToLower(string(txType)), rule.window)
+	case fraudNewAccount:
+		condition = fmt.Sprintf("account opened within %s", rule.accountAge)
+	case fraudRoundAmount:
+		condition = fmt.Sprintf("amount is a multiple of %s", rule.multipleOf)
+	}
+
+	if rule.above == 0 {
+		if condition == "" {
+			return "any amount"
+		}
+		return condition
+	}
+
+	if condition == "" {
+		return fmt.Sprintf("amount above %s", rule.above)
+	}
+	return fmt.Sprintf("%s, and amount above %s", condition, rule.above)
+}
+
+// Reports whether the rule matches a deposit to or withdrawal from the
+// account (as given by the type) of the specified amount, in the
+// account's currency. The caller must hold lock.
+func (bank *Bank) fraudRuleMatches(rule *fraudRule, acct *account, txType TransactionType, amount Money, now time.Time) bool {
+	if rule.transactions != nil && !rule.transactions[txType] {
+		return false
+	}
+
+	if rule.accounts != nil && !rule.accounts[acct.ID] {
+		return false
+	}
+
+	if amount <= rule.above {
+		return false
+	}
+
+	switch rule.kind {
+	case fraudVelocity:
+		// this transaction would make one more than those already posted
+		return bank.countRecentTransactions(acct.ID, txType, now.Add(-rule.window)) >= rule.count
+	case fraudNewAccount:
+		// accounts opened before the time was recorded are not new
+		return !acct.Opened.IsZero() && now.Sub(acct.Opened) < rule.accountAge
+	case fraudRoundAmount:
+		return amount%rule.multipleOf == 0
+	}
+
+	return true
+}
+
+// Returns the number of transactions of the specified type that have
+// been posted to the account since the specified time
+func (bank *Bank) countRecentTransactions(accountID string, txType TransactionType, since time.Time) int {
+	bank.ledgerLock.Lock()
+	defer bank.ledgerLock.Unlock()
+
+	count := 0
+	for i := len(bank.ledger) - 1; i >= 0 && !bank.ledger[i].Timestamp.Before(since); i-- {
+		if entry := bank.ledger[i]; entry.AccountID == accountID && entry.Type == txType {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Evaluates the fraud rules for the deposit, withdrawal or hold described
+// by the request, whose amount in the account's currency is given, and
+// returns nil if it is approved. Otherwise, this returns a
+// FraudSuspectedError if it is declined, or queues it for review and
+// returns a PendingReviewError. The caller must hold lock exclusively.
+func (bank *Bank) screenTransaction(acct *account, request Review, amount Money) error {
+	if bank.fraudRules == nil {
+		return nil
+	}
+
+	// the rules treat a transfer as the withdrawal that it begins with,
+	// and a hold as the withdrawal that capturing it makes
+	txType := request.Type
+	if txType == transferRequest || txType == holdRequest {
+		txType = TransactionWithdrawal
+	}
+
+	now := bank.now()
+	for i := range bank.fraudRules.rules {
+		rule := &bank.fraudRules.rules[i]
+		if !bank.fraudRuleMatches(rule, acct, txType, amount, now) {
+			continue
+		}
+
+		request.Rule = rule.name
+		request.Reason = rule.describe(txType)
+		switch rule.action {
+		case fraudDecline:
+			msg := fmt.Sprintf("%s of %s %s for account '%s' was declined by fraud rule '%s' (%s)",
+				strings.ToLower(string(request.Type)), amount, acct.Currency, acct.ID, rule.name, request.Reason)
+			log.Printf("Fraud check at '%s' bank: %s", bank.name, msg)
+			return FraudSuspectedError{message: msg, rule: rule.name}
+		case fraudReview:
+			return bank.queueForReview(acct, request, amount)
+		}
+
+		return nil
+	}
+
+	return nil
+}
+
+// SetFraudRules replaces the rules evaluated before each deposit and
+// withdrawal; nil rules approve every transaction, which is the default.
+// If the bank is watching a file of rules (see WatchFraudRules), these
+// are replaced when the file next changes.
+func (bank *Bank) SetFraudRules(rules *FraudRules) {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	bank.fraudRules = rules
+}
+
+// WatchFraudRules loads the fraud rules from the specified file, as for
+// LoadFraudRules, and then reloads them whenever the file changes, until
+// the bank is closed, so that the rules can be changed without restarting
+// the service. If the changed file is invalid, the error is logged and
+// the previous rules remain in effect. This returns an error if the rules
+// could not be loaded initially.
+func (bank *Bank) WatchFraudRules(path string) error {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	previousPath := bank.fraudRulesPath
+	bank.fraudRulesPath = path
+	if _, err := bank.reloadFraudRules(); err != nil {
+		bank.fraudRulesPath = previousPath
+		return err
+	}
+
+	if bank.fraudRulesTask == nil {
+		bank.fraudRulesTask = startBackgroundTask(fraudRulesCheckInterval, bank.reloadChangedFraudRules)
+	}
+
+	return nil
+}
+
+// ReloadFraudRules reloads the fraud rules from the file that the bank
+// is watching immediately, rather than when it next checks whether the
+// file has changed, and returns the number of rules. It returns an error
+// if the bank is not watching a file or the file is invalid, in which
+// case the previous rules remain in effect.
+func (bank *Bank) ReloadFraudRules() (int, error) {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	if bank.fraudRulesPath == "" {
+		return 0, fmt.Errorf("'%s' bank is not loading fraud rules from a file", bank.name)
+	}
+
+	return bank.reloadFraudRules()
+}
+
+// Reloads the rules from the watched file if it has been modified since
+// they were last loaded
+func (bank *Bank) reloadChangedFraudRules() {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	info, err := os.Stat(bank.fraudRulesPath)
+	if err != nil || info.ModTime().Equal(bank.fraudRulesModTime) {
+		return
+	}
+
+	if _, err := bank.reloadFraudRules(); err != nil {
+		log.Printf("ERROR: could not reload fraud rules for '%s' bank, keeping the previous rules: %v\n", bank.name, err)
+	}
+}
+
+// Loads the rules from the watched file and returns how many there are.
+// The file's modification time is recorded even if it is invalid, so
+// that the error is only reported once for each change. The caller must
+// hold lock exclusively.
+func (bank *Bank) reloadFraudRules() (int, error) {
+	info, err := os.Stat(bank.fraudRulesPath)
+	if err != nil {
+		return 0, err
+	}
+	bank.fraudRulesModTime = info.ModTime()
+
+	rules, err := LoadFraudRules(bank.fraudRulesPath)
+	if err != nil {
+		return 0, err
+	}
+	bank.fraudRules = rules
+
+	log.Printf("Loaded %d fraud rules for '%s' bank from '%s'", len(rules.rules), bank.name, bank.fraudRulesPath)
+	return len(rules.rules), nil
+}
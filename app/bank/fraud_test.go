@@ -0,0 +1,374 @@
+package banking
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+const testFraudRuleFile = `{
+  "rules": [
+    { "name": "trusted", "type": "amount", "accounts": ["payroll"], "action": "approve" },
+    { "name": "rapid-withdrawals", "type": "velocity", "transactions": ["withdrawal"],
+      "count": 2, "window": "10m", "action": "decline" },
+    { "name": "large-new-account", "type": "new-account", "above": "1000", "accountAge": "7d", "action": "review" },
+    { "name": "round-amounts", "type": "round-amount", "multipleOf": "500", "above": "1000", "action": "review" }
+  ]
+}`
+
+// Returns the rules in the table, failing the test if they are invalid
+func newTestFraudRules(t *testing.T, rules ...fraudTableRule) *FraudRules {
+	t.Helper()
+	fraudRules, err := newFraudRules(fraudRuleTable{Rules: rules})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fraudRules
+}
+
+func TestFraudRulesDecideOutcome(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	clock := &fakeClock{now: time.Date(2026, time.May, 4, 9, 0, 0, 0, time.UTC)}
+	bank.SetClock(clock)
+	for _, accountID := range []string{"savings", "payroll"} {
+		if err := bank.OpenAccount(accountID, DefaultCurrency); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "fraud.json")
+	if err := os.WriteFile(path, []byte(testFraudRuleFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := bank.WatchFraudRules(path); err != nil {
+		t.Fatal(err)
+	}
+
+	deposit := func(accountID string, amount Money) error {
+		_, err := bank.DepositToAccount(accountID, amount, "", "", AnyVersion)
+		return err
+	}
+
+	// a large deposit to a new account is held, unless the account is trusted
+	var pending PendingReviewError
+	if err := deposit("savings", Dollars(1500)); !errors.As(err, &pending) || pending.ReviewID() == "" {
+		t.Errorf("large deposit to new account returned %v, want a PendingReviewError", err)
+	}
+	if err := deposit("payroll", Dollars(1500)); err != nil {
+		t.Errorf("large deposit to trusted account failed: %v", err)
+	}
+	if err := deposit("savings", Dollars(800)); err != nil {
+		t.Errorf("small deposit to new account failed: %v", err)
+	}
+
+	// once the account is a week old, only round amounts are held
+	clock.Advance(8 * 24 * time.Hour)
+	if err := deposit("savings", Dollars(1500)); !errors.As(err, &pending) {
+		t.Errorf("round deposit returned %v, want a PendingReviewError", err)
+	}
+	if review, err := bank.GetReview(pending.ReviewID()); err != nil || review.Rule != "round-amounts" {
+		t.Errorf("review of round deposit is %+v (error: %v), want one held by round-amounts", review, err)
+	}
+	if err := deposit("savings", Cents(123456)); err != nil {
+		t.Errorf("deposit of an amount that is not round failed: %v", err)
+	}
+
+	// a third withdrawal within ten minutes is declined
+	for i := 0; i < 2; i++ {
+		if _, err := bank.WithdrawFromAccount("savings", Dollars(10), "", "", AnyVersion); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var suspected FraudSuspectedError
+	_, err := bank.WithdrawFromAccount("savings", Dollars(10), "", "", AnyVersion)
+	if !errors.As(err, &suspected) || suspected.Rule() != "rapid-withdrawals" {
+		t.Errorf("third withdrawal returned %v, want a FraudSuspectedError for rapid-withdrawals", err)
+	}
+	clock.Advance(11 * time.Minute)
+	if _, err := bank.WithdrawFromAccount("savings", Dollars(10), "", "", AnyVersion); err != nil {
+		t.Errorf("withdrawal after the window failed: %v", err)
+	}
+
+	// changed rules are loaded without a restart, but an invalid file
+	// leaves the previous rules in effect
+	if err := os.WriteFile(path, []byte(`{"rules": []}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	bank.reloadChangedFraudRules()
+	if err := deposit("savings", Dollars(2000)); err != nil {
+		t.Errorf("deposit after the rules were removed failed: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"rules": [{"name": "broken"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bank.ReloadFraudRules(); err == nil {
+		t.Error("reloaded an invalid rule file")
+	}
+	if err := deposit("savings", Dollars(2500)); err != nil {
+		t.Errorf("deposit after an invalid reload failed: %v", err)
+	}
+
+	invalid := []fraudTableRule{
+		{Type: fraudAmount, Action: "approve"},
+		{Name: "no-action", Type: fraudAmount},
+		{Name: "no-window", Type: fraudVelocity, Count: 3, Action: "decline"},
+		{Name: "no-multiple", Type: fraudRoundAmount, Action: "review"},
+		{Name: "bad-type", Type: fraudAmount, Transactions: []string{"capture"}, Action: "review"},
+		{Name: "unknown", Type: "weekend", Action: "review"},
+	}
+	for _, rule := range invalid {
+		if _, err := newFraudRules(fraudRuleTable{Rules: []fraudTableRule{rule}}); err == nil {
+			t.Errorf("accepted invalid fraud rule %+v", rule)
+		}
+	}
+	checkLedger(t, bank)
+}
+
+func TestReviewQueue(t *testing.T) {
+	discardLogOutput(t)
+	path := filepath.Join(t.TempDir(), "bank-test.dat")
+
+	bank := NewBankWithStorage("test", NewFileStorage(path))
+	bank.SetFraudRules(newTestFraudRules(t, fraudTableRule{
+		Name: "round-amounts", Type: fraudRoundAmount, MultipleOf: "100", Action: "review",
+	}))
+
+	// a held request returns the same review when it is retried
+	var pending PendingReviewError
+	if _, err := bank.Deposit(Dollars(1000), "big-deposit"); !errors.As(err, &pending) {
+		t.Fatalf("round deposit returned %v, want a PendingReviewError", err)
+	}
+	depositReview := pending.ReviewID()
+	if _, err := bank.Deposit(Dollars(1000), "big-deposit"); !errors.As(err, &pending) || pending.ReviewID() != depositReview {
+		t.Errorf("retried deposit returned %v, want a PendingReviewError for %s", err, depositReview)
+	}
+	var conflict IdempotencyConflictError
+	if _, err := bank.Deposit(Dollars(900), "big-deposit"); !errors.As(err, &conflict) {
+		t.Errorf("deposit with the key of a held request returned %v, want an IdempotencyConflictError", err)
+	}
+	if balance := bank.GetBalance(); balance != 0 {
+		t.Errorf("balance with deposit held is %s, want 0.00", balance)
+	}
+
+	// once approved, the deposit is made, and retrying it returns its ID
+	depositID, err := bank.ApproveReview(depositReview, "verified with the customer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txID, err := bank.Deposit(Dollars(1000), "big-deposit"); err != nil || txID != depositID {
+		t.Errorf("retried deposit returned (%s, %v), want (%s, nil)", txID, err, depositID)
+	}
+	if _, err := bank.ApproveReview(depositReview, ""); err == nil {
+		t.Error("approved a review twice")
+	}
+
+	// a declined request is never made
+	if _, err := bank.Withdraw(Dollars(500), "declined-withdrawal"); !errors.As(err, &pending) {
+		t.Fatalf("round withdrawal returned %v, want a PendingReviewError", err)
+	}
+	if err := bank.DeclineReview(pending.ReviewID(), "not the customer"); err != nil {
+		t.Fatal(err)
+	}
+	var suspected FraudSuspectedError
+	if _, err := bank.Withdraw(Dollars(500), "declined-withdrawal"); !errors.As(err, &suspected) {
+		t.Errorf("retried withdrawal returned %v, want a FraudSuspectedError", err)
+	}
+
+	// the queue is kept across sessions, without the rules
+	for _, amount := range []Money{Dollars(700), Dollars(200)} {
+		if _, err := bank.Withdraw(amount, ""); !errors.As(err, &pending) {
+			t.Fatalf("round withdrawal returned %v, want a PendingReviewError", err)
+		}
+	}
+	if err := bank.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bank = NewBankWithStorage("test", NewFileStorage(path))
+	t.Cleanup(func() { bank.Close() })
+
+	held := bank.ListReviews(ReviewPending)
+	if len(held) != 2 || held[0].Amount != Dollars(700) || held[1].Amount != Dollars(200) {
+		t.Fatalf("pending reviews after restart are %+v, want withdrawals of 700.00 and 200.00", held)
+	}
+	if _, err := bank.Withdraw(Dollars(750), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// a held withdrawal that can no longer be made stays pending
+	var insufficientFunds InsufficientFundsError
+	if _, err := bank.ApproveReview(held[0].ID, ""); !errors.As(err, &insufficientFunds) {
+		t.Errorf("approving withdrawal of more than the balance returned %v, want an InsufficientFundsError", err)
+	}
+	if review, err := bank.GetReview(held[0].ID); err != nil || review.Status != ReviewPending {
+		t.Errorf("review after failed approval is %+v (error: %v), want it pending", review, err)
+	}
+	if _, err := bank.ApproveReview(held[1].ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if balance := bank.GetBalance(); balance != Dollars(50) {
+		t.Errorf("balance after approvals is %s, want 50.00", balance)
+	}
+
+	var notFound ReviewNotFoundError
+	if err := bank.DeclineReview("V0000000000", ""); !errors.As(err, &notFound) {
+		t.Errorf("declining unknown review returned %v, want a ReviewNotFoundError", err)
+	}
+	if reviews := bank.ListReviews(""); len(reviews) != 4 {
+		t.Errorf("bank has %d reviews, want 4", len(reviews))
+	}
+	checkLedger(t, bank)
+}
+
+func TestHoldsAreScreenedAsWithdrawals(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	if _, err := bank.Deposit(Dollars(2000), ""); err != nil {
+		t.Fatal(err)
+	}
+	bank.SetFraudRules(newTestFraudRules(t,
+		fraudTableRule{Name: "large-withdrawals", Type: fraudAmount, Transactions: []string{"withdrawal"}, Above: "1000", Action: "decline"},
+		fraudTableRule{Name: "round-amounts", Type: fraudRoundAmount, MultipleOf: "100", Action: "review"},
+	))
+
+	var suspected FraudSuspectedError
+	if _, err := bank.AuthorizeHold(DefaultAccountID, Dollars(1500), ""); !errors.As(err, &suspected) {
+		t.Errorf("large hold returned %v, want a FraudSuspectedError", err)
+	}
+
+	// a held hold is placed once approved, and retrying the request
+	// returns it
+	var pending PendingReviewError
+	if _, err := bank.AuthorizeHold(DefaultAccountID, Dollars(300), "round-hold"); !errors.As(err, &pending) {
+		t.Fatalf("round hold returned %v, want a PendingReviewError", err)
+	}
+	if available, _ := bank.GetAvailableBalance(DefaultAccountID); available != Dollars(2000) {
+		t.Errorf("available balance with hold under review is %s, want 2000.00", available)
+	}
+	holdID, err := bank.ApproveReview(pending.ReviewID(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retriedID, err := bank.AuthorizeHold(DefaultAccountID, Dollars(300), "round-hold"); err != nil || retriedID != holdID {
+		t.Errorf("retried hold returned (%s, %v), want (%s, nil)", retriedID, err, holdID)
+	}
+	if available, _ := bank.GetAvailableBalance(DefaultAccountID); available != Dollars(1700) {
+		t.Errorf("available balance after approval is %s, want 1700.00", available)
+	}
+
+	// the capture is not screened again
+	if _, err := bank.CaptureHold(holdID, 0, ""); err != nil {
+		t.Errorf("capture of approved hold failed: %v", err)
+	}
+	if balance := bank.GetBalance(); balance != Dollars(1700) {
+		t.Errorf("balance after capture is %s, want 1700.00", balance)
+	}
+	checkLedger(t, bank)
+}
+
+func TestApprovalIsRecordedAfterReload(t *testing.T) {
+	discardLogOutput(t)
+	path := filepath.Join(t.TempDir(), "bank-test.dat")
+
+	bank := NewBankWithStorage("test", NewFileStorage(path))
+	bank.SetFraudRules(newTestFraudRules(t, fraudTableRule{
+		Name: "round-amounts", Type: fraudRoundAmount, MultipleOf: "100", Action: "review",
+	}))
+	var pending PendingReviewError
+	if _, err := bank.Deposit(Dollars(100), "held-deposit"); !errors.As(err, &pending) {
+		t.Fatalf("round deposit returned %v, want a PendingReviewError", err)
+	}
+	if err := bank.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	storage := &blockingStorage{
+		failingStorage: failingStorage{Storage: NewFileStorage(path)},
+		blocked:        make(chan struct{}),
+		release:        make(chan struct{}),
+	}
+	bank = NewBankWithStorage("test", storage)
+	t.Cleanup(func() { bank.Close() })
+	bank.SetSnapshotInterval(0)
+	bank.SetGroupCommit(false)
+
+	// the deposit made by the approval waits to be written, and a change
+	// queued behind it cannot be
+	approved := make(chan error, 1)
+	var txID string
+	go func() {
+		var err error
+		txID, err = bank.ApproveReview(pending.ReviewID(), "")
+		approved <- err
+	}()
+	<-storage.blocked
+	storage.failures.Store(1)
+	failed := make(chan error, 1)
+	go func() {
+		_, err := bank.Deposit(Dollars(5), "")
+		failed <- err
+	}()
+	for queued := false; !queued; runtime.Gosched() {
+		bank.walLock.Lock()
+		queued = len(bank.pending) > 0
+		bank.walLock.Unlock()
+	}
+
+	// the data is reloaded once the failure is known, before the
+	// approval continues
+	bank.lock.Lock()
+	close(storage.release)
+	for logFailed := false; !logFailed; runtime.Gosched() {
+		bank.walLock.Lock()
+		logFailed = bank.logFailed
+		bank.walLock.Unlock()
+	}
+	bank.recoverFromLogFailure()
+	bank.lock.Unlock()
+
+	if err := <-approved; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-failed; err == nil {
+		t.Error("deposit that could not be written succeeded")
+	}
+	if review, err := bank.GetReview(pending.ReviewID()); err != nil || review.Status != ReviewApproved || review.TransactionID != txID {
+		t.Errorf("review after approval is %+v (error: %v), want it approved with transaction %s", review, err, txID)
+	}
+	if balance := bank.GetBalance(); balance != Dollars(100) {
+		t.Errorf("balance after approval is %s, want 100.00", balance)
+	}
+	checkLedger(t, bank)
+}
+
+func TestClientReturnsFraudErrors(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	bank.SetFraudRules(newTestFraudRules(t,
+		fraudTableRule{Name: "large-deposits", Type: fraudAmount, Transactions: []string{"deposit"}, Above: "1000", Action: "review"},
+		fraudTableRule{Name: "no-withdrawals", Type: fraudAmount, Transactions: []string{"withdrawal"}, Action: "decline"},
+	))
+	client, _ := newTestClient(t, bank)
+
+	var pending PendingReviewError
+	if _, err := client.Deposit(Dollars(5000), "large"); !errors.As(err, &pending) {
+		t.Fatalf("large deposit returned %v, want a PendingReviewError", err)
+	}
+	if held := bank.ListReviews(ReviewPending); len(held) != 1 || held[0].ID != pending.ReviewID() {
+		t.Errorf("pending reviews are %+v, want only %s", held, pending.ReviewID())
+	}
+
+	if _, err := client.Deposit(Dollars(100), ""); err != nil {
+		t.Fatal(err)
+	}
+	var suspected FraudSuspectedError
+	if _, err := client.Withdraw(Dollars(10), ""); !errors.As(err, &suspected) || suspected.Rule() != "no-withdrawals" {
+		t.Errorf("withdrawal returned %v, want a FraudSuspectedError for no-withdrawals", err)
+	}
+}
@@ -0,0 +1,260 @@
+package banking
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// DefaultCurrency is the currency of accounts that are opened without
+// specifying one, including the default account.
+const DefaultCurrency = "USD"
+
+// ExchangeRateProvider supplies the rates that a Bank uses to convert
+// amounts given in one currency into the currency of an account.
+type ExchangeRateProvider interface {
+	// GetRate returns the rate for converting amounts from one currency
+	// to another, or an error if no such rate is available.
+	GetRate(from string, to string) (ExchangeRate, error)
+}
+
+// ExchangeRate describes how an amount is converted from one currency
+// to another: the amount is multiplied by Rate, and a fee of FeeRate
+// (a fraction, such as 0.005 for 0.5%) of the converted amount is
+// charged for the conversion.
+type ExchangeRate struct {
+	From    string
+	To      string
+	Rate    *big.Rat
+	FeeRate *big.Rat
+}
+
+// StaticRateProvider is an ExchangeRateProvider backed by a fixed table
+// of rates. A rate defined for one direction (such as EUR/USD) is also
+// used, inverted, for the other direction unless that is defined too.
+type StaticRateProvider struct {
+	rates   map[string]*big.Rat // "FROM/TO" => rate
+	feeRate *big.Rat
+}
+
+// staticRateTable is the format of a file of exchange rates, such as:
+//
+//	{
+//	  "feePercent": "0.5",
+//	  "rates": { "EUR/USD": "1.0850", "GBP/USD": "1.2700" }
+//	}
+type staticRateTable struct {
+	FeePercent string            `json:"feePercent"`
+	Rates      map[string]string `json:"rates"`
+}
+
+// rates used when the service is not given a table of its own
+var defaultRateTable = staticRateTable{
+	FeePercent: "0.5",
+	Rates: map[string]string{
+		"EUR/USD": "1.0850",
+		"GBP/USD": "1.2700",
+		"CAD/USD": "0.7300",
+		"MXN/USD": "0.0550",
+	},
+}
+
+// NewStaticRateProvider returns a StaticRateProvider with a small
+// built-in table of rates, suitable for demonstrations.
+func NewStaticRateProvider() *StaticRateProvider {
+	provider, err := newStaticRateProvider(defaultRateTable)
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in exchange rate table: %v", err))
+	}
+
+	return provider
+}
+
+// LoadStaticRateProvider returns a StaticRateProvider with the rates
+// read from the specified JSON file. It returns an error if the file
+// could not be read or contains an invalid rate.
+func LoadStaticRateProvider(path string) (*StaticRateProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var table staticRateTable
+	err = json.Unmarshal(data, &table)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse exchange rate file '%s': %w", path, err)
+	}
+
+	return newStaticRateProvider(table)
+}
+
+func newStaticRateProvider(table staticRateTable) (*StaticRateProvider, error) {
+	provider := StaticRateProvider{
+		rates:   make(map[string]*big.Rat),
+		feeRate: new(big.Rat),
+	}
+
+	if table.FeePercent != "" {
+		feePercent, ok := new(big.Rat).SetString(table.FeePercent)
+		if !ok || feePercent.Sign() < 0 {
+			return nil, fmt.Errorf("invalid fee percentage: '%s'", table.FeePercent)
+		}
+		provider.feeRate.Quo(feePercent, big.NewRat(100, 1))
+	}
+
+	for pair, value := range table.Rates {
+		from, to, found := strings.Cut(pair, "/")
+		if !found || !isValidCurrency(from) || !isValidCurrency(to) {
+			return nil, fmt.Errorf("invalid currency pair: '%s'", pair)
+		}
+
+		rate, ok := new(big.Rat).SetString(value)
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid rate for %s: '%s'", pair, value)
+		}
+
+		provider.rates[strings.ToUpper(pair)] = rate
+	}
+
+	return &provider, nil
+}
+
+// GetRate returns the rate for converting amounts from one currency
+// to another, or an error if the table has no rate for either
+// direction between the two currencies.
+func (provider *StaticRateProvider) GetRate(from string, to string) (ExchangeRate, error) {
+	exchangeRate := ExchangeRate{From: from, To: to, FeeRate: provider.feeRate}
+
+	if rate, found := provider.rates[from+"/"+to]; found {
+		exchangeRate.Rate = rate
+		return exchangeRate, nil
+	}
+
+	if inverse, found := provider.rates[to+"/"+from]; found {
+		exchangeRate.Rate = new(big.Rat).Inv(inverse)
+		return exchangeRate, nil
+	}
+
+	return exchangeRate, fmt.Errorf("no exchange rate available from %s to %s", from, to)
+}
+
+// conversion records how an amount given in a foreign currency was
+// converted into the currency of an account.
+type conversion struct {
+	OriginalAmount   Money
+	OriginalCurrency string
+	Rate             string
+	Converted        Money // before the fee is applied
+	Fee              Money
+}
+
+// Converts the amount using the exchange rate, rounding the converted
+// amount and the fee to the nearest cent. It returns an error if the
+// result is too large to be represented.
+func convert(amount Money, exchangeRate ExchangeRate) (conversion, error) {
+	converted, err := multiply(amount, exchangeRate.Rate)
+	if err != nil {
+		return conversion{}, err
+	}
+
+	fee, err := multiply(converted, exchangeRate.FeeRate)
+	if err != nil {
+		return conversion{}, err
+	}
+
+	result := conversion{
+		OriginalAmount:   amount,
+		OriginalCurrency: exchangeRate.From,
+		Rate:             exchangeRate.Rate.FloatString(6),
+		Converted:        converted,
+		Fee:              fee,
+	}
+
+	return result, nil
+}
+
+// Multiplies the amount by the factor, rounding half away from zero
+// to the nearest cent
+func multiply(amount Money, factor *big.Rat) (Money, error) {
+	product := new(big.Rat).Mul(new(big.Rat).SetInt64(int64(amount)), factor)
+
+	// (2n + sign*d) / 2d, truncated, rounds n/d half away from zero
+	num := new(big.Int).Mul(product.Num(), big.NewInt(2))
+	den := new(big.Int).Mul(product.Denom(), big.NewInt(2))
+	if product.Sign() < 0 {
+		num.Sub(num, product.Denom())
+	} else {
+		num.Add(num, product.Denom())
+	}
+
+	cents := new(big.Int).Quo(num, den)
+	if !cents.IsInt64() {
+		return 0, fmt.Errorf("amount overflow: %s x %s", amount, factor.FloatString(6))
+	}
+
+	return Money(cents.Int64()), nil
+}
+
+// Converts an amount given in the specified currency into the currency
+// of the account. It returns nil if no conversion is needed because the
+// currency is empty or the same as that of the account.
+func (bank *Bank) convertForAccount(acct *account, amount Money, currency string) (*conversion, error) {
+	from := acct.foreignCurrency(currency)
+	if from == "" {
+		return nil, nil
+	}
+
+	if !isValidCurrency(from) {
+		return nil, fmt.Errorf("invalid currency: '%s'", currency)
+	}
+
+	exchangeRate, err := bank.rates.GetRate(from, acct.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := convert(amount, exchangeRate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Returns the currency code in upper case if it differs from that of
+// the account, or an empty string if it is the same (or empty)
+func (acct *account) foreignCurrency(currency string) string {
+	currency = strings.ToUpper(currency)
+	if currency == acct.Currency {
+		return ""
+	}
+
+	return currency
+}
+
+// Returns the currency code in upper case, or DefaultCurrency if the
+// code is empty
+func normalizeCurrency(currency string) string {
+	if currency == "" {
+		return DefaultCurrency
+	}
+
+	return strings.ToUpper(currency)
+}
+
+// Reports whether the value is a three-letter currency code, such as USD
+func isValidCurrency(currency string) bool {
+	if len(currency) != 3 {
+		return false
+	}
+
+	for _, c := range currency {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+
+	return true
+}
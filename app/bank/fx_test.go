@@ -0,0 +1,133 @@
+package banking
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestMultiplyRoundsHalfAwayFromZero(t *testing.T) {
+	tests := []struct {
+		amount Money
+		factor string
+		want   Money
+	}{
+		{Cents(1), "1/2", Cents(1)},
+		{Cents(-1), "1/2", Cents(-1)},
+		{Cents(5), "0.1", Cents(1)},
+		{Cents(-5), "0.1", Cents(-1)},
+		{Cents(4), "0.1", 0},
+		{Cents(-4), "0.1", 0},
+		{Cents(1), "1/3", 0},
+		{Cents(2), "1/3", Cents(1)},
+		{Dollars(100), "1.085", Cents(10850)},
+		{Cents(10850), "0.005", Cents(54)},
+		{Dollars(1), "0", 0},
+	}
+	for _, test := range tests {
+		factor, _ := new(big.Rat).SetString(test.factor)
+		if product, err := multiply(test.amount, factor); err != nil || product != test.want {
+			t.Errorf("%s x %s returned (%s, %v), want %s", test.amount, test.factor, product, err, test.want)
+		}
+	}
+
+	if product, err := multiply(MaxMoney, big.NewRat(2, 1)); err == nil {
+		t.Errorf("multiplying the largest amount by 2 returned %s, want an overflow error", product)
+	}
+}
+
+func TestConvertChargesFee(t *testing.T) {
+	rates := NewStaticRateProvider()
+	exchangeRate, err := rates.GetRate("EUR", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 100 EUR is 108.50 USD, and the fee of 0.5% (0.5425) is rounded
+	result, err := convert(Dollars(100), exchangeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := conversion{OriginalAmount: Dollars(100), OriginalCurrency: "EUR", Rate: "1.085000", Converted: Cents(10850), Fee: Cents(54)}
+	if result != want {
+		t.Errorf("conversion is %+v, want %+v", result, want)
+	}
+
+	// the rate for the other direction is the inverse
+	inverse, err := rates.GetRate("USD", "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err := convert(Cents(10850), inverse); err != nil || result.Converted != Dollars(100) {
+		t.Errorf("converting 108.50 USD to EUR returned (%+v, %v), want 100.00", result, err)
+	}
+
+	if _, err := rates.GetRate("JPY", "USD"); err == nil {
+		t.Error("returned a rate for a currency with none in the table")
+	}
+}
+
+func TestStaticRateProviderRejectsInvalidTable(t *testing.T) {
+	invalid := []staticRateTable{
+		{FeePercent: "-1"},
+		{FeePercent: "half"},
+		{Rates: map[string]string{"EURUSD": "1.08"}},
+		{Rates: map[string]string{"EURO/USD": "1.08"}},
+		{Rates: map[string]string{"EUR/USD": "0"}},
+		{Rates: map[string]string{"EUR/USD": "-1.08"}},
+		{Rates: map[string]string{"EUR/USD": "lots"}},
+	}
+	for _, table := range invalid {
+		if _, err := newStaticRateProvider(table); err == nil {
+			t.Errorf("accepted invalid rate table %+v", table)
+		}
+	}
+}
+
+func TestForeignCurrencyIsConverted(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	if err := bank.OpenAccount("euros", "eur"); err != nil {
+		t.Fatal(err)
+	}
+	if currency, err := bank.GetAccountCurrency("euros"); err != nil || currency != "EUR" {
+		t.Errorf("currency of euros account is %s (error: %v), want EUR", currency, err)
+	}
+
+	// the fee is deducted from a deposit, and added to a withdrawal
+	depositID, err := bank.DepositToAccount(DefaultAccountID, Dollars(100), "EUR", "", AnyVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance := bank.GetBalance(); balance != Cents(10796) {
+		t.Errorf("balance after depositing 100.00 EUR is %s, want 107.96", balance)
+	}
+	if _, err := bank.WithdrawFromAccount(DefaultAccountID, Dollars(10), "eur", "", AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	if balance := bank.GetBalance(); balance != Cents(9706) {
+		t.Errorf("balance after withdrawing 10.00 EUR is %s, want 97.06", balance)
+	}
+
+	entry, found := bank.findLedgerEntry(depositID)
+	if !found || entry.Amount != Cents(10796) || entry.OriginalAmount != Dollars(100) ||
+		entry.OriginalCurrency != "EUR" || entry.ExchangeRate != "1.085000" || entry.ConversionFee != Cents(54) {
+		t.Errorf("ledger entry for deposit is %+v, want the conversion of 100.00 EUR", entry)
+	}
+
+	// an amount in the account's own currency is not converted
+	if _, err := bank.DepositToAccount("euros", Dollars(5), "EUR", "", AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	if balance, _ := bank.GetAccountBalance("euros"); balance != Dollars(5) {
+		t.Errorf("balance of euros account is %s, want 5.00", balance)
+	}
+
+	for _, currency := range []string{"JPY", "EURO", "E1R"} {
+		if _, err := bank.DepositToAccount(DefaultAccountID, Dollars(1), currency, "", AnyVersion); err == nil {
+			t.Errorf("deposit in %s succeeded, want an error", currency)
+		}
+	}
+	if err := bank.OpenAccount("yen", "YEN1"); err == nil {
+		t.Error("opened an account with an invalid currency")
+	}
+	checkLedger(t, bank)
+}
@@ -0,0 +1,434 @@
+package banking
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// DefaultHoldExpiry is how long a hold remains active, unless the bank
+// is configured otherwise, before it expires and its funds are released.
+const DefaultHoldExpiry = 24 * time.Hour
+
+// identifies requests to place a hold in idempotency fingerprints; the
+// hold itself does not appear in the ledger until it is captured
+const holdRequest TransactionType = "HOLD"
+
+// HoldStatus identifies the state of a hold
+type HoldStatus string
+
+const (
+	// HoldActive means the funds are reserved and may be captured
+	HoldActive HoldStatus = "ACTIVE"
+	// HoldCaptured means the funds were withdrawn from the account
+	HoldCaptured HoldStatus = "CAPTURED"
+	// HoldReleased means the reservation was cancelled
+	HoldReleased HoldStatus = "RELEASED"
+	// HoldExpired means the reservation lapsed before it was captured
+	HoldExpired HoldStatus = "EXPIRED"
+)
+
+// Hold is a reservation of funds in an account. While a hold is active,
+// the reserved amount is not available for withdrawals or other holds,
+// but it remains part of the ledger balance until it is captured.
+type Hold struct {
+	ID             string     `json:"id"`
+	AccountID      string     `json:"accountID"`
+	Amount         Money      `json:"amount"`
+	Captured       Money      `json:"captured,omitempty"`
+	Status         HoldStatus `json:"status"`
+	Created        time.Time  `json:"created"`
+	ExpiresAt      time.Time  `json:"expiresAt"`
+	IdempotencyKey string     `json:"idempotencyKey,omitempty"`
+	TransactionID  string     `json:"txID,omitempty"` // set once captured
+}
+
+// Returns the status of the hold at the specified time, which is
+// HoldExpired for an active hold that has passed its expiry time
+func (hold *Hold) statusAt(now time.Time) HoldStatus {
+	if hold.Status == HoldActive && now.After(hold.ExpiresAt) {
+		return HoldExpired
+	}
+
+	return hold.Status
+}
+
+// SetHoldExpiry configures how long new holds remain active before
+// they expire. Holds that already exist keep their original expiry.
+func (bank *Bank) SetHoldExpiry(expiry time.Duration) {
+	bank.holdsLock.Lock()
+	bank.holdExpiry = expiry
+	bank.holdsLock.Unlock()
+
+	log.Printf("Holds at '%s' bank expire after %v", bank.name, expiry)
+}
+
+// GetAvailableBalance returns the balance of the specified account
+// less the amounts reserved by its active holds, or an
+// AccountNotFoundError if there is no such account. This may differ
+// from the ledger balance returned by GetAccountBalance.
+func (bank *Bank) GetAvailableBalance(accountID string) (Money, error) {
+	bank.lock.RLock()
+	defer bank.lock.RUnlock()
+
+	acct, err := bank.getAccount(accountID)
+	if err != nil {
+		return -1, err
+	}
+
+	return acct.Balance - bank.heldAmount(accountID, bank.now()), nil
+}
+
+// GetHold returns the hold with the specified ID, or a
+// HoldNotFoundError if there is no such hold.
+func (bank *Bank) GetHold(holdID string) (Hold, error) {
+	bank.lock.RLock()
+	defer bank.lock.RUnlock()
+
+	return bank.currentHold(holdID)
+}
+
+// Returns a copy of the hold with the specified ID, with its status as
+// of the current time, or a HoldNotFoundError if there is no such hold
+func (bank *Bank) currentHold(holdID string) (Hold, error) {
+	hold, err := bank.getHold(holdID)
+	if err != nil {
+		return Hold{}, err
+	}
+
+	bank.holdsLock.Lock()
+	defer bank.holdsLock.Unlock()
+
+	result := *hold
+	result.Status = hold.statusAt(bank.now())
+	return result, nil
+}
+
+// AuthorizeHold reserves the specified amount in the specified account
+// so that it can later be captured (withdrawn) or released. The hold
+// expires, releasing the funds, if it is not captured in time. The
+// idempotency key is used to identify duplicate requests. This returns
+// the hold ID if successful, or will return an error if the account does
+// not exist, the amount is invalid, the account lacks the available
+// funds, the account is not open, or the amount would exceed the
+// account's withdrawal limits. Finally, the hold is evaluated by the
+// bank's fraud rules as a withdrawal, since capturing it makes one, and
+// may be declined with a FraudSuspectedError or held for review with a
+// PendingReviewError.
+func (bank *Bank) AuthorizeHold(accountID string, amount Money, idempotencyKey string) (string, error) {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	return bank.authorizeHold(accountID, amount, idempotencyKey)
+}
+
+// Places a hold as described for AuthorizeHold. The caller must hold
+// lock exclusively.
+func (bank *Bank) authorizeHold(accountID string, amount Money, idempotencyKey string) (string, error) {
+	if amount < Cents(1) {
+		return "", fmt.Errorf("Invalid amount: %s", amount)
+	}
+
+	acct, err := bank.getAccount(accountID)
+	if err != nil {
+		return "", err
+	}
+
+	// check idempotency key, only place the hold if it's unique. If it's a
+	// duplicate, return the ID of the hold placed by the original request.
+	fingerprint := requestFingerprint(holdRequest, accountID, amount, "")
+	if idempotencyKey != "" {
+		previousHoldID, keyExists, err := bank.lookupRequest(idempotencyKey, fingerprint)
+		if err != nil {
+			return "", err
+		}
+		if keyExists {
+			msg := "Duplicate request for idempotency key '%s', returning hold ID: '%s'"
+			log.Printf(msg, idempotencyKey, previousHoldID)
+			return previousHoldID, nil
+		}
+	}
+
+	// a request that was held for review returns the outcome of the
+	// review, unless it is being made now because it was approved
+	reviewedHoldID, approved, err := bank.checkReview(idempotencyKey, fingerprint)
+	if err != nil || reviewedHoldID != "" {
+		return reviewedHoldID, err
+	}
+
+	err = acct.checkCanWithdraw()
+	if err != nil {
+		return "", err
+	}
+
+	now := bank.now().UTC()
+	err = acct.checkFunds(amount, bank.heldAmount(accountID, now))
+	if err != nil {
+		return "", err
+	}
+
+	err = bank.checkWithdrawalLimits(acct, amount, now)
+	if err != nil {
+		return "", err
+	}
+
+	if !approved {
+		err = bank.screenTransaction(acct, Review{
+			AccountID:      accountID,
+			Type:           holdRequest,
+			Amount:         amount,
+			IdempotencyKey: idempotencyKey,
+		}, amount)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	bank.holdsLock.Lock()
+	hold := Hold{
+		ID:             generateTransactionID("H", 10),
+		AccountID:      accountID,
+		Amount:         amount,
+		Status:         HoldActive,
+		Created:        now,
+		ExpiresAt:      now.Add(bank.holdExpiry),
+		IdempotencyKey: idempotencyKey,
+	}
+	bank.holds[hold.ID] = &hold
+	bank.holdsLock.Unlock()
+	bank.recordRequest(idempotencyKey, hold.ID, fingerprint)
+
+	// the hold changes the account's available balance
+	acct.Version++
+
+	err = bank.commit(walRecord{
+		Accounts: []account{*acct},
+		Holds:    []Hold{hold},
+		Requests: bank.requestRecords(idempotencyKey),
+	})
+	if err != nil {
+		log.Printf("ERROR: could not save account data following hold: %v\n", err)
+		return "", err
+	}
+
+	log.Printf("Placed hold for %s %s on '%s' account '%s' (ID: %s)", amount, acct.Currency, bank.name, accountID, hold.ID)
+	return hold.ID, nil
+}
+
+// CaptureHold withdraws funds reserved by an active hold. The amount
+// may be less than the amount held (a partial capture), in which case
+// the remainder is released; an amount of zero captures the full
+// amount. The capture is charged the withdrawal fee, which must be paid
+// from funds that are not held. The idempotency key is used to identify
+// duplicate requests. This returns the transaction ID of the withdrawal
+// if successful, or will return an error if the hold does not exist, is
+// no longer active, the amount exceeds the amount held, the account is
+// no longer open or cannot pay the fee, or the amount would exceed the
+// account's withdrawal limits, which may have been reached since the
+// hold was placed.
+func (bank *Bank) CaptureHold(holdID string, amount Money, idempotencyKey string) (string, error) {
+	if amount < 0 {
+		return "", fmt.Errorf("Invalid amount: %s", amount)
+	}
+
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	hold, err := bank.getHold(holdID)
+	if err != nil {
+		return "", err
+	}
+
+	// a capture is identified by its hold rather than its account, since
+	// two holds in the same account may be captured for the same amount
+	fingerprint := fmt.Sprintf("%s %s hold=%s", TransactionCapture, amount, holdID)
+	if idempotencyKey != "" {
+		previousTxID, keyExists, err := bank.lookupRequest(idempotencyKey, fingerprint)
+		if err != nil {
+			return "", err
+		}
+		if keyExists {
+			msg := "Duplicate request for idempotency key '%s', returning txID: '%s'"
+			log.Printf(msg, idempotencyKey, previousTxID)
+			return previousTxID, nil
+		}
+	}
+
+	acct, err := bank.getAccount(hold.AccountID)
+	if err != nil {
+		return "", err
+	}
+
+	err = acct.checkCanWithdraw()
+	if err != nil {
+		return "", err
+	}
+
+	now := bank.now()
+	bank.holdsLock.Lock()
+	status := hold.statusAt(now)
+	held := hold.Amount
+	bank.holdsLock.Unlock()
+	if status != HoldActive {
+		return "", fmt.Errorf("hold '%s' cannot be captured because it is %s", holdID, status)
+	}
+
+	if amount == 0 {
+		amount = held
+	}
+
+	if amount > held {
+		msg := "capture amount %s %s exceeds amount held %s %s"
+		return "", fmt.Errorf(msg, amount, acct.Currency, held, acct.Currency)
+	}
+
+	err = bank.checkWithdrawalLimits(acct, amount, now)
+	if err != nil {
+		return "", err
+	}
+
+	// the capture is charged the withdrawal fee, which was not reserved
+	// by the hold and so must be paid from the funds that are not held
+	fee, err := bank.fees.feeFor(TransactionWithdrawal, amount)
+	if err != nil {
+		return "", err
+	}
+
+	if fee != 0 {
+		total, err := amount.Add(fee)
+		if err != nil {
+			return "", err
+		}
+
+		err = acct.checkFunds(total, bank.heldAmount(acct.ID, now)-held)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	txID := generateTransactionID("C", 10)
+	bank.holdsLock.Lock()
+	hold.Status = HoldCaptured
+	hold.Captured = amount
+	hold.TransactionID = txID
+	captured := *hold
+	bank.holdsLock.Unlock()
+
+	// the funds were reserved when the hold was placed, so the balance
+	// only needed to be checked if there is a fee to pay
+	acct.Balance = acct.Balance - amount
+	entry := bank.appendToLedger(acct, LedgerEntry{
+		TransactionID:  txID,
+		Type:           TransactionCapture,
+		Amount:         amount,
+		IdempotencyKey: idempotencyKey,
+		HoldID:         holdID,
+	})
+	entries := bank.chargeFee(acct, entry, fee)
+	bank.recordRequest(idempotencyKey, txID, fingerprint)
+
+	err = bank.commit(walRecord{
+		Accounts: []account{*acct},
+		Ledger:   entries,
+		Requests: bank.requestRecords(idempotencyKey),
+		Holds:    []Hold{captured},
+	})
+	if err != nil {
+		log.Printf("ERROR: could not save account data following capture: %v\n", err)
+		return "", err
+	}
+
+	log.Printf("Captured %s %s from '%s' account '%s' for hold %s (ID: %s)",
+		amount, acct.Currency, bank.name, acct.ID, holdID, txID)
+	bank.logFees(entries)
+	return txID, nil
+}
+
+// ReleaseHold cancels an active hold, making its funds available again.
+// Releasing a hold that was already released or has expired has no
+// effect. It returns an error if the hold does not exist or has been
+// captured.
+func (bank *Bank) ReleaseHold(holdID string) error {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	hold, err := bank.getHold(holdID)
+	if err != nil {
+		return err
+	}
+
+	bank.holdsLock.Lock()
+	status := hold.statusAt(bank.now())
+	if status == HoldCaptured {
+		bank.holdsLock.Unlock()
+		return fmt.Errorf("hold '%s' cannot be released because it was captured", holdID)
+	}
+
+	if status != HoldActive {
+		bank.holdsLock.Unlock()
+		return nil
+	}
+
+	hold.Status = HoldReleased
+	released := *hold
+	bank.holdsLock.Unlock()
+
+	change := walRecord{Holds: []Hold{released}}
+	if acct, err := bank.getAccount(hold.AccountID); err == nil {
+		acct.Version++
+		change.Accounts = []account{*acct}
+	}
+
+	err = bank.commit(change)
+	if err != nil {
+		log.Printf("ERROR: could not save account data following release: %v\n", err)
+		return err
+	}
+
+	log.Printf("Released hold %s on '%s' account '%s'", holdID, bank.name, hold.AccountID)
+	return nil
+}
+
+// Returns the hold with the specified ID, or a HoldNotFoundError
+func (bank *Bank) getHold(holdID string) (*Hold, error) {
+	bank.holdsLock.Lock()
+	defer bank.holdsLock.Unlock()
+
+	hold, exists := bank.holds[holdID]
+	if !exists {
+		msg := fmt.Sprintf("no hold with ID '%s' at '%s' bank", holdID, bank.name)
+		return nil, HoldNotFoundError{message: msg}
+	}
+
+	return hold, nil
+}
+
+// Returns the total amount reserved by holds on the account that are
+// active at the specified time
+func (bank *Bank) heldAmount(accountID string, now time.Time) Money {
+	bank.holdsLock.Lock()
+	defer bank.holdsLock.Unlock()
+
+	held := Money(0)
+	for _, hold := range bank.holds {
+		if hold.AccountID == accountID && hold.statusAt(now) == HoldActive {
+			held = held + hold.Amount
+		}
+	}
+
+	return held
+}
+
+// Marks holds that have passed their expiry time as expired, so that
+// the persisted status matches the status reported for them
+func (bank *Bank) expireHolds(now time.Time) {
+	bank.holdsLock.Lock()
+	defer bank.holdsLock.Unlock()
+
+	for _, hold := range bank.holds {
+		if hold.Status == HoldActive && hold.statusAt(now) == HoldExpired {
+			hold.Status = HoldExpired
+			log.Printf("Hold %s on '%s' account '%s' expired", hold.ID, bank.name, hold.AccountID)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package banking
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHoldReservesFundsUntilCaptured(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	if _, err := bank.Deposit(Dollars(100), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	holdID, err := bank.AuthorizeHold(DefaultAccountID, Dollars(60), "hold-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retriedID, err := bank.AuthorizeHold(DefaultAccountID, Dollars(60), "hold-key"); err != nil || retriedID != holdID {
+		t.Errorf("retried hold returned (%s, %v), want (%s, nil)", retriedID, err, holdID)
+	}
+	if available, _ := bank.GetAvailableBalance(DefaultAccountID); available != Dollars(40) {
+		t.Errorf("available balance with hold is %s, want 40.00", available)
+	}
+	if balance := bank.GetBalance(); balance != Dollars(100) {
+		t.Errorf("balance with hold is %s, want 100.00", balance)
+	}
+
+	// the held funds cannot be withdrawn or held again
+	var insufficientFunds InsufficientFundsError
+	if _, err := bank.Withdraw(Dollars(50), ""); !errors.As(err, &insufficientFunds) {
+		t.Errorf("withdrawal of held funds returned %v, want an InsufficientFundsError", err)
+	}
+	if _, err := bank.AuthorizeHold(DefaultAccountID, Dollars(50), ""); !errors.As(err, &insufficientFunds) {
+		t.Errorf("hold on held funds returned %v, want an InsufficientFundsError", err)
+	}
+
+	// a partial capture withdraws part of the hold and releases the rest
+	if _, err := bank.CaptureHold(holdID, Dollars(61), ""); err == nil {
+		t.Error("captured more than the amount held")
+	}
+	captureID, err := bank.CaptureHold(holdID, Dollars(45), "capture-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retriedID, err := bank.CaptureHold(holdID, Dollars(45), "capture-key"); err != nil || retriedID != captureID {
+		t.Errorf("retried capture returned (%s, %v), want (%s, nil)", retriedID, err, captureID)
+	}
+	hold, err := bank.GetHold(holdID)
+	if err != nil || hold.Status != HoldCaptured || hold.Captured != Dollars(45) || hold.TransactionID != captureID {
+		t.Errorf("hold after capture is %+v (error: %v), want 45.00 captured by %s", hold, err, captureID)
+	}
+	if balance := bank.GetBalance(); balance != Dollars(55) {
+		t.Errorf("balance after capture is %s, want 55.00", balance)
+	}
+	if available, _ := bank.GetAvailableBalance(DefaultAccountID); available != Dollars(55) {
+		t.Errorf("available balance after capture is %s, want 55.00", available)
+	}
+	if entry, found := bank.findLedgerEntry(captureID); !found || entry.Type != TransactionCapture || entry.HoldID != holdID {
+		t.Errorf("ledger entry for capture is %+v, want a capture of hold %s", entry, holdID)
+	}
+
+	// a captured hold cannot be captured again or released
+	if _, err := bank.CaptureHold(holdID, 0, ""); err == nil {
+		t.Error("captured a hold twice")
+	}
+	if err := bank.ReleaseHold(holdID); err == nil {
+		t.Error("released a captured hold")
+	}
+
+	var notFound HoldNotFoundError
+	if _, err := bank.GetHold("H0000000000"); !errors.As(err, &notFound) {
+		t.Errorf("getting unknown hold returned %v, want a HoldNotFoundError", err)
+	}
+	checkLedger(t, bank)
+}
+
+func TestHoldIsReleased(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	client, _ := newTestClient(t, bank)
+	if _, err := client.Deposit(Dollars(100), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	holdID, err := client.AuthorizeHold(DefaultAccountID, Dollars(70), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if available, err := client.GetAvailableBalance(DefaultAccountID); err != nil || available != Dollars(30) {
+		t.Errorf("available balance with hold is %s (error: %v), want 30.00", available, err)
+	}
+
+	// releasing makes the funds available again, and has no further
+	// effect once done
+	for i := 0; i < 2; i++ {
+		if err := client.ReleaseHold(holdID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hold, err := client.GetHold(holdID); err != nil || hold.Status != HoldReleased || hold.Amount != Dollars(70) {
+		t.Errorf("hold after release is %+v (error: %v), want a released hold of 70.00", hold, err)
+	}
+	if available, _ := client.GetAvailableBalance(DefaultAccountID); available != Dollars(100) {
+		t.Errorf("available balance after release is %s, want 100.00", available)
+	}
+	if _, err := client.CaptureHold(holdID, 0, ""); err == nil {
+		t.Error("captured a released hold")
+	}
+
+	var notFound HoldNotFoundError
+	if _, err := client.CaptureHold("H0000000000", 0, ""); !errors.As(err, &notFound) {
+		t.Errorf("capturing unknown hold returned %v, want a HoldNotFoundError", err)
+	}
+}
+
+func TestHoldExpires(t *testing.T) {
+	discardLogOutput(t)
+	path := filepath.Join(t.TempDir(), "bank-test.dat")
+	clock := &fakeClock{now: time.Date(2026, time.April, 1, 9, 0, 0, 0, time.UTC)}
+
+	bank := NewBankWithStorage("test", NewFileStorage(path))
+	bank.SetClock(clock)
+	bank.SetHoldExpiry(time.Hour)
+	if _, err := bank.Deposit(Dollars(100), ""); err != nil {
+		t.Fatal(err)
+	}
+	holdID, err := bank.AuthorizeHold(DefaultAccountID, Dollars(80), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(59 * time.Minute)
+	if hold, _ := bank.GetHold(holdID); hold.Status != HoldActive {
+		t.Errorf("hold before its expiry is %s, want ACTIVE", hold.Status)
+	}
+
+	// once expired, the funds are available and the hold cannot be
+	// captured, including after a restart
+	clock.Advance(2 * time.Minute)
+	for session := 0; session < 2; session++ {
+		if hold, _ := bank.GetHold(holdID); hold.Status != HoldExpired {
+			t.Errorf("hold after its expiry is %s, want EXPIRED", hold.Status)
+		}
+		if available, _ := bank.GetAvailableBalance(DefaultAccountID); available != Dollars(100) {
+			t.Errorf("available balance after expiry is %s, want 100.00", available)
+		}
+		if _, err := bank.CaptureHold(holdID, 0, ""); err == nil {
+			t.Error("captured an expired hold")
+		}
+
+		if err := bank.Close(); err != nil {
+			t.Fatal(err)
+		}
+		bank = NewBankWithStorage("test", NewFileStorage(path))
+		bank.SetClock(clock)
+	}
+	t.Cleanup(func() { bank.Close() })
+
+	if _, err := bank.Withdraw(Dollars(100), ""); err != nil {
+		t.Errorf("withdrawal of funds released by an expired hold failed: %v", err)
+	}
+	checkLedger(t, bank)
+}
@@ -0,0 +1,179 @@
+package banking
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultIdempotencyTTL is how long an idempotency key is retained
+	// unless the bank is configured otherwise.
+	DefaultIdempotencyTTL = 24 * time.Hour
+	// DefaultIdempotencyMaxKeys is the number of idempotency keys that
+	// a bank retains unless it is configured otherwise.
+	DefaultIdempotencyMaxKeys = 100000
+)
+
+// idempotencyRecord holds what the bank remembers about a request
+// that was made with an idempotency key.
+type idempotencyRecord struct {
+	TransactionID string    `json:"txID"`
+	Fingerprint   string    `json:"fingerprint,omitempty"`
+	Created       time.Time `json:"created"`
+}
+
+// SetIdempotencyRetention configures how long idempotency keys are
+// retained and how many are retained at most. Once a key has been
+// evicted, a request that reuses it is processed as a new request.
+// A zero value for either setting removes that limit. Keys that fall
+// outside the new limits are evicted immediately.
+func (bank *Bank) SetIdempotencyRetention(ttl time.Duration, maxKeys int) {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	bank.requestsLock.Lock()
+	bank.idempotencyTTL = ttl
+	bank.idempotencyMaxKeys = maxKeys
+	bank.evictRequests(bank.now())
+	bank.requestsLock.Unlock()
+
+	log.Printf("Retaining idempotency keys for '%s' bank (TTL: %v, max keys: %d)", bank.name, ttl, maxKeys)
+}
+
+// Returns the transaction ID associated with the idempotency key, and
+// whether the key has been used before and is still being retained.
+// This returns an IdempotencyConflictError if the key was used for a
+// request with a different fingerprint. The caller must hold lock
+// exclusively, so that no other request can record the key between
+// this lookup and the caller recording it; the original request may
+// still be waiting for its change to become durable, so if the key was
+// used, this waits for that as described for awaitLog before returning.
+func (bank *Bank) lookupRequest(idempotencyKey string, fingerprint string) (string, bool, error) {
+	bank.requestsLock.Lock()
+	record, keyExists := bank.requests[idempotencyKey]
+	expired := keyExists && bank.isExpired(record, bank.now())
+	bank.requestsLock.Unlock()
+
+	if !keyExists || expired {
+		return "", false, nil
+	}
+
+	// records from data files that predate fingerprints cannot be checked
+	if record.Fingerprint != "" && record.Fingerprint != fingerprint {
+		msg := "idempotency key '%s' was already used for a different request (%s)"
+		return "", false, IdempotencyConflictError{message: fmt.Sprintf(msg, idempotencyKey, record.Fingerprint)}
+	}
+
+	if err := bank.awaitLog(); err != nil {
+		return "", false, err
+	}
+
+	return record.TransactionID, true, nil
+}
+
+// Associates the idempotency key with the transaction ID and the
+// fingerprint of the request so that later duplicates of the request
+// can be identified. Requests made without a key are not recorded.
+func (bank *Bank) recordRequest(idempotencyKey string, txID string, fingerprint string) {
+	if idempotencyKey == "" {
+		return
+	}
+
+	now := bank.now().UTC()
+
+	bank.requestsLock.Lock()
+	defer bank.requestsLock.Unlock()
+
+	// a key that is reused once it has expired may not have been evicted
+	// yet, in which case its old record is replaced by the new one
+	bank.addRequest(idempotencyKey, idempotencyRecord{
+		TransactionID: txID,
+		Fingerprint:   fingerprint,
+		Created:       now,
+	})
+	bank.evictRequests(now)
+}
+
+// Adds the record for the idempotency key. If the key is already
+// present, its record is replaced by one that is at least as new, such
+// as when a log is replayed over a snapshot that holds the record from
+// an earlier use of an expired key, and is otherwise kept. Records must
+// be added in the order in which they were created. The caller must
+// hold requestsLock.
+func (bank *Bank) addRequest(idempotencyKey string, record idempotencyRecord) {
+	if existing, keyExists := bank.requests[idempotencyKey]; keyExists {
+		if record.Created.Before(existing.Created) {
+			return
+		}
+
+		for i, key := range bank.requestOrder {
+			if key == idempotencyKey {
+				bank.requestOrder = append(bank.requestOrder[:i], bank.requestOrder[i+1:]...)
+				break
+			}
+		}
+	}
+
+	bank.requests[idempotencyKey] = record
+	bank.requestOrder = append(bank.requestOrder, idempotencyKey)
+}
+
+// Returns a value that identifies the parameters of a request, so that
+// an idempotency key reused with different parameters can be detected.
+// The currency is empty unless the amount was given in a currency other
+// than that of the account.
+func requestFingerprint(txType TransactionType, accountID string, amount Money, currency string) string {
+	if currency != "" {
+		return fmt.Sprintf("%s %s %s account=%s", txType, amount, currency, accountID)
+	}
+
+	return fmt.Sprintf("%s %s account=%s", txType, amount, accountID)
+}
+
+// Reports whether the record is older than the retention window
+func (bank *Bank) isExpired(record idempotencyRecord, now time.Time) bool {
+	return bank.idempotencyTTL > 0 && now.Sub(record.Created) > bank.idempotencyTTL
+}
+
+// Removes the oldest idempotency keys until all remaining keys are
+// within the retention window and the maximum key count. The caller
+// must hold requestsLock.
+func (bank *Bank) evictRequests(now time.Time) {
+	evicted := 0
+	for len(bank.requestOrder) > 0 {
+		oldest := bank.requestOrder[0]
+		overLimit := bank.idempotencyMaxKeys > 0 && len(bank.requestOrder) > bank.idempotencyMaxKeys
+		if !overLimit && !bank.isExpired(bank.requests[oldest], now) {
+			break
+		}
+
+		delete(bank.requests, oldest)
+		bank.requestOrder = bank.requestOrder[1:]
+		evicted++
+	}
+
+	if evicted > 0 {
+		log.Printf("Evicted %d idempotency keys from '%s' bank", evicted, bank.name)
+	}
+}
+
+// Restores the records loaded from a previous session, oldest first.
+// Nothing is evicted until the retention limits have been configured
+// or the next request is recorded.
+func (bank *Bank) restoreRequests(records map[string]idempotencyRecord) {
+	keys := make([]string, 0, len(records))
+	for idempotencyKey := range records {
+		keys = append(keys, idempotencyKey)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return records[keys[i]].Created.Before(records[keys[j]].Created)
+	})
+
+	bank.requestsLock.Lock()
+	for _, idempotencyKey := range keys {
+		bank.addRequest(idempotencyKey, records[idempotencyKey])
+	}
+	bank.requestsLock.Unlock()
+}
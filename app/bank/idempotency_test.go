@@ -0,0 +1,188 @@
+package banking
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKeysPersistAcrossRestarts(t *testing.T) {
+	// the keys are replayed from the log, or loaded from a snapshot
+	for _, interval := range []int{0, 1} {
+		t.Run(fmt.Sprintf("snapshot-interval=%d", interval), func(t *testing.T) {
+			discardLogOutput(t)
+			path := filepath.Join(t.TempDir(), "bank-test.dat")
+
+			bank := NewBankWithStorage("test", NewFileStorage(path))
+			bank.SetSnapshotInterval(interval)
+			depositID, err := bank.Deposit(Dollars(100), "deposit-key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			withdrawalID, err := bank.Withdraw(Dollars(40), "withdrawal-key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := bank.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			bank = NewBankWithStorage("test", NewFileStorage(path))
+			t.Cleanup(func() { bank.Close() })
+
+			if txID, err := bank.Deposit(Dollars(100), "deposit-key"); err != nil || txID != depositID {
+				t.Errorf("deposit retried after restart returned (%s, %v), want (%s, nil)", txID, err, depositID)
+			}
+			if txID, err := bank.Withdraw(Dollars(40), "withdrawal-key"); err != nil || txID != withdrawalID {
+				t.Errorf("withdrawal retried after restart returned (%s, %v), want (%s, nil)", txID, err, withdrawalID)
+			}
+			if balance := bank.GetBalance(); balance != Dollars(60) {
+				t.Errorf("balance after retries is %s, want 60.00", balance)
+			}
+			checkLedger(t, bank)
+		})
+	}
+}
+
+func TestExpiredIdempotencyKeyCanBeReused(t *testing.T) {
+	discardLogOutput(t)
+	path := filepath.Join(t.TempDir(), "bank-test.dat")
+	clock := &fakeClock{now: time.Date(2026, time.June, 1, 12, 0, 0, 0, time.UTC)}
+
+	bank := NewBankWithStorage("test", NewFileStorage(path))
+	bank.SetClock(clock)
+	bank.SetIdempotencyRetention(time.Hour, 0)
+
+	firstID, err := bank.Deposit(Dollars(10), "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// once the key has expired, it makes a new deposit, which a retry
+	// returns rather than depositing again
+	clock.Advance(2 * time.Hour)
+	secondID, err := bank.Deposit(Dollars(10), "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secondID == firstID {
+		t.Fatalf("deposit with expired key returned the original transaction %s", firstID)
+	}
+	if retriedID, err := bank.Deposit(Dollars(10), "k"); err != nil || retriedID != secondID {
+		t.Errorf("retried deposit returned (%s, %v), want (%s, nil)", retriedID, err, secondID)
+	}
+
+	// the new use of the key is also kept across sessions
+	if err := bank.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bank = NewBankWithStorage("test", NewFileStorage(path))
+	t.Cleanup(func() { bank.Close() })
+	bank.SetClock(clock)
+	bank.SetIdempotencyRetention(time.Hour, 0)
+
+	if retriedID, err := bank.Deposit(Dollars(10), "k"); err != nil || retriedID != secondID {
+		t.Errorf("deposit retried after restart returned (%s, %v), want (%s, nil)", retriedID, err, secondID)
+	}
+	if balance := bank.GetBalance(); balance != Dollars(20) {
+		t.Errorf("balance is %s, want 20.00", balance)
+	}
+	checkLedger(t, bank)
+}
+
+func TestIdempotencyKeysAreRetainedWithinLimits(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	clock := &fakeClock{now: time.Date(2026, time.June, 1, 12, 0, 0, 0, time.UTC)}
+	bank.SetClock(clock)
+	bank.SetIdempotencyRetention(time.Hour, 3)
+
+	txIDs := map[string]string{}
+	for i := 1; i <= 4; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		txID, err := bank.Deposit(Dollars(1), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txIDs[key] = txID
+		clock.Advance(time.Minute)
+	}
+
+	// only the most recent keys are retained
+	if retained := len(bank.requests); retained != 3 {
+		t.Errorf("bank retains %d keys, want 3", retained)
+	}
+	if txID, err := bank.Deposit(Dollars(1), "key-2"); err != nil || txID != txIDs["key-2"] {
+		t.Errorf("retried deposit returned (%s, %v), want (%s, nil)", txID, err, txIDs["key-2"])
+	}
+	if txID, err := bank.Deposit(Dollars(1), "key-1"); err != nil || txID == txIDs["key-1"] {
+		t.Errorf("deposit with evicted key returned (%s, %v), want a new transaction", txID, err)
+	}
+
+	// and only until they expire
+	clock.Advance(2 * time.Hour)
+	if txID, err := bank.Deposit(Dollars(1), "key-4"); err != nil || txID == txIDs["key-4"] {
+		t.Errorf("deposit with expired key returned (%s, %v), want a new transaction", txID, err)
+	}
+
+	// tightening the limits evicts keys immediately
+	bank.SetIdempotencyRetention(0, 1)
+	if retained := len(bank.requests); retained != 1 {
+		t.Errorf("bank retains %d keys after the limit was lowered, want 1", retained)
+	}
+	if balance := bank.GetBalance(); balance != Dollars(6) {
+		t.Errorf("balance is %s, want 6.00", balance)
+	}
+	checkLedger(t, bank)
+}
+
+func TestIdempotencyKeyReusedForDifferentRequest(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	if err := bank.OpenAccount("savings", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bank.Deposit(Dollars(100), "deposit-key"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the key may only be reused for the same operation, account, amount,
+	// and currency
+	var conflict IdempotencyConflictError
+	reuses := map[string]func() error{
+		"different amount": func() error {
+			_, err := bank.Deposit(Dollars(99), "deposit-key")
+			return err
+		},
+		"different account": func() error {
+			_, err := bank.DepositToAccount("savings", Dollars(100), "", "deposit-key", AnyVersion)
+			return err
+		},
+		"different currency": func() error {
+			_, err := bank.DepositToAccount(DefaultAccountID, Dollars(100), "EUR", "deposit-key", AnyVersion)
+			return err
+		},
+		"withdrawal": func() error {
+			_, err := bank.Withdraw(Dollars(100), "deposit-key")
+			return err
+		},
+		"hold": func() error {
+			_, err := bank.AuthorizeHold(DefaultAccountID, Dollars(100), "deposit-key")
+			return err
+		},
+	}
+	for name, reuse := range reuses {
+		if err := reuse(); !errors.As(err, &conflict) {
+			t.Errorf("reusing key for %s returned %v, want an IdempotencyConflictError", name, err)
+		}
+	}
+	if balance := bank.GetBalance(); balance != Dollars(100) {
+		t.Errorf("balance after conflicting requests is %s, want 100.00", balance)
+	}
+
+	client, _ := newTestClient(t, bank)
+	if _, err := client.Deposit(Dollars(1), "deposit-key"); !errors.As(err, &conflict) {
+		t.Errorf("client reusing key returned %v, want an IdempotencyConflictError", err)
+	}
+	checkLedger(t, bank)
+}
@@ -0,0 +1,312 @@
+package banking
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// InterestMonthly is the interest period with which accrued interest
+// is posted on the first day of each month (in UTC). It is the period
+// that a bank uses unless configured otherwise.
+const InterestMonthly time.Duration = 0
+
+// how often a bank accruing interest monthly checks whether a day has
+// passed; in demo mode, it checks once per interest period
+const interestCheckInterval = time.Minute
+
+// AccountInterest describes the interest earned by an account
+type AccountInterest struct {
+	APR     string // annual percentage rate, such as "4.5"; "0" for none
+	Accrued Money  // accrued but not yet posted, rounded down to the cent
+}
+
+// accountInterest holds the state of interest for an account that has
+// been given an interest rate. It is replaced rather than modified, so
+// that copies of the account do not share changes.
+type accountInterest struct {
+	Rate           string    `json:"apr"`
+	Accrued        string    `json:"accrued"`        // exact, including fractions of a cent
+	AccruedThrough time.Time `json:"accruedThrough"` // start of the first day not yet accrued
+}
+
+// SetInterestPeriod configures how often accrued interest is posted to
+// accounts. With InterestMonthly, interest accrues on the balance at
+// the end of each day and is posted on the first day of the next month.
+// A positive period is a demo mode in which each period counts as a
+// day, so that interest is accrued and posted every period; this shows
+// the effect of interest in seconds rather than months. The period
+// should be set before StartInterestAccrual is called.
+func (bank *Bank) SetInterestPeriod(period time.Duration) {
+	bank.lock.Lock()
+	bank.interestPeriod = period
+	bank.lock.Unlock()
+
+	if period == InterestMonthly {
+		log.Printf("Posting interest for '%s' bank monthly", bank.name)
+	} else {
+		log.Printf("Posting interest for '%s' bank every %v (demo mode)", bank.name, period)
+	}
+}
+
+// GetInterest returns the interest rate of the specified account and
+// the interest that it has accrued, or an AccountNotFoundError if there
+// is no such account.
+func (bank *Bank) GetInterest(accountID string) (AccountInterest, error) {
+	bank.lock.RLock()
+	defer bank.lock.RUnlock()
+
+	acct, err := bank.getAccount(accountID)
+	if err != nil {
+		return AccountInterest{}, err
+	}
+
+	if acct.Interest == nil {
+		return AccountInterest{APR: "0"}, nil
+	}
+
+	accrued, err := parseAccrued(acct.Interest.Accrued)
+	if err != nil {
+		return AccountInterest{}, err
+	}
+
+	return AccountInterest{APR: acct.Interest.Rate, Accrued: floorCents(accrued)}, nil
+}
+
+// SetInterestRate changes the annual percentage rate, such as "4.5",
+// at which the specified account earns interest; a rate of zero means
+// that the account earns no further interest. Interest accrued at the
+// previous rate is kept and posted as usual. It returns an error if the
+// rate is invalid or negative, or an AccountNotFoundError if there is
+// no such account.
+func (bank *Bank) SetInterestRate(accountID string, apr string) error {
+	apr = strings.TrimSpace(apr)
+	rate, ok := new(big.Rat).SetString(apr)
+	if !ok || rate.Sign() < 0 {
+		return fmt.Errorf("invalid interest rate: '%s'", apr)
+	}
+
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	acct, err := bank.getAccount(accountID)
+	if err != nil {
+		return err
+	}
+
+	// interest up to now is accrued at the previous rate
+	change := walRecord{}
+	now := bank.now()
+	if acct.Interest != nil {
+		entry, err := bank.accrueInterest(acct, now)
+		if err != nil {
+			return err
+		}
+		if entry != nil {
+			change.Ledger = append(change.Ledger, *entry)
+		}
+	}
+
+	interest := accountInterest{Rate: apr, Accrued: "0", AccruedThrough: bank.interestDay(now)}
+	if acct.Interest != nil {
+		interest.Accrued = acct.Interest.Accrued
+		interest.AccruedThrough = acct.Interest.AccruedThrough
+	}
+	acct.Interest = &interest
+	acct.Version++
+	change.Accounts = []account{*acct}
+
+	err = bank.commit(change)
+	if err != nil {
+		log.Printf("ERROR: could not save account data following interest rate change: %v\n", err)
+		return err
+	}
+
+	log.Printf("Set interest rate for '%s' account '%s' to %s%% APR", bank.name, accountID, apr)
+	return nil
+}
+
+// AccrueInterest accrues interest on every account that has an interest
+// rate for each day that has ended since interest was last accrued, and
+// posts the accrued interest, rounded down to the cent, to any account
+// whose interest period has ended. Posted interest is recorded in the
+// ledger as a TransactionInterest entry. Days are determined by the
+// bank's clock, and interest for days that were missed (such as while
+// the service was stopped) is accrued on the current balance. Closed
+// accounts earn no interest. This is called periodically once
+// StartInterestAccrual has been called, but it may also be called
+// directly, such as after advancing the clock.
+func (bank *Bank) AccrueInterest() error {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	now := bank.now()
+	change := walRecord{}
+	for _, accountID := range bank.listAccounts() {
+		acct, err := bank.getAccount(accountID)
+		if err != nil || acct.Interest == nil || acct.status() == AccountClosed {
+			continue
+		}
+
+		before := acct.Interest
+		entry, err := bank.accrueInterest(acct, now)
+		if err != nil {
+			log.Printf("ERROR: could not accrue interest for account '%s': %v\n", accountID, err)
+			continue
+		}
+
+		if entry != nil {
+			change.Ledger = append(change.Ledger, *entry)
+		}
+		if acct.Interest != before {
+			change.Accounts = append(change.Accounts, *acct)
+		}
+	}
+
+	if len(change.Accounts) == 0 {
+		return nil
+	}
+
+	err := bank.commit(change)
+	if err != nil {
+		log.Printf("ERROR: could not save account data following interest accrual: %v\n", err)
+		return err
+	}
+
+	for _, entry := range change.Ledger {
+		log.Printf("Posted interest of %s %s to '%s' account '%s' (ID: %s)",
+			entry.Amount, entry.Currency, bank.name, entry.AccountID, entry.TransactionID)
+	}
+
+	return nil
+}
+
+// StartInterestAccrual starts accruing and posting interest in the
+// background, as described for AccrueInterest, until the bank is
+// closed. Interest for any days that passed while the bank was not
+// accruing it is accrued immediately. This has no effect if interest
+// is already being accrued.
+func (bank *Bank) StartInterestAccrual() {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	if bank.interestTask != nil {
+		return
+	}
+
+	interval := interestCheckInterval
+	if bank.interestPeriod != InterestMonthly {
+		interval = bank.interestPeriod
+	}
+
+	bank.interestTask = startBackgroundTask(interval, func() {
+		if err := bank.AccrueInterest(); err != nil {
+			log.Printf("ERROR: failed to accrue interest for '%s' bank: %v\n", bank.name, err)
+		}
+	})
+}
+
+// Accrues interest on the account for each day that has ended before
+// the specified time, and posts the accrued interest if the interest
+// period has ended, returning the ledger entry that records it (or nil
+// if nothing was posted). The account's interest state is replaced if
+// any days were accrued. No interest accrues on a negative balance.
+// The caller must hold lock exclusively, and the account must have an
+// interest rate.
+func (bank *Bank) accrueInterest(acct *account, now time.Time) (*LedgerEntry, error) {
+	interest := *acct.Interest
+	today := bank.interestDay(now)
+	days := int64(today.Sub(interest.AccruedThrough) / bank.interestDayLength())
+	if days <= 0 {
+		return nil, nil
+	}
+
+	rate, ok := new(big.Rat).SetString(interest.Rate)
+	if !ok {
+		return nil, fmt.Errorf("invalid interest rate: '%s'", interest.Rate)
+	}
+
+	accrued, err := parseAccrued(interest.Accrued)
+	if err != nil {
+		return nil, err
+	}
+
+	if acct.Balance > 0 {
+		// balance x (APR / 100) / 365 for each day
+		daily := new(big.Rat).Mul(new(big.Rat).SetInt64(int64(acct.Balance)), rate)
+		daily.Quo(daily, big.NewRat(100*365, 1))
+		accrued.Add(accrued, daily.Mul(daily, big.NewRat(days, 1)))
+	}
+
+	posting := bank.interestPostingDue(interest.AccruedThrough, today)
+	interest.AccruedThrough = today
+	interest.Accrued = accrued.RatString()
+	acct.Interest = &interest
+
+	amount := floorCents(accrued)
+	if !posting || amount < Cents(1) {
+		return nil, nil
+	}
+
+	newBalance, err := acct.Balance.Add(amount)
+	if err != nil {
+		return nil, err
+	}
+
+	acct.Balance = newBalance
+	interest.Accrued = accrued.Sub(accrued, new(big.Rat).SetInt64(int64(amount))).RatString()
+	entry := bank.appendToLedger(acct, LedgerEntry{
+		TransactionID: generateTransactionID("I", 10),
+		Type:          TransactionInterest,
+		Amount:        amount,
+	})
+
+	return &entry, nil
+}
+
+// Returns the start of the interest day containing the specified time,
+// which is midnight UTC unless the bank is in demo mode. The caller must
+// hold lock, either shared or exclusively.
+func (bank *Bank) interestDay(t time.Time) time.Time {
+	return t.UTC().Truncate(bank.interestDayLength())
+}
+
+// Returns the length of an interest day, which in demo mode is the
+// interest period. The caller must hold lock, either shared or
+// exclusively.
+func (bank *Bank) interestDayLength() time.Duration {
+	if bank.interestPeriod == InterestMonthly {
+		return 24 * time.Hour
+	}
+
+	return bank.interestPeriod
+}
+
+// Reports whether accrued interest should be posted when accruing from
+// the start of one interest day to the start of a later one: when the
+// month changes, or in demo mode, every time. The caller must hold
+// lock, either shared or exclusively.
+func (bank *Bank) interestPostingDue(from time.Time, to time.Time) bool {
+	if bank.interestPeriod != InterestMonthly {
+		return true
+	}
+
+	return from.Year() != to.Year() || from.Month() != to.Month()
+}
+
+// Parses an amount of accrued interest, in cents, as it is persisted
+func parseAccrued(accrued string) (*big.Rat, error) {
+	value, ok := new(big.Rat).SetString(accrued)
+	if !ok {
+		return nil, fmt.Errorf("invalid accrued interest: '%s'", accrued)
+	}
+
+	return value, nil
+}
+
+// Returns the whole number of cents in a non-negative amount of cents
+func floorCents(cents *big.Rat) Money {
+	return Money(new(big.Int).Quo(cents.Num(), cents.Denom()).Int64())
+}
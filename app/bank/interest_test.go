@@ -0,0 +1,148 @@
+package banking
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock whose time only changes when it is advanced
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (clock *fakeClock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.now
+}
+
+func (clock *fakeClock) Advance(d time.Duration) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	clock.now = clock.now.Add(d)
+}
+
+func TestInterestIsPostedMonthly(t *testing.T) {
+	discardLogOutput(t)
+	path := filepath.Join(t.TempDir(), "bank-test.dat")
+	clock := &fakeClock{now: time.Date(2026, time.January, 15, 9, 30, 0, 0, time.UTC)}
+
+	bank := NewBankWithStorage("test", NewFileStorage(path))
+	bank.SetClock(clock)
+	if _, err := bank.Deposit(Dollars(1000), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// 3.65% APR earns 0.01% of the balance, or 10 cents, per day
+	if err := bank.SetInterestRate(DefaultAccountID, "3.65"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 17 days pass before the month changes, so $1.70 is posted
+	clock.Advance(17 * 24 * time.Hour)
+	if err := bank.AccrueInterest(); err != nil {
+		t.Fatal(err)
+	}
+	if balance := bank.GetBalance(); balance != Cents(100170) {
+		t.Errorf("balance after the first month is %s, want 1001.70", balance)
+	}
+
+	// interest accrues on the new balance, but is not posted mid-month
+	clock.Advance(10 * 24 * time.Hour)
+	if err := bank.AccrueInterest(); err != nil {
+		t.Fatal(err)
+	}
+	interest, err := bank.GetInterest(DefaultAccountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interest.APR != "3.65" || interest.Accrued != Cents(100) {
+		t.Errorf("interest is %+v, want 3.65%% APR with 1.00 accrued", interest)
+	}
+	if balance := bank.GetBalance(); balance != Cents(100170) {
+		t.Errorf("balance mid-month is %s, want 1001.70", balance)
+	}
+	checkLedger(t, bank)
+
+	// the accrued interest is kept across sessions, and posted after
+	// the remaining 18 days of February
+	if err := bank.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bank = NewBankWithStorage("test", NewFileStorage(path))
+	t.Cleanup(func() { bank.Close() })
+	bank.SetClock(clock)
+
+	clock.Advance(18 * 24 * time.Hour)
+	if err := bank.AccrueInterest(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 28 days of interest on 1001.70 is 2.80476, of which 2.80 is posted
+	if balance := bank.GetBalance(); balance != Cents(100450) {
+		t.Errorf("balance after the second month is %s, want 1004.50", balance)
+	}
+
+	ledger, err := bank.GetLedger(DefaultAccountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := ledger[len(ledger)-1]; last.Type != TransactionInterest || !last.Timestamp.Equal(clock.Now()) {
+		t.Errorf("last ledger entry is %+v, want interest posted at %v", last, clock.Now())
+	}
+	checkLedger(t, bank)
+}
+
+func TestInterestIsPostedEachPeriodInDemoMode(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	clock := &fakeClock{now: time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)}
+	bank.SetClock(clock)
+	bank.SetInterestPeriod(10 * time.Second)
+
+	if err := bank.OpenAccount("overdrawn", DefaultCurrency); err != nil {
+		t.Fatal(err)
+	}
+	if err := bank.SetOverdraftLimit("overdrawn", Dollars(100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bank.WithdrawFromAccount("overdrawn", Dollars(50), "", "", AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bank.Deposit(Dollars(1000), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// 36.5% APR earns 0.1% of the balance, or $1.00, per period
+	for _, accountID := range []string{DefaultAccountID, "overdrawn"} {
+		if err := bank.SetInterestRate(accountID, "36.5"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// nothing is accrued until a period has ended
+	clock.Advance(5 * time.Second)
+	if err := bank.AccrueInterest(); err != nil {
+		t.Fatal(err)
+	}
+	if balance := bank.GetBalance(); balance != Dollars(1000) {
+		t.Errorf("balance before the period ended is %s, want 1000.00", balance)
+	}
+
+	// periods that were missed are accrued on the current balance
+	clock.Advance(30 * time.Second)
+	if err := bank.AccrueInterest(); err != nil {
+		t.Fatal(err)
+	}
+	if balance := bank.GetBalance(); balance != Dollars(1003) {
+		t.Errorf("balance after three periods is %s, want 1003.00", balance)
+	}
+
+	// no interest is earned on a negative balance
+	if balance, err := bank.GetAccountBalance("overdrawn"); err != nil || balance != Dollars(-50) {
+		t.Errorf("balance of overdrawn account is %s (error: %v), want -50.00", balance, err)
+	}
+	checkLedger(t, bank)
+}
@@ -0,0 +1,196 @@
+package banking
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// TransactionType identifies the kind of operation that a ledger
+// entry records.
+type TransactionType string
+
+const (
+	// TransactionDeposit records money added to an account
+	TransactionDeposit TransactionType = "DEPOSIT"
+	// TransactionWithdrawal records money removed from an account
+	TransactionWithdrawal TransactionType = "WITHDRAWAL"
+	// TransactionCapture records money removed from an account by
+	// capturing funds that were reserved by a hold
+	TransactionCapture TransactionType = "CAPTURE"
+	// TransactionDepositReversal records money removed from an account
+	// to undo all or part of an earlier deposit
+	TransactionDepositReversal TransactionType = "DEPOSIT_REVERSAL"
+	// TransactionWithdrawalReversal records money returned to an account
+	// to undo all or part of an earlier withdrawal or capture
+	TransactionWithdrawalReversal TransactionType = "WITHDRAWAL_REVERSAL"
+	// TransactionInterest records interest that the account earned on
+	// its balance, posted at the end of an interest period
+	TransactionInterest TransactionType = "INTEREST"
+	// TransactionFee records a fee charged for a deposit, withdrawal, or
+	// transfer, as determined by the bank's fee schedule
+	TransactionFee TransactionType = "FEE"
+	// TransactionOpeningBalance records a balance carried over from a
+	// data file that predates the ledger, so that every balance can be
+	// explained by the entries that produced it.
+	TransactionOpeningBalance TransactionType = "OPENING_BALANCE"
+)
+
+// LedgerEntry is an immutable record of a single operation that
+// changed the balance of an account. Entries are only ever appended
+// to the ledger; they are never modified or removed.
+type LedgerEntry struct {
+	TransactionID  string          `json:"txID"`
+	AccountID      string          `json:"accountID"`
+	Type           TransactionType `json:"type"`
+	Amount         Money           `json:"amount"`
+	IdempotencyKey string          `json:"idempotencyKey,omitempty"`
+	Timestamp      time.Time       `json:"timestamp"`
+	Balance        Money           `json:"balance"` // balance after this entry was posted
+	Currency       string          `json:"currency,omitempty"`
+	HoldID         string          `json:"holdID,omitempty"`     // for captures
+	ReversalOf     string          `json:"reversalOf,omitempty"` // for reversals
+	FeeFor         string          `json:"feeFor,omitempty"`     // for fees
+
+	// for amounts given in a currency other than that of the account
+	OriginalAmount   Money  `json:"originalAmount,omitempty"`
+	OriginalCurrency string `json:"originalCurrency,omitempty"`
+	ExchangeRate     string `json:"exchangeRate,omitempty"`
+	ConversionFee    Money  `json:"conversionFee,omitempty"`
+}
+
+// Returns the signed change in balance that this entry represents
+func (entry LedgerEntry) delta() Money {
+	switch entry.Type {
+	case TransactionWithdrawal, TransactionCapture, TransactionDepositReversal, TransactionFee:
+		return -entry.Amount
+	}
+
+	return entry.Amount
+}
+
+// GetLedger returns a copy of the ledger entries for the specified
+// account, oldest first, or an AccountNotFoundError if there is no
+// such account.
+func (bank *Bank) GetLedger(accountID string) ([]LedgerEntry, error) {
+	bank.lock.RLock()
+	defer bank.lock.RUnlock()
+
+	return bank.accountLedger(accountID)
+}
+
+// Returns a copy of the ledger entries for the specified account, as
+// described for GetLedger
+func (bank *Bank) accountLedger(accountID string) ([]LedgerEntry, error) {
+	if _, err := bank.getAccount(accountID); err != nil {
+		return nil, err
+	}
+
+	bank.ledgerLock.Lock()
+	defer bank.ledgerLock.Unlock()
+
+	entries := []LedgerEntry{}
+	for _, entry := range bank.ledger {
+		if entry.AccountID == accountID {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// Returns the ledger entry with the specified transaction ID, and
+// whether such an entry was found
+func (bank *Bank) findLedgerEntry(txID string) (LedgerEntry, bool) {
+	bank.ledgerLock.Lock()
+	defer bank.ledgerLock.Unlock()
+
+	for _, entry := range bank.ledger {
+		if entry.TransactionID == txID {
+			return entry, true
+		}
+	}
+
+	return LedgerEntry{}, false
+}
+
+// Appends an entry to the ledger recording an operation that has
+// already been applied to the account, and returns that entry. The
+// account ID, currency, resulting balance, and timestamp are filled
+// in from the account, whose version is incremented.
+func (bank *Bank) appendToLedger(acct *account, entry LedgerEntry) LedgerEntry {
+	acct.Version++
+	entry.AccountID = acct.ID
+	entry.Currency = acct.Currency
+	entry.Balance = acct.Balance
+	entry.Timestamp = bank.now().UTC()
+
+	bank.ledgerLock.Lock()
+	bank.ledger = append(bank.ledger, entry)
+	bank.ledgerLock.Unlock()
+
+	return entry
+}
+
+// Returns a copy of the entry that records the conversion of an amount
+// originally given in another currency; a nil conversion has no effect
+func (entry LedgerEntry) withConversion(fx *conversion) LedgerEntry {
+	if fx != nil {
+		entry.OriginalAmount = fx.OriginalAmount
+		entry.OriginalCurrency = fx.OriginalCurrency
+		entry.ExchangeRate = fx.Rate
+		entry.ConversionFee = fx.Fee
+	}
+
+	return entry
+}
+
+// Checks the loaded ledger against the loaded account balances. The
+// ledger is authoritative: each account's balance is replaced by the
+// one derived from its entries, and a mismatch with the persisted
+// balance is logged. Accounts that have a balance but no entries (as
+// with data files written before the ledger existed) are given an
+// opening balance entry, which is saved immediately so that its
+// transaction ID is stable across sessions. This returns an error if
+// the ledger itself is inconsistent, such as an entry whose recorded
+// balance does not follow from the entries before it.
+func (bank *Bank) reconcileLedger() error {
+	derived := make(map[string]Money)
+	for _, entry := range bank.ledger {
+		derived[entry.AccountID] += entry.delta()
+		if derived[entry.AccountID] != entry.Balance {
+			msg := "ledger entry %s for account '%s' records balance $%s, but entries sum to $%s"
+			return fmt.Errorf(msg, entry.TransactionID, entry.AccountID, entry.Balance, derived[entry.AccountID])
+		}
+	}
+
+	openingBalancesRecorded := false
+	for id, acct := range bank.accounts {
+		balance, hasEntries := derived[id]
+		if !hasEntries {
+			if acct.Balance != 0 {
+				txID := generateTransactionID("O", 10)
+				bank.appendToLedger(acct, LedgerEntry{
+					TransactionID: txID,
+					Type:          TransactionOpeningBalance,
+					Amount:        acct.Balance,
+				})
+				log.Printf("Recorded opening balance %s for account '%s' (ID: %s)", acct.Balance, id, txID)
+				openingBalancesRecorded = true
+			}
+			continue
+		}
+
+		if balance != acct.Balance {
+			msg := "WARNING: persisted balance $%s for account '%s' does not match ledger; using $%s"
+			log.Printf(msg, acct.Balance, id, balance)
+			acct.Balance = balance
+		}
+	}
+
+	if openingBalancesRecorded {
+		return bank.save()
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package banking
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestLedgerRecordsEachOperation(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	if err := bank.OpenAccount("savings", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	depositID, err := bank.Deposit(Dollars(100), "first-deposit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	withdrawalID, err := bank.Withdraw(Dollars(30), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bank.DepositToAccount("savings", Dollars(10), "", "", AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	secondDepositID, err := bank.Deposit(Cents(550), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []LedgerEntry{
+		{TransactionID: depositID, Type: TransactionDeposit, Amount: Dollars(100), Balance: Dollars(100), IdempotencyKey: "first-deposit"},
+		{TransactionID: withdrawalID, Type: TransactionWithdrawal, Amount: Dollars(30), Balance: Dollars(70)},
+		{TransactionID: secondDepositID, Type: TransactionDeposit, Amount: Cents(550), Balance: Cents(7550)},
+	}
+	entries, err := bank.GetLedger(DefaultAccountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("ledger has %d entries for the default account, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i, entry := range entries {
+		expected := want[i]
+		if entry.TransactionID != expected.TransactionID || entry.Type != expected.Type ||
+			entry.Amount != expected.Amount || entry.Balance != expected.Balance ||
+			entry.IdempotencyKey != expected.IdempotencyKey || entry.AccountID != DefaultAccountID {
+			t.Errorf("ledger entry %d is %+v, want %+v", i, entry, expected)
+		}
+		if entry.Timestamp.IsZero() {
+			t.Errorf("ledger entry %d has no timestamp", i)
+		}
+	}
+
+	var notFound AccountNotFoundError
+	if _, err := bank.GetLedger("missing"); !errors.As(err, &notFound) {
+		t.Errorf("ledger of unknown account returned %v, want an AccountNotFoundError", err)
+	}
+	checkLedger(t, bank)
+}
+
+func TestReconcileLedger(t *testing.T) {
+	discardLogOutput(t)
+	path := filepath.Join(t.TempDir(), "bank-test.dat")
+
+	// an account saved with a balance but no entries, as before the
+	// ledger existed
+	bank := NewBankWithStorage("test", NewFileStorage(path))
+	if _, err := bank.Deposit(Dollars(25), ""); err != nil {
+		t.Fatal(err)
+	}
+	bank.accounts["legacy"] = &account{ID: "legacy", Currency: DefaultCurrency, Balance: Dollars(40), Version: 1}
+	if err := bank.save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bank.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// it is given an opening balance entry, whose ID does not change
+	var openingID string
+	for session := 0; session < 2; session++ {
+		bank = NewBankWithStorage("test", NewFileStorage(path))
+		entries, err := bank.GetLedger("legacy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Type != TransactionOpeningBalance || entries[0].Amount != Dollars(40) {
+			t.Fatalf("ledger of legacy account is %+v, want an opening balance of 40.00", entries)
+		}
+		if session > 0 && entries[0].TransactionID != openingID {
+			t.Errorf("opening balance entry has ID %s after restart, want %s", entries[0].TransactionID, openingID)
+		}
+		openingID = entries[0].TransactionID
+		checkLedger(t, bank)
+
+		if err := bank.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a persisted balance that does not match the ledger is corrected,
+	// but entries that do not follow from each other are an error
+	bank = NewBankWithStorage("test", NewFileStorage(path))
+	t.Cleanup(func() { bank.Close() })
+
+	bank.accounts[DefaultAccountID].Balance = Dollars(1000)
+	if err := bank.reconcileLedger(); err != nil {
+		t.Fatal(err)
+	}
+	if balance := bank.GetBalance(); balance != Dollars(25) {
+		t.Errorf("balance after reconciling is %s, want 25.00 from the ledger", balance)
+	}
+
+	bank.ledger[0].Balance = Dollars(30)
+	if err := bank.reconcileLedger(); err == nil {
+		t.Error("reconciled a ledger whose entries do not sum to their recorded balances")
+	}
+}
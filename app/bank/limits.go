@@ -0,0 +1,159 @@
+package banking
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// AccountLimits restricts the amounts that may be deposited to or
+// withdrawn from an account, in the account's currency. A limit of zero
+// means that there is no limit. The withdrawal limits also apply to
+// holds, both when they are placed and when they are captured, since a
+// capture withdraws from the account. Daily totals cover the current
+// calendar day in UTC, and include every deposit, withdrawal or capture
+// posted to the account that day; reversals do not reduce them.
+type AccountLimits struct {
+	MaxWithdrawal   Money `json:"maxWithdrawal,omitempty"`   // largest single withdrawal
+	DailyWithdrawal Money `json:"dailyWithdrawal,omitempty"` // total withdrawn per day
+	DailyDeposit    Money `json:"dailyDeposit,omitempty"`    // total deposited per day
+}
+
+// GetAccountLimits returns the limits on deposits to and withdrawals
+// from the specified account, or an AccountNotFoundError if there is no
+// such account.
+func (bank *Bank) GetAccountLimits(accountID string) (AccountLimits, error) {
+	bank.lock.RLock()
+	defer bank.lock.RUnlock()
+
+	acct, err := bank.getAccount(accountID)
+	if err != nil {
+		return AccountLimits{}, err
+	}
+
+	return acct.Limits, nil
+}
+
+// SetAccountLimits replaces the limits on deposits to and withdrawals
+// from the specified account. Lowering a daily limit below the amount
+// already deposited or withdrawn today prevents further operations of
+// that kind until the next day. It returns an error if any limit is
+// negative or an AccountNotFoundError if there is no such account.
+func (bank *Bank) SetAccountLimits(accountID string, limits AccountLimits) error {
+	_, err := bank.UpdateAccountLimits(accountID, func(current *AccountLimits) {
+		*current = limits
+	})
+	return err
+}
+
+// UpdateAccountLimits calls update with the current limits on the
+// specified account and saves the limits it leaves, returning them. The
+// account is locked throughout, so that changes to some of the limits
+// are not lost to a concurrent change to the others. It returns the
+// same errors as SetAccountLimits.
+func (bank *Bank) UpdateAccountLimits(accountID string, update func(limits *AccountLimits)) (AccountLimits, error) {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	acct, err := bank.getAccount(accountID)
+	if err != nil {
+		return AccountLimits{}, err
+	}
+
+	limits := acct.Limits
+	update(&limits)
+	if limits.MaxWithdrawal < 0 || limits.DailyWithdrawal < 0 || limits.DailyDeposit < 0 {
+		return AccountLimits{}, fmt.Errorf("invalid account limits: %s", limits)
+	}
+
+	acct.Limits = limits
+	acct.Version++
+
+	err = bank.commit(walRecord{Accounts: []account{*acct}})
+	if err != nil {
+		log.Printf("ERROR: could not save account data following limits change: %v\n", err)
+		return AccountLimits{}, err
+	}
+
+	log.Printf("Set limits for '%s' account '%s' to %s (%s)", bank.name, accountID, limits, acct.Currency)
+	return limits, nil
+}
+
+func (limits AccountLimits) String() string {
+	return fmt.Sprintf("max-withdrawal=%s daily-withdrawal=%s daily-deposit=%s",
+		limits.MaxWithdrawal, limits.DailyWithdrawal, limits.DailyDeposit)
+}
+
+// Returns a LimitExceededError if depositing the amount to the account
+// at the specified time would exceed its daily deposit limit
+func (bank *Bank) checkDepositLimits(acct *account, credit Money, now time.Time) error {
+	limit := acct.Limits.DailyDeposit
+	if limit == 0 {
+		return nil
+	}
+
+	deposited := bank.dailyTotal(acct.ID, now, TransactionDeposit)
+	if credit <= limit-deposited {
+		return nil
+	}
+
+	msg := "deposit amount %s %s would exceed daily deposit limit %s %s (%s %s already deposited today)"
+	return LimitExceededError{message: fmt.Sprintf(msg, credit, acct.Currency,
+		limit, acct.Currency, deposited, acct.Currency)}
+}
+
+// Returns a LimitExceededError if withdrawing the amount from the
+// account at the specified time would exceed its maximum withdrawal or
+// its daily withdrawal limit. Captured holds count toward the daily
+// total, as they are withdrawals made in two steps.
+func (bank *Bank) checkWithdrawalLimits(acct *account, debit Money, now time.Time) error {
+	if maximum := acct.Limits.MaxWithdrawal; maximum > 0 && debit > maximum {
+		msg := "withdrawal amount %s %s exceeds maximum withdrawal %s %s"
+		return LimitExceededError{message: fmt.Sprintf(msg, debit, acct.Currency, maximum, acct.Currency)}
+	}
+
+	limit := acct.Limits.DailyWithdrawal
+	if limit == 0 {
+		return nil
+	}
+
+	withdrawn := bank.dailyTotal(acct.ID, now, TransactionWithdrawal, TransactionCapture)
+	if debit <= limit-withdrawn {
+		return nil
+	}
+
+	msg := "withdrawal amount %s %s would exceed daily withdrawal limit %s %s (%s %s already withdrawn today)"
+	return LimitExceededError{message: fmt.Sprintf(msg, debit, acct.Currency,
+		limit, acct.Currency, withdrawn, acct.Currency)}
+}
+
+// Returns the total amount of the ledger entries of the specified types
+// posted to the account on the same UTC day as the specified time.
+// Entries are appended in the order they are posted, so this only
+// examines those at the end of the ledger.
+func (bank *Bank) dailyTotal(accountID string, now time.Time, txTypes ...TransactionType) Money {
+	startOfDay := now.UTC().Truncate(24 * time.Hour)
+
+	bank.ledgerLock.Lock()
+	defer bank.ledgerLock.Unlock()
+
+	var total Money
+	for i := len(bank.ledger) - 1; i >= 0; i-- {
+		entry := bank.ledger[i]
+		if entry.Timestamp.Before(startOfDay) {
+			break
+		}
+
+		if entry.AccountID != accountID {
+			continue
+		}
+		for _, txType := range txTypes {
+			if entry.Type == txType {
+				total += entry.Amount
+				break
+			}
+		}
+	}
+
+	return total
+}
@@ -0,0 +1,94 @@
+package banking
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithdrawalLimitsApplyToHolds(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	clock := &fakeClock{now: time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)}
+	bank.SetClock(clock)
+	if _, err := bank.Deposit(Dollars(1000), ""); err != nil {
+		t.Fatal(err)
+	}
+	limits := AccountLimits{MaxWithdrawal: Dollars(100), DailyWithdrawal: Dollars(150)}
+	if err := bank.SetAccountLimits(DefaultAccountID, limits); err != nil {
+		t.Fatal(err)
+	}
+
+	var exceeded LimitExceededError
+	if _, err := bank.AuthorizeHold(DefaultAccountID, Dollars(120), ""); !errors.As(err, &exceeded) {
+		t.Errorf("hold above the maximum withdrawal returned %v, want a LimitExceededError", err)
+	}
+
+	// each hold is within the limits when placed, but capturing both
+	// would exceed the daily total
+	first, err := bank.AuthorizeHold(DefaultAccountID, Dollars(90), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := bank.AuthorizeHold(DefaultAccountID, Dollars(90), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bank.CaptureHold(first, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bank.CaptureHold(second, 0, ""); !errors.As(err, &exceeded) {
+		t.Errorf("capture past the daily limit returned %v, want a LimitExceededError", err)
+	}
+
+	// the capture counts toward the daily total for withdrawals and holds
+	if _, err := bank.Withdraw(Dollars(70), ""); !errors.As(err, &exceeded) {
+		t.Errorf("withdrawal past the daily limit after a capture returned %v, want a LimitExceededError", err)
+	}
+	if _, err := bank.AuthorizeHold(DefaultAccountID, Dollars(70), ""); !errors.As(err, &exceeded) {
+		t.Errorf("hold past the daily limit after a capture returned %v, want a LimitExceededError", err)
+	}
+	if _, err := bank.CaptureHold(second, Dollars(60), ""); err != nil {
+		t.Errorf("partial capture within the daily limit failed: %v", err)
+	}
+
+	clock.Advance(24 * time.Hour)
+	if _, err := bank.Withdraw(Dollars(100), ""); err != nil {
+		t.Errorf("withdrawal on the next day failed: %v", err)
+	}
+	if balance := bank.GetBalance(); balance != Dollars(750) {
+		t.Errorf("balance is %s, want 750.00", balance)
+	}
+	checkLedger(t, bank)
+}
+
+func TestUpdateAccountLimits(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	if err := bank.SetAccountLimits(DefaultAccountID, AccountLimits{DailyDeposit: Dollars(500)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// each update sees the limits left by the one before it, so none of
+	// the concurrent changes is lost
+	runConcurrently(10, func(client int) {
+		for i := 0; i < 10; i++ {
+			if _, err := bank.UpdateAccountLimits(DefaultAccountID, func(limits *AccountLimits) {
+				limits.MaxWithdrawal += Dollars(1)
+			}); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	want := AccountLimits{MaxWithdrawal: Dollars(100), DailyDeposit: Dollars(500)}
+	if limits, err := bank.GetAccountLimits(DefaultAccountID); err != nil || limits != want {
+		t.Errorf("limits after concurrent updates are %s (error: %v), want %s", limits, err, want)
+	}
+
+	if _, err := bank.UpdateAccountLimits(DefaultAccountID, func(limits *AccountLimits) {
+		limits.DailyWithdrawal = Dollars(-1)
+	}); err == nil {
+		t.Error("update to a negative limit succeeded")
+	}
+	if limits, err := bank.GetAccountLimits(DefaultAccountID); err != nil || limits != want {
+		t.Errorf("limits after rejected update are %s (error: %v), want %s", limits, err, want)
+	}
+}
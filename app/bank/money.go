@@ -0,0 +1,126 @@
+package banking
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount of money, stored in minor units (cents) so
+// that amounts such as $19.99 are represented without rounding error.
+// Use Dollars, Cents, or ParseMoney to create a value; note that an
+// untyped constant such as 100 is interpreted as cents, not dollars.
+type Money int64
+
+// MaxMoney is the largest amount that can be represented
+const MaxMoney = Money(math.MaxInt64)
+
+// Dollars returns the Money value for a whole number of dollars. It
+// panics if the amount is too large to be represented, rather than
+// silently wrapping around.
+func Dollars(dollars int64) Money {
+	if dollars > math.MaxInt64/100 || dollars < math.MinInt64/100 {
+		panic(fmt.Sprintf("amount overflow: %d dollars", dollars))
+	}
+
+	return Money(dollars * 100)
+}
+
+// Cents returns the Money value for a number of cents
+func Cents(cents int64) Money {
+	return Money(cents)
+}
+
+// ParseMoney converts a decimal string, such as "12", "12.3", or
+// "12.34", into Money. It returns an error if the string is not a
+// valid amount, has more than two decimal places, or is too large
+// to be represented.
+func ParseMoney(s string) (Money, error) {
+	text := strings.TrimSpace(s)
+	negative := strings.HasPrefix(text, "-")
+	text = strings.TrimPrefix(text, "-")
+
+	whole, fraction, hasFraction := strings.Cut(text, ".")
+	if whole == "" || (hasFraction && (fraction == "" || len(fraction) > 2)) {
+		return 0, fmt.Errorf("invalid amount: '%s'", s)
+	}
+
+	for _, c := range whole + fraction {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("invalid amount: '%s'", s)
+		}
+	}
+
+	dollars, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || dollars > math.MaxInt64/100-1 {
+		return 0, fmt.Errorf("amount is too large: '%s'", s)
+	}
+
+	cents := int64(0)
+	if hasFraction {
+		cents, _ = strconv.ParseInt(fraction, 10, 64)
+		if len(fraction) == 1 {
+			cents = cents * 10
+		}
+	}
+
+	amount := Money(dollars*100 + cents)
+	if negative {
+		amount = -amount
+	}
+
+	return amount, nil
+}
+
+// Add returns the sum of the two amounts, or an error if the result
+// would overflow.
+func (m Money) Add(other Money) (Money, error) {
+	if (other > 0 && m > MaxMoney-other) || (other < 0 && m < -MaxMoney-other) {
+		return 0, fmt.Errorf("amount overflow: $%s + $%s", m, other)
+	}
+
+	return m + other, nil
+}
+
+// Sub returns the difference of the two amounts, or an error if the
+// result would overflow.
+func (m Money) Sub(other Money) (Money, error) {
+	if other == -MaxMoney-1 {
+		return 0, fmt.Errorf("amount overflow: $%s - $%s", m, other)
+	}
+
+	return m.Add(-other)
+}
+
+// String formats the amount as a decimal number with two decimal
+// places, such as "19.99" or "-0.05", without a currency symbol.
+func (m Money) String() string {
+	sign := ""
+	cents := uint64(m)
+	if m < 0 {
+		sign = "-"
+		cents = uint64(-(m + 1)) + 1
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// MarshalJSON encodes the amount as a JSON number with two decimal
+// places, so that persisted data remains readable in dollars.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON decodes a JSON number (or string) in dollars, such as
+// 12.34. Whole numbers, as written before amounts included cents, are
+// interpreted as dollars.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	amount, err := ParseMoney(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+
+	*m = amount
+	return nil
+}
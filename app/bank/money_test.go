@@ -0,0 +1,115 @@
+package banking
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	valid := map[string]Money{
+		"12":                   Cents(1200),
+		"12.3":                 Cents(1230),
+		"12.34":                Cents(1234),
+		"0.05":                 Cents(5),
+		"-0.05":                Cents(-5),
+		"-12.34":               Cents(-1234),
+		" 7 ":                  Cents(700),
+		"007.10":               Cents(710),
+		"92233720368547757.99": Money(9223372036854775799),
+	}
+	for text, want := range valid {
+		if amount, err := ParseMoney(text); err != nil || amount != want {
+			t.Errorf("ParseMoney(%q) returned (%d, %v), want %d", text, amount, err, want)
+		}
+	}
+
+	invalid := []string{"", "-", ".5", "12.", "12.345", "1.2.3", "1e3", "1,000", "+1", "--1", "abc", "$5",
+		"92233720368547758", "99999999999999999999"}
+	for _, text := range invalid {
+		if amount, err := ParseMoney(text); err == nil {
+			t.Errorf("ParseMoney(%q) returned %d, want an error", text, amount)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	amounts := map[Money]string{
+		0:                      "0.00",
+		Cents(5):               "0.05",
+		Cents(-5):              "-0.05",
+		Cents(1999):            "19.99",
+		Dollars(-3):            "-3.00",
+		MaxMoney:               "92233720368547758.07",
+		Money(math.MinInt64):   "-92233720368547758.08",
+		Dollars(1000000) + 1:   "1000000.01",
+		Cents(-123456789) - 10: "-1234567.99",
+	}
+	for amount, want := range amounts {
+		if text := amount.String(); text != want {
+			t.Errorf("String of %d cents is %q, want %q", int64(amount), text, want)
+		}
+	}
+}
+
+func TestMoneyArithmeticChecksOverflow(t *testing.T) {
+	if sum, err := Cents(1999).Add(Cents(1)); err != nil || sum != Dollars(20) {
+		t.Errorf("19.99 + 0.01 returned (%s, %v), want 20.00", sum, err)
+	}
+	if difference, err := Dollars(5).Sub(Dollars(7)); err != nil || difference != Dollars(-2) {
+		t.Errorf("5.00 - 7.00 returned (%s, %v), want -2.00", difference, err)
+	}
+
+	overflows := []func() (Money, error){
+		func() (Money, error) { return MaxMoney.Add(Cents(1)) },
+		func() (Money, error) { return (-MaxMoney).Add(Cents(-2)) },
+		func() (Money, error) { return (-MaxMoney).Sub(Cents(2)) },
+		func() (Money, error) { return Cents(0).Sub(Money(math.MinInt64)) },
+	}
+	for i, overflow := range overflows {
+		if amount, err := overflow(); err == nil {
+			t.Errorf("operation %d returned %s, want an overflow error", i, amount)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	encoded, err := json.Marshal(struct{ Amount Money }{Cents(1234)})
+	if err != nil || string(encoded) != `{"Amount":12.34}` {
+		t.Errorf("encoded 12.34 as %s (error: %v)", encoded, err)
+	}
+
+	// whole numbers, as written before amounts had cents, are dollars
+	for text, want := range map[string]Money{`12.34`: Cents(1234), `"0.10"`: Cents(10), `12`: Dollars(12)} {
+		var amount Money
+		if err := json.Unmarshal([]byte(text), &amount); err != nil || amount != want {
+			t.Errorf("decoded %s as (%s, %v), want %s", text, amount, err, want)
+		}
+	}
+
+	var amount Money
+	if err := json.Unmarshal([]byte(`1.234`), &amount); err == nil {
+		t.Errorf("decoded 1.234 as %s, want an error", amount)
+	}
+}
+
+func TestDollarsPanicsOnOverflow(t *testing.T) {
+	largest := int64(math.MaxInt64 / 100)
+	if amount := Dollars(largest); amount != Money(largest*100) {
+		t.Errorf("Dollars(%d) is %s, want %d cents", largest, amount, largest*100)
+	}
+	if amount := Dollars(-largest); amount != Money(-largest*100) {
+		t.Errorf("Dollars(%d) is %s, want %d cents", -largest, amount, -largest*100)
+	}
+
+	for _, dollars := range []int64{largest + 1, -largest - 1, math.MaxInt64, math.MinInt64} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Dollars(%d) did not panic", dollars)
+				}
+			}()
+			Dollars(dollars)
+		}()
+	}
+}
@@ -0,0 +1,145 @@
+package banking
+
+import (
+	"fmt"
+	"log"
+)
+
+// identifies requests to reverse a transaction in idempotency
+// fingerprints; the reversal itself is recorded in the ledger as a
+// DEPOSIT_REVERSAL or WITHDRAWAL_REVERSAL
+const reversalRequest TransactionType = "REVERSAL"
+
+// ReverseTransaction posts a compensating ledger entry that undoes all
+// or part of an earlier deposit, withdrawal, or capture, identified by
+// its transaction ID. The amount is in the account's currency; an
+// amount of zero reverses whatever has not already been reversed. A
+// transaction may be reversed in several parts, but never by more than
+// its original amount in total. Reversing a deposit removes the money
+// from the account, so it requires the account to be open and have the
+// available funds, while reversing a withdrawal requires only that the
+// account is not closed. The idempotency key is used to identify
+// duplicate requests. This returns the transaction ID of the reversal
+// if successful, or will return a TransactionNotFoundError if there is
+// no such transaction, or an error if it cannot be reversed.
+func (bank *Bank) ReverseTransaction(txID string, amount Money, idempotencyKey string) (string, error) {
+	if amount < 0 {
+		return "", fmt.Errorf("Invalid amount: %s", amount)
+	}
+
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	original, found := bank.findLedgerEntry(txID)
+	if !found {
+		msg := fmt.Sprintf("no transaction with ID '%s' at '%s' bank", txID, bank.name)
+		return "", TransactionNotFoundError{message: msg}
+	}
+
+	// check idempotency key, only process the reversal if it's unique. If
+	// it's a duplicate, return the transaction ID from the original reversal.
+	fingerprint := fmt.Sprintf("%s %s tx=%s", reversalRequest, amount, txID)
+	if idempotencyKey != "" {
+		previousTxID, keyExists, err := bank.lookupRequest(idempotencyKey, fingerprint)
+		if err != nil {
+			return "", err
+		}
+		if keyExists {
+			msg := "Duplicate request for idempotency key '%s', returning txID: '%s'"
+			log.Printf(msg, idempotencyKey, previousTxID)
+			return previousTxID, nil
+		}
+	}
+
+	var reversalType TransactionType
+	switch original.Type {
+	case TransactionDeposit:
+		reversalType = TransactionDepositReversal
+	case TransactionWithdrawal, TransactionCapture:
+		reversalType = TransactionWithdrawalReversal
+	default:
+		return "", fmt.Errorf("transaction '%s' is a %s, which cannot be reversed", txID, original.Type)
+	}
+
+	acct, err := bank.getAccount(original.AccountID)
+	if err != nil {
+		return "", err
+	}
+
+	remaining := original.Amount - bank.reversedAmount(txID)
+	if remaining == 0 {
+		return "", fmt.Errorf("transaction '%s' has already been fully reversed", txID)
+	}
+
+	if amount == 0 {
+		amount = remaining
+	}
+
+	if amount > remaining {
+		msg := "reversal amount %s %s exceeds the %s %s of transaction '%s' that has not been reversed"
+		return "", fmt.Errorf(msg, amount, acct.Currency, remaining, acct.Currency, txID)
+	}
+
+	if reversalType == TransactionDepositReversal {
+		err = acct.checkCanWithdraw()
+		if err != nil {
+			return "", err
+		}
+
+		err = acct.checkFunds(amount, bank.heldAmount(acct.ID, bank.now()))
+		if err != nil {
+			return "", err
+		}
+		acct.Balance = acct.Balance - amount
+	} else {
+		err = acct.checkCanDeposit()
+		if err != nil {
+			return "", err
+		}
+
+		newBalance, err := acct.Balance.Add(amount)
+		if err != nil {
+			return "", err
+		}
+		acct.Balance = newBalance
+	}
+
+	reversalTxID := generateTransactionID("R", 10)
+	entry := bank.appendToLedger(acct, LedgerEntry{
+		TransactionID:  reversalTxID,
+		Type:           reversalType,
+		Amount:         amount,
+		IdempotencyKey: idempotencyKey,
+		ReversalOf:     txID,
+	})
+	bank.recordRequest(idempotencyKey, reversalTxID, fingerprint)
+
+	err = bank.commit(walRecord{
+		Accounts: []account{*acct},
+		Ledger:   []LedgerEntry{entry},
+		Requests: bank.requestRecords(idempotencyKey),
+	})
+	if err != nil {
+		log.Printf("ERROR: could not save account data following reversal: %v\n", err)
+		return "", err
+	}
+
+	log.Printf("Reversed %s %s of transaction %s in '%s' account '%s' (ID: %s)",
+		amount, acct.Currency, txID, bank.name, acct.ID, reversalTxID)
+	return reversalTxID, nil
+}
+
+// Returns the total amount by which the transaction has been reversed
+func (bank *Bank) reversedAmount(txID string) Money {
+	bank.ledgerLock.Lock()
+	defer bank.ledgerLock.Unlock()
+
+	reversed := Money(0)
+	for _, entry := range bank.ledger {
+		if entry.ReversalOf == txID {
+			reversed = reversed + entry.Amount
+		}
+	}
+
+	return reversed
+}
@@ -0,0 +1,99 @@
+package banking
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReverseTransaction(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	depositID, err := bank.Deposit(Dollars(100), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	withdrawalID, err := bank.Withdraw(Dollars(30), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a deposit may be reversed in parts, and a retried reversal is
+	// only made once
+	firstID, err := bank.ReverseTransaction(depositID, Dollars(40), "reverse-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retriedID, err := bank.ReverseTransaction(depositID, Dollars(40), "reverse-key"); err != nil || retriedID != firstID {
+		t.Errorf("retried reversal returned (%s, %v), want (%s, nil)", retriedID, err, firstID)
+	}
+	var conflict IdempotencyConflictError
+	if _, err := bank.ReverseTransaction(depositID, Dollars(20), "reverse-key"); !errors.As(err, &conflict) {
+		t.Errorf("reversal reusing key for another amount returned %v, want an IdempotencyConflictError", err)
+	}
+	if balance := bank.GetBalance(); balance != Dollars(30) {
+		t.Errorf("balance after partial reversal is %s, want 30.00", balance)
+	}
+	if entry, found := bank.findLedgerEntry(firstID); !found || entry.Type != TransactionDepositReversal || entry.ReversalOf != depositID {
+		t.Errorf("ledger entry for reversal is %+v, want a reversal of %s", entry, depositID)
+	}
+
+	// but never by more than the original amount in total
+	if _, err := bank.ReverseTransaction(depositID, Cents(6001), ""); err == nil {
+		t.Error("reversed more of the deposit than had not been reversed")
+	}
+
+	// an amount of zero reverses the rest, after which nothing remains
+	if _, err := bank.ReverseTransaction(withdrawalID, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bank.ReverseTransaction(withdrawalID, 0, ""); err == nil {
+		t.Error("reversed a withdrawal twice")
+	}
+	if _, err := bank.ReverseTransaction(withdrawalID, Cents(1), ""); err == nil {
+		t.Error("reversed more of a withdrawal than its amount")
+	}
+	if _, err := bank.ReverseTransaction(depositID, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bank.ReverseTransaction(depositID, 0, ""); err == nil {
+		t.Error("reversed a deposit twice")
+	}
+	if balance := bank.GetBalance(); balance != 0 {
+		t.Errorf("balance after reversing everything is %s, want 0.00", balance)
+	}
+
+	if _, err := bank.ReverseTransaction(firstID, 0, ""); err == nil {
+		t.Error("reversed a reversal")
+	}
+	var notFound TransactionNotFoundError
+	if _, err := bank.ReverseTransaction("D0000000000", 0, ""); !errors.As(err, &notFound) {
+		t.Errorf("reversing unknown transaction returned %v, want a TransactionNotFoundError", err)
+	}
+	checkLedger(t, bank)
+}
+
+func TestReversingDepositRequiresFunds(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	client, _ := newTestClient(t, bank)
+
+	depositID, err := client.Deposit(Dollars(10), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Withdraw(Dollars(8), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var insufficientFunds InsufficientFundsError
+	if _, err := client.ReverseTransaction(depositID, 0, ""); !errors.As(err, &insufficientFunds) {
+		t.Errorf("reversing deposit that was spent returned %v, want an InsufficientFundsError", err)
+	}
+	if _, err := client.ReverseTransaction(depositID, Dollars(2), ""); err != nil {
+		t.Errorf("reversing the unspent part of a deposit failed: %v", err)
+	}
+
+	var notFound TransactionNotFoundError
+	if _, err := client.ReverseTransaction("D0000000000", 0, ""); !errors.As(err, &notFound) {
+		t.Errorf("reversing unknown transaction returned %v, want a TransactionNotFoundError", err)
+	}
+	checkLedger(t, bank)
+}
@@ -0,0 +1,306 @@
+package banking
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReviewStatus identifies the state of a review
+type ReviewStatus string
+
+const (
+	// ReviewPending means the transaction is waiting to be approved or
+	// declined by an administrator
+	ReviewPending ReviewStatus = "PENDING"
+	// ReviewApproved means the transaction was approved and has been made
+	ReviewApproved ReviewStatus = "APPROVED"
+	// ReviewDeclined means the transaction was declined and will never
+	// be made
+	ReviewDeclined ReviewStatus = "DECLINED"
+)
+
+// Review is a deposit, withdrawal or hold that was held by one of the
+// bank's fraud rules (see FraudRules) until an administrator approves or
+// declines it. When it is approved, the transaction is made with its
+// idempotency key, without evaluating the fraud rules again, so a
+// retried request returns the ID of that transaction, or of the hold. A request made
+// without an idempotency key is given one when it is held.
+type Review struct {
+	ID        string          `json:"id"`
+	AccountID string          `json:"accountID"`
+	Type      TransactionType `json:"type"` // TransactionDeposit or TransactionWithdrawal, TRANSFER for a transfer, or HOLD for a hold
+	Amount    Money           `json:"amount"`
+	Currency  string          `json:"currency,omitempty"` // the account's currency if empty
+	Rule      string          `json:"rule"`               // the name of the rule that held it
+	Reason    string          `json:"reason"`             // the condition of that rule
+	Status    ReviewStatus    `json:"status"`
+
+	// the outcome once it is approved or declined: when, the note given
+	// by the administrator, and the ID of the transaction if approved
+	Resolved      time.Time `json:"resolved"` // zero while pending
+	Note          string    `json:"note,omitempty"`
+	TransactionID string    `json:"txID,omitempty"`
+
+	Created        time.Time `json:"created"`
+	IdempotencyKey string    `json:"idempotencyKey"`
+}
+
+// Returns the fingerprint of the request that was held for review, as
+// recorded for its idempotency key once it is made
+func (review *Review) fingerprint() string {
+	return requestFingerprint(review.Type, review.AccountID, review.Amount, review.Currency)
+}
+
+// ParseReviewStatus returns the review status with the specified name,
+// such as "pending", regardless of case
+func ParseReviewStatus(name string) (ReviewStatus, error) {
+	status := ReviewStatus(strings.ToUpper(strings.TrimSpace(name)))
+	switch status {
+	case ReviewPending, ReviewApproved, ReviewDeclined:
+		return status, nil
+	}
+
+	return "", fmt.Errorf("invalid review status: '%s'", name)
+}
+
+// GetReview returns the review with the specified ID, or a
+// ReviewNotFoundError if there is no such review.
+func (bank *Bank) GetReview(reviewID string) (Review, error) {
+	bank.lock.RLock()
+	defer bank.lock.RUnlock()
+
+	review, err := bank.getReview(reviewID)
+	if err != nil {
+		return Review{}, err
+	}
+
+	bank.reviewsLock.Lock()
+	defer bank.reviewsLock.Unlock()
+
+	return *review, nil
+}
+
+// ListReviews returns the reviews with the specified status, or all
+// reviews if the status is empty, ordered by creation time.
+func (bank *Bank) ListReviews(status ReviewStatus) []Review {
+	bank.lock.RLock()
+	defer bank.lock.RUnlock()
+
+	bank.reviewsLock.Lock()
+	defer bank.reviewsLock.Unlock()
+
+	reviews := []Review{}
+	for _, review := range bank.reviews {
+		if status == "" || review.Status == status {
+			reviews = append(reviews, *review)
+		}
+	}
+
+	sort.Slice(reviews, func(i, j int) bool {
+		if !reviews[i].Created.Equal(reviews[j].Created) {
+			return reviews[i].Created.Before(reviews[j].Created)
+		}
+		return reviews[i].ID < reviews[j].ID
+	})
+
+	return reviews
+}
+
+// ApproveReview approves the pending review with the specified ID, with
+// an optional note, and makes the deposit or withdrawal, or places the
+// hold, that it holds, returning the ID of the transaction or hold. If
+// that fails, such as for insufficient funds or because the account has
+// since been frozen, this returns the error and the review remains
+// pending, so that it may be approved again later or declined. It
+// returns an error if the review is not pending, or a
+// ReviewNotFoundError if there is no such review.
+func (bank *Bank) ApproveReview(reviewID string, note string) (string, error) {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	review, err := bank.getReview(reviewID)
+	if err != nil {
+		return "", err
+	}
+
+	// the transaction checks for an approved review with its key, and is
+	// then made without evaluating the fraud rules again
+	bank.reviewsLock.Lock()
+	if review.Status != ReviewPending {
+		bank.reviewsLock.Unlock()
+		return "", fmt.Errorf("review '%s' cannot be approved because it is %s", reviewID, review.Status)
+	}
+	review.Status = ReviewApproved
+	request := *review
+	bank.reviewsLock.Unlock()
+
+	var txID string
+	switch request.Type {
+	case TransactionDeposit:
+		txID, err = bank.depositToAccount(request.AccountID, request.Amount, request.Currency, request.IdempotencyKey, AnyVersion)
+	case holdRequest:
+		txID, err = bank.authorizeHold(request.AccountID, request.Amount, request.IdempotencyKey)
+	default:
+		txID, err = bank.withdrawFromAccount(request.AccountID, request.Amount, request.Currency, request.IdempotencyKey, AnyVersion, request.Type)
+	}
+
+	// the bank's data is reloaded if a change could not be recorded
+	// while the transaction released lock, so the review is looked up
+	// again
+	review, lookupErr := bank.getReview(reviewID)
+	if lookupErr != nil {
+		return "", lookupErr
+	}
+
+	bank.reviewsLock.Lock()
+	if err != nil {
+		review.Status = ReviewPending
+		bank.reviewsLock.Unlock()
+		return "", err
+	}
+	review.Status = ReviewApproved
+	review.TransactionID = txID
+	review.Note = strings.TrimSpace(note)
+	review.Resolved = bank.now().UTC()
+	changed := *review
+	bank.reviewsLock.Unlock()
+
+	err = bank.commit(walRecord{Reviews: []Review{changed}})
+	if err != nil {
+		log.Printf("ERROR: could not save account data following review approval: %v\n", err)
+		return "", err
+	}
+
+	log.Printf("Review '%s' at '%s' bank approved, making transaction '%s'", reviewID, bank.name, txID)
+	return txID, nil
+}
+
+// DeclineReview declines the pending review with the specified ID, with
+// an optional note, so that the deposit or withdrawal that it holds is
+// never made; retrying the request returns a FraudSuspectedError. It
+// returns an error if the review is not pending, or a
+// ReviewNotFoundError if there is no such review.
+func (bank *Bank) DeclineReview(reviewID string, note string) error {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	review, err := bank.getReview(reviewID)
+	if err != nil {
+		return err
+	}
+
+	bank.reviewsLock.Lock()
+	if review.Status != ReviewPending {
+		bank.reviewsLock.Unlock()
+		return fmt.Errorf("review '%s' cannot be declined because it is %s", reviewID, review.Status)
+	}
+	review.Status = ReviewDeclined
+	review.Note = strings.TrimSpace(note)
+	review.Resolved = bank.now().UTC()
+	changed := *review
+	bank.reviewsLock.Unlock()
+
+	err = bank.commit(walRecord{Reviews: []Review{changed}})
+	if err != nil {
+		log.Printf("ERROR: could not save account data following review decline: %v\n", err)
+		return err
+	}
+
+	log.Printf("Review '%s' at '%s' bank declined", reviewID, bank.name)
+	return nil
+}
+
+// Holds the deposit or withdrawal described by the request for review,
+// and returns a PendingReviewError. The amount, in the account's
+// currency, is used in the error message. The caller must hold lock
+// exclusively.
+func (bank *Bank) queueForReview(acct *account, request Review, amount Money) error {
+	review := request
+	review.ID = generateTransactionID("V", 10)
+	review.Status = ReviewPending
+	review.Created = bank.now().UTC()
+	if review.IdempotencyKey == "" {
+		// the transaction is made with a key once approved, so that a
+		// retried approval cannot make it twice
+		review.IdempotencyKey = "review-" + review.ID
+	}
+
+	bank.reviewsLock.Lock()
+	bank.reviews[review.ID] = &review
+	bank.reviewsLock.Unlock()
+
+	err := bank.commit(walRecord{Reviews: []Review{review}})
+	if err != nil {
+		log.Printf("ERROR: could not save account data following review: %v\n", err)
+		return err
+	}
+
+	msg := fmt.Sprintf("%s of %s %s for account '%s' is held for review (ID: %s) by fraud rule '%s' (%s)",
+		strings.ToLower(string(review.Type)), amount, acct.Currency, acct.ID, review.ID, review.Rule, review.Reason)
+	log.Printf("Fraud check at '%s' bank: %s", bank.name, msg)
+	return PendingReviewError{message: msg, reviewID: review.ID}
+}
+
+// Checks whether an earlier request with the idempotency key was held
+// for review. If it was approved, this returns the ID of the transaction
+// that was made, or an empty ID while it is being made, and true, in
+// which case the fraud rules are not evaluated again. This returns a
+// PendingReviewError if the review is pending, a FraudSuspectedError if
+// it was declined, or an IdempotencyConflictError if the request held
+// for review had different parameters.
+func (bank *Bank) checkReview(idempotencyKey string, fingerprint string) (string, bool, error) {
+	if idempotencyKey == "" {
+		return "", false, nil
+	}
+
+	bank.reviewsLock.Lock()
+	defer bank.reviewsLock.Unlock()
+
+	for _, review := range bank.reviews {
+		if review.IdempotencyKey != idempotencyKey {
+			continue
+		}
+
+		if review.fingerprint() != fingerprint {
+			msg := "idempotency key '%s' was already used for a different request, held for review (ID: %s)"
+			return "", false, IdempotencyConflictError{message: fmt.Sprintf(msg, idempotencyKey, review.ID)}
+		}
+
+		switch review.Status {
+		case ReviewPending:
+			msg := "request with idempotency key '%s' is held for review (ID: %s) by fraud rule '%s' (%s)"
+			return "", false, PendingReviewError{
+				message:  fmt.Sprintf(msg, idempotencyKey, review.ID, review.Rule, review.Reason),
+				reviewID: review.ID,
+			}
+		case ReviewDeclined:
+			msg := fmt.Sprintf("request with idempotency key '%s' was declined on review (ID: %s)", idempotencyKey, review.ID)
+			if review.Note != "" {
+				msg += ": " + review.Note
+			}
+			return "", false, FraudSuspectedError{message: msg, rule: review.Rule}
+		}
+
+		return review.TransactionID, true, nil
+	}
+
+	return "", false, nil
+}
+
+// Returns the review with the specified ID, or a ReviewNotFoundError if
+// there is no such review.
+func (bank *Bank) getReview(reviewID string) (*Review, error) {
+	bank.reviewsLock.Lock()
+	defer bank.reviewsLock.Unlock()
+
+	review, exists := bank.reviews[reviewID]
+	if !exists {
+		msg := fmt.Sprintf("no review with ID '%s' at '%s' bank", reviewID, bank.name)
+		return nil, ReviewNotFoundError{message: msg}
+	}
+
+	return review, nil
+}
@@ -0,0 +1,548 @@
+package banking
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// how often the bank checks for scheduled payments that are due, once
+// it has been started
+const scheduleCheckInterval = time.Second
+
+// ScheduleStatus identifies the state of a schedule
+type ScheduleStatus string
+
+const (
+	// ScheduleActive means the schedule runs when it is next due
+	ScheduleActive ScheduleStatus = "ACTIVE"
+	// SchedulePaused means the schedule does not run until it is resumed
+	SchedulePaused ScheduleStatus = "PAUSED"
+	// ScheduleCancelled means the schedule will never run again
+	ScheduleCancelled ScheduleStatus = "CANCELLED"
+	// ScheduleCompleted means a schedule that does not recur has run,
+	// whether or not its transaction succeeded
+	ScheduleCompleted ScheduleStatus = "COMPLETED"
+)
+
+// Schedule is a standing order: a deposit or withdrawal that the bank
+// makes at a future time, either once or recurring. A recurring
+// schedule has either a cron expression (see parseCron), evaluated in
+// UTC, or a fixed interval between runs. Each run is made with an
+// idempotency key derived from the schedule ID and the run number, so
+// a run that was interrupted (such as by the service being stopped) is
+// not posted twice when it is retried: the retry finds the transaction
+// in the ledger, which keeps the key for good.
+type Schedule struct {
+	ID        string          `json:"id"`
+	AccountID string          `json:"accountID"`
+	Type      TransactionType `json:"type"` // TransactionDeposit or TransactionWithdrawal
+	Amount    Money           `json:"amount"`
+	Currency  string          `json:"currency,omitempty"` // the account's currency if empty
+	Cron      string          `json:"cron,omitempty"`
+	Every     time.Duration   `json:"every,omitempty"`
+	Status    ScheduleStatus  `json:"status"`
+	NextRun   time.Time       `json:"nextRun"` // zero once the schedule will not run again
+	Runs      int             `json:"runs"`    // number of times it has run
+
+	// the outcome of the most recent run: the ID of the transaction it
+	// made, or the reason it failed
+	LastTransactionID string `json:"lastTxID,omitempty"`
+	LastError         string `json:"lastError,omitempty"`
+
+	Created        time.Time `json:"created"`
+	IdempotencyKey string    `json:"idempotencyKey,omitempty"`
+}
+
+// Reports whether the schedule runs more than once
+func (schedule *Schedule) recurs() bool {
+	return schedule.Cron != "" || schedule.Every > 0
+}
+
+// Returns the time of the first run of a recurring schedule that is
+// after the specified time, or a zero time if there is none
+func (schedule *Schedule) nextRunAfter(t time.Time) time.Time {
+	if schedule.Every > 0 {
+		next := schedule.NextRun
+		if !next.After(t) {
+			// skip the runs that were missed, rather than making them all
+			missed := t.Sub(next)/schedule.Every + 1
+			next = next.Add(missed * schedule.Every)
+		}
+		return next
+	}
+
+	cron, err := parseCron(schedule.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	return cron.next(t)
+}
+
+// Returns the idempotency key for the schedule's next run
+func (schedule *Schedule) runIdempotencyKey() string {
+	return fmt.Sprintf("schedule-%s-run-%d", schedule.ID, schedule.Runs+1)
+}
+
+// ParseScheduleInterval converts an interval between the runs of a
+// schedule, given as a number of days (such as "7d") or a duration
+// (such as "12h" or "30s"), into a duration. It returns an error if the
+// interval is invalid or not positive.
+func ParseScheduleInterval(s string) (time.Duration, error) {
+	text := strings.TrimSpace(s)
+	var interval time.Duration
+	var err error
+	if days, isDays := strings.CutSuffix(text, "d"); isDays {
+		var count int
+		count, err = strconv.Atoi(days)
+		interval = time.Duration(count) * 24 * time.Hour
+	} else {
+		interval, err = time.ParseDuration(text)
+	}
+
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("invalid interval: '%s' (use a number of days such as 7d, or a duration such as 30s)", s)
+	}
+
+	return interval, nil
+}
+
+// CreateSchedule registers a standing order for the account, amount,
+// and type (TransactionDeposit or TransactionWithdrawal) of the
+// specified schedule, in its currency if set. If it has a cron
+// expression or an interval (Every), it recurs; otherwise, it runs
+// once, at its NextRun time. The first run of a recurring schedule is
+// at or after its NextRun time if set, and otherwise is the first that
+// follows the current time. Other fields of the schedule are ignored.
+// The idempotency key is used to identify duplicate requests. This
+// returns the schedule ID if successful, or an error if the account
+// does not exist or is closed, or the schedule is invalid.
+func (bank *Bank) CreateSchedule(schedule Schedule, idempotencyKey string) (string, error) {
+	if schedule.Type != TransactionDeposit && schedule.Type != TransactionWithdrawal {
+		return "", fmt.Errorf("invalid schedule type: '%s' (must be %s or %s)",
+			schedule.Type, TransactionDeposit, TransactionWithdrawal)
+	}
+
+	if schedule.Amount < Cents(1) {
+		return "", fmt.Errorf("Invalid amount: %s", schedule.Amount)
+	}
+
+	schedule.Currency = strings.ToUpper(schedule.Currency)
+	if schedule.Currency != "" && !isValidCurrency(schedule.Currency) {
+		return "", fmt.Errorf("invalid currency: '%s'", schedule.Currency)
+	}
+
+	if schedule.Cron != "" && schedule.Every != 0 {
+		return "", fmt.Errorf("a schedule may have a cron expression or an interval, but not both")
+	}
+
+	if schedule.Every < 0 {
+		return "", fmt.Errorf("invalid interval: %v", schedule.Every)
+	}
+
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	acct, err := bank.getAccount(schedule.AccountID)
+	if err != nil {
+		return "", err
+	}
+
+	// check idempotency key, only create the schedule if it's unique. If
+	// it's a duplicate, return the ID of the schedule created originally.
+	scheduleType := TransactionType("SCHEDULED_" + string(schedule.Type))
+	fingerprint := requestFingerprint(scheduleType, acct.ID, schedule.Amount, acct.foreignCurrency(schedule.Currency))
+	if idempotencyKey != "" {
+		previousID, keyExists, err := bank.lookupRequest(idempotencyKey, fingerprint)
+		if err != nil {
+			return "", err
+		}
+		if keyExists {
+			msg := "Duplicate request for idempotency key '%s', returning schedule ID: '%s'"
+			log.Printf(msg, idempotencyKey, previousID)
+			return previousID, nil
+		}
+	}
+
+	// a schedule may withdraw from a frozen account, although its runs
+	// fail until the account is open again, but not a closed one
+	err = acct.checkCanDeposit()
+	if err != nil {
+		return "", err
+	}
+
+	now := bank.now().UTC()
+	switch {
+	case schedule.Cron != "":
+		cron, err := parseCron(schedule.Cron)
+		if err != nil {
+			return "", err
+		}
+
+		after := now
+		if !schedule.NextRun.IsZero() {
+			after = schedule.NextRun.Add(-time.Nanosecond)
+		}
+		schedule.NextRun = cron.next(after)
+		if schedule.NextRun.IsZero() {
+			return "", fmt.Errorf("cron expression '%s' never matches", schedule.Cron)
+		}
+	case schedule.Every > 0:
+		if schedule.NextRun.IsZero() {
+			schedule.NextRun = now.Add(schedule.Every)
+		}
+	default:
+		if schedule.NextRun.IsZero() {
+			return "", fmt.Errorf("a schedule that does not recur must have a time to run")
+		}
+	}
+
+	schedule.ID = generateTransactionID("S", 10)
+	schedule.AccountID = acct.ID
+	schedule.NextRun = schedule.NextRun.UTC()
+	schedule.Status = ScheduleActive
+	schedule.Runs = 0
+	schedule.LastTransactionID = ""
+	schedule.LastError = ""
+	schedule.Created = now
+	schedule.IdempotencyKey = idempotencyKey
+
+	bank.schedulesLock.Lock()
+	bank.schedules[schedule.ID] = &schedule
+	bank.schedulesLock.Unlock()
+	bank.recordRequest(idempotencyKey, schedule.ID, fingerprint)
+
+	err = bank.commit(walRecord{
+		Schedules: []Schedule{schedule},
+		Requests:  bank.requestRecords(idempotencyKey),
+	})
+	if err != nil {
+		log.Printf("ERROR: could not save account data following schedule creation: %v\n", err)
+		return "", err
+	}
+
+	log.Printf("Scheduled %s of %s for '%s' account '%s' (ID: %s), next run at %s",
+		strings.ToLower(string(schedule.Type)), schedule.Amount, bank.name, acct.ID, schedule.ID,
+		schedule.NextRun.Format(time.RFC3339))
+	return schedule.ID, nil
+}
+
+// GetSchedule returns the schedule with the specified ID, or a
+// ScheduleNotFoundError if there is no such schedule.
+func (bank *Bank) GetSchedule(scheduleID string) (Schedule, error) {
+	bank.lock.RLock()
+	defer bank.lock.RUnlock()
+
+	schedule, err := bank.getSchedule(scheduleID)
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	bank.schedulesLock.Lock()
+	defer bank.schedulesLock.Unlock()
+
+	return *schedule, nil
+}
+
+// ListSchedules returns the schedules for the specified account, or
+// for all accounts if the account ID is empty, ordered by creation
+// time. Schedules that were cancelled or completed are included. It
+// returns an AccountNotFoundError if there is no such account.
+func (bank *Bank) ListSchedules(accountID string) ([]Schedule, error) {
+	bank.lock.RLock()
+	defer bank.lock.RUnlock()
+
+	if accountID != "" {
+		if _, err := bank.getAccount(accountID); err != nil {
+			return nil, err
+		}
+	}
+
+	bank.schedulesLock.Lock()
+	defer bank.schedulesLock.Unlock()
+
+	schedules := []Schedule{}
+	for _, schedule := range bank.schedules {
+		if accountID == "" || schedule.AccountID == accountID {
+			schedules = append(schedules, *schedule)
+		}
+	}
+
+	sort.Slice(schedules, func(i, j int) bool {
+		if !schedules[i].Created.Equal(schedules[j].Created) {
+			return schedules[i].Created.Before(schedules[j].Created)
+		}
+		return schedules[i].ID < schedules[j].ID
+	})
+
+	return schedules, nil
+}
+
+// PauseSchedule stops the specified schedule from running until it is
+// resumed. Pausing a schedule that is already paused has no effect. It
+// returns an error if the schedule was cancelled or has completed, or a
+// ScheduleNotFoundError if there is no such schedule.
+func (bank *Bank) PauseSchedule(scheduleID string) error {
+	return bank.changeSchedule(scheduleID, "paused", func(schedule *Schedule, _ time.Time) error {
+		switch schedule.Status {
+		case ScheduleActive, SchedulePaused:
+			schedule.Status = SchedulePaused
+			return nil
+		}
+		return fmt.Errorf("schedule '%s' cannot be paused because it is %s", scheduleID, schedule.Status)
+	})
+}
+
+// ResumeSchedule allows a paused schedule to run again. A recurring
+// schedule does not make the runs that it missed while it was paused;
+// it next runs at the first time that follows the current time. A
+// schedule that does not recur runs immediately if its time has passed.
+// Resuming a schedule that is active has no effect. It returns an error
+// if the schedule was cancelled or has completed, or a
+// ScheduleNotFoundError if there is no such schedule.
+func (bank *Bank) ResumeSchedule(scheduleID string) error {
+	return bank.changeSchedule(scheduleID, "resumed", func(schedule *Schedule, now time.Time) error {
+		switch schedule.Status {
+		case ScheduleActive:
+			return nil
+		case SchedulePaused:
+			schedule.Status = ScheduleActive
+			if schedule.recurs() && !schedule.NextRun.After(now) {
+				schedule.NextRun = schedule.nextRunAfter(now)
+			}
+			return nil
+		}
+		return fmt.Errorf("schedule '%s' cannot be resumed because it is %s", scheduleID, schedule.Status)
+	})
+}
+
+// CancelSchedule stops the specified schedule from ever running again.
+// Cancelling a schedule that is already cancelled has no effect. It
+// returns an error if the schedule has completed, or a
+// ScheduleNotFoundError if there is no such schedule.
+func (bank *Bank) CancelSchedule(scheduleID string) error {
+	return bank.changeSchedule(scheduleID, "cancelled", func(schedule *Schedule, _ time.Time) error {
+		if schedule.Status == ScheduleCompleted {
+			return fmt.Errorf("schedule '%s' cannot be cancelled because it is %s", scheduleID, schedule.Status)
+		}
+		schedule.Status = ScheduleCancelled
+		schedule.NextRun = time.Time{}
+		return nil
+	})
+}
+
+// Applies a change to the specified schedule and records it, unless the
+// change returns an error. The description is used in the log message.
+func (bank *Bank) changeSchedule(scheduleID string, description string, change func(*Schedule, time.Time) error) error {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	schedule, err := bank.getSchedule(scheduleID)
+	if err != nil {
+		return err
+	}
+
+	bank.schedulesLock.Lock()
+	err = change(schedule, bank.now().UTC())
+	changed := *schedule
+	bank.schedulesLock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = bank.commit(walRecord{Schedules: []Schedule{changed}})
+	if err != nil {
+		log.Printf("ERROR: could not save account data following schedule change: %v\n", err)
+		return err
+	}
+
+	log.Printf("Schedule '%s' at '%s' bank %s", scheduleID, bank.name, description)
+	return nil
+}
+
+// RunDueSchedules makes the deposits and withdrawals of the active
+// schedules whose next run is due according to the bank's clock, oldest
+// first. A schedule whose run fails, such as for insufficient funds,
+// records the error and is not retried until its next run. A recurring
+// schedule that missed several runs (such as while the service was
+// stopped) runs once, and then at the first time that follows the
+// current time. This is called periodically once StartSchedules has
+// been called, but it may also be called directly, such as after
+// advancing the clock.
+func (bank *Bank) RunDueSchedules() error {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	for _, scheduleID := range bank.dueSchedules(bank.now()) {
+		if err := bank.runSchedule(scheduleID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StartSchedules starts running the schedules in the background, as
+// described for RunDueSchedules, until the bank is closed. Runs that
+// became due while the bank was not running schedules are made
+// immediately. This has no effect if schedules are already running.
+func (bank *Bank) StartSchedules() {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	if bank.scheduleTask != nil {
+		return
+	}
+
+	bank.scheduleTask = startBackgroundTask(scheduleCheckInterval, func() {
+		if err := bank.RunDueSchedules(); err != nil {
+			log.Printf("ERROR: failed to run schedules for '%s' bank: %v\n", bank.name, err)
+		}
+	})
+}
+
+// Returns the IDs of the active schedules that are due to run at the
+// specified time, ordered by when they became due
+func (bank *Bank) dueSchedules(now time.Time) []string {
+	bank.schedulesLock.Lock()
+	defer bank.schedulesLock.Unlock()
+
+	var due []*Schedule
+	for _, schedule := range bank.schedules {
+		if schedule.Status == ScheduleActive && !schedule.NextRun.After(now) {
+			due = append(due, schedule)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextRun.Equal(due[j].NextRun) {
+			return due[i].NextRun.Before(due[j].NextRun)
+		}
+		return due[i].ID < due[j].ID
+	})
+
+	ids := make([]string, len(due))
+	for i, schedule := range due {
+		ids[i] = schedule.ID
+	}
+
+	return ids
+}
+
+// Makes the deposit or withdrawal for the next run of the schedule, if
+// it is still due, and then records the outcome and when it runs next.
+// The caller must hold lock exclusively. Since lock is released while
+// the transaction is recorded, the schedule may change in the meantime;
+// the outcome is only recorded if no other caller has recorded this run.
+// This returns an error only if the outcome could not be recorded.
+func (bank *Bank) runSchedule(scheduleID string) error {
+	schedule, err := bank.getSchedule(scheduleID)
+	if err != nil {
+		return err
+	}
+
+	now := bank.now().UTC()
+	bank.schedulesLock.Lock()
+	run := *schedule
+	bank.schedulesLock.Unlock()
+	if run.Status != ScheduleActive || run.NextRun.After(now) {
+		return nil
+	}
+
+	// the transaction may already have been made if the bank stopped
+	// before the outcome was recorded; its idempotency key may have been
+	// evicted since, but the ledger keeps it
+	idempotencyKey := run.runIdempotencyKey()
+	var txID string
+	if page, _ := bank.listTransactions(TransactionFilter{IdempotencyKey: idempotencyKey, Limit: 1}); len(page.Transactions) > 0 {
+		txID = page.Transactions[0].TransactionID
+	} else if run.Type == TransactionDeposit {
+		txID, err = bank.depositToAccount(run.AccountID, run.Amount, run.Currency, idempotencyKey, AnyVersion)
+	} else {
+		txID, err = bank.withdrawFromAccount(run.AccountID, run.Amount, run.Currency, idempotencyKey, AnyVersion, TransactionWithdrawal)
+	}
+
+	// the bank's data is reloaded if the transaction could not be
+	// recorded, so the schedule is looked up again
+	schedule, lookupErr := bank.getSchedule(scheduleID)
+	if lookupErr != nil {
+		return lookupErr
+	}
+
+	bank.schedulesLock.Lock()
+	if schedule.Runs != run.Runs {
+		bank.schedulesLock.Unlock()
+		return nil
+	}
+
+	schedule.Runs++
+	schedule.LastTransactionID = txID
+	schedule.LastError = ""
+	if err != nil {
+		schedule.LastError = err.Error()
+	}
+
+	if !schedule.recurs() {
+		schedule.NextRun = time.Time{}
+		if schedule.Status == ScheduleActive {
+			schedule.Status = ScheduleCompleted
+		}
+	} else if schedule.Status != ScheduleCancelled {
+		schedule.NextRun = schedule.nextRunAfter(now)
+	}
+	changed := *schedule
+	bank.schedulesLock.Unlock()
+
+	if err != nil {
+		log.Printf("ERROR: run %d of schedule '%s' at '%s' bank failed: %v\n", changed.Runs, scheduleID, bank.name, err)
+	} else {
+		log.Printf("Run %d of schedule '%s' at '%s' bank made transaction '%s'", changed.Runs, scheduleID, bank.name, txID)
+	}
+
+	err = bank.commit(walRecord{Schedules: []Schedule{changed}})
+	if err != nil {
+		log.Printf("ERROR: could not save account data following scheduled %s: %v\n",
+			strings.ToLower(string(changed.Type)), err)
+		return err
+	}
+
+	return nil
+}
+
+// Returns the schedule with the specified ID, or a
+// ScheduleNotFoundError if there is no such schedule.
+func (bank *Bank) getSchedule(scheduleID string) (*Schedule, error) {
+	bank.schedulesLock.Lock()
+	defer bank.schedulesLock.Unlock()
+
+	schedule, exists := bank.schedules[scheduleID]
+	if !exists {
+		msg := fmt.Sprintf("no schedule with ID '%s' at '%s' bank", scheduleID, bank.name)
+		return nil, ScheduleNotFoundError{message: msg}
+	}
+
+	return schedule, nil
+}
+
+// Cancels the active and paused schedules for the specified account,
+// which is being closed, and returns them as they are after the change,
+// for inclusion in the change that closes the account. The caller must
+// hold lock exclusively.
+func (bank *Bank) cancelAccountSchedules(accountID string) []Schedule {
+	bank.schedulesLock.Lock()
+	defer bank.schedulesLock.Unlock()
+
+	var cancelled []Schedule
+	for _, schedule := range bank.schedules {
+		if schedule.AccountID == accountID && (schedule.Status == ScheduleActive || schedule.Status == SchedulePaused) {
+			schedule.Status = ScheduleCancelled
+			schedule.NextRun = time.Time{}
+			cancelled = append(cancelled, *schedule)
+		}
+	}
+
+	return cancelled
+}
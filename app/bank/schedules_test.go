@@ -0,0 +1,212 @@
+package banking
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecurringScheduleRunsUntilCancelled(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	clock := &fakeClock{now: time.Date(2026, time.April, 1, 8, 0, 0, 0, time.UTC)}
+	bank.SetClock(clock)
+
+	scheduleID, err := bank.CreateSchedule(Schedule{
+		AccountID: DefaultAccountID,
+		Type:      TransactionDeposit,
+		Amount:    Dollars(10),
+		Every:     24 * time.Hour,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runDueSchedules := func(advance time.Duration) {
+		t.Helper()
+		clock.Advance(advance)
+		if err := bank.RunDueSchedules(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// nothing is due until a day has passed
+	runDueSchedules(12 * time.Hour)
+	if balance := bank.GetBalance(); balance != 0 {
+		t.Errorf("balance before the first run is %s, want 0.00", balance)
+	}
+
+	// three runs were missed, but only one is made
+	runDueSchedules(3 * 24 * time.Hour)
+	if balance := bank.GetBalance(); balance != Dollars(10) {
+		t.Errorf("balance after missed runs is %s, want 10.00", balance)
+	}
+
+	schedule, err := bank.GetSchedule(scheduleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNextRun := time.Date(2026, time.April, 5, 8, 0, 0, 0, time.UTC)
+	if schedule.Runs != 1 || !schedule.NextRun.Equal(wantNextRun) {
+		t.Errorf("after missed runs, schedule has %d runs and next runs at %v, want 1 and %v",
+			schedule.Runs, schedule.NextRun, wantNextRun)
+	}
+
+	// a paused schedule does not run
+	if err := bank.PauseSchedule(scheduleID); err != nil {
+		t.Fatal(err)
+	}
+	runDueSchedules(24 * time.Hour)
+	if balance := bank.GetBalance(); balance != Dollars(10) {
+		t.Errorf("balance while paused is %s, want 10.00", balance)
+	}
+
+	if err := bank.ResumeSchedule(scheduleID); err != nil {
+		t.Fatal(err)
+	}
+	runDueSchedules(24 * time.Hour)
+	if balance := bank.GetBalance(); balance != Dollars(20) {
+		t.Errorf("balance after resuming is %s, want 20.00", balance)
+	}
+
+	if err := bank.CancelSchedule(scheduleID); err != nil {
+		t.Fatal(err)
+	}
+	runDueSchedules(7 * 24 * time.Hour)
+	if balance := bank.GetBalance(); balance != Dollars(20) {
+		t.Errorf("balance after cancelling is %s, want 20.00", balance)
+	}
+
+	if err := bank.ResumeSchedule(scheduleID); err == nil {
+		t.Error("resumed a cancelled schedule")
+	}
+	checkLedger(t, bank)
+}
+
+func TestScheduledRunIsNotPostedTwice(t *testing.T) {
+	discardLogOutput(t)
+	path := filepath.Join(t.TempDir(), "bank-test.dat")
+	clock := &fakeClock{now: time.Date(2026, time.May, 1, 8, 0, 0, 0, time.UTC)}
+
+	bank := NewBankWithStorage("test", NewFileStorage(path))
+	bank.SetClock(clock)
+	if _, err := bank.Deposit(Dollars(100), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	scheduleID, err := bank.CreateSchedule(Schedule{
+		AccountID: DefaultAccountID,
+		Type:      TransactionWithdrawal,
+		Amount:    Dollars(25),
+		NextRun:   clock.Now().Add(time.Hour),
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the schedule is kept across sessions
+	if err := bank.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bank = NewBankWithStorage("test", NewFileStorage(path))
+	t.Cleanup(func() { bank.Close() })
+	bank.SetClock(clock)
+
+	// as if the service stopped after making the withdrawal for the
+	// first run, but before recording that the schedule had run, and
+	// did not start again until its idempotency key had expired
+	schedule, err := bank.GetSchedule(scheduleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txID, err := bank.Withdraw(Dollars(25), schedule.runIdempotencyKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bank.SetIdempotencyRetention(30*time.Minute, 0)
+
+	clock.Advance(time.Hour)
+	if err := bank.RunDueSchedules(); err != nil {
+		t.Fatal(err)
+	}
+
+	if balance := bank.GetBalance(); balance != Dollars(75) {
+		t.Errorf("balance is %s, want 75.00", balance)
+	}
+
+	schedule, err = bank.GetSchedule(scheduleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schedule.Status != ScheduleCompleted || schedule.LastTransactionID != txID || !schedule.NextRun.IsZero() {
+		t.Errorf("schedule is %+v, want it completed by transaction %s", schedule, txID)
+	}
+	checkLedger(t, bank)
+}
+
+func TestScheduleRecordsFailedRuns(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	clock := &fakeClock{now: time.Date(2026, time.June, 1, 8, 0, 0, 0, time.UTC)}
+	bank.SetClock(clock)
+
+	scheduleID, err := bank.CreateSchedule(Schedule{
+		AccountID: DefaultAccountID,
+		Type:      TransactionWithdrawal,
+		Amount:    Dollars(5),
+		Cron:      "30 9 * * 1-5",
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(2 * time.Hour)
+	if err := bank.RunDueSchedules(); err != nil {
+		t.Fatal(err)
+	}
+
+	schedule, err := bank.GetSchedule(scheduleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// June 1, 2026 is a Monday, so the next run is on Tuesday
+	wantNextRun := time.Date(2026, time.June, 2, 9, 30, 0, 0, time.UTC)
+	if schedule.Runs != 1 || schedule.LastError == "" || !schedule.NextRun.Equal(wantNextRun) {
+		t.Errorf("schedule is %+v, want a failed run and the next at %v", schedule, wantNextRun)
+	}
+}
+
+func TestCronExpressions(t *testing.T) {
+	// a Wednesday
+	after := time.Date(2026, time.January, 28, 10, 15, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, time.January, 28, 10, 16, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2026, time.January, 28, 10, 20, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2026, time.January, 29, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1,5", time.Date(2026, time.January, 30, 9, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2026, time.January, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * 7", time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, test := range tests {
+		cron, err := parseCron(test.expr)
+		if err != nil {
+			t.Errorf("could not parse '%s': %v", test.expr, err)
+			continue
+		}
+		if got := cron.next(after); !got.Equal(test.want) {
+			t.Errorf("next time for '%s' is %v, want %v", test.expr, got, test.want)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parsed invalid cron expression '%s'", expr)
+		}
+	}
+}
@@ -2,12 +2,14 @@ package banking
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"regexp"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // BankingService represents account operations that a specific bank
@@ -30,9 +32,29 @@ func NewBankingService(bank *Bank, port int) *BankingService {
 	return &svc
 }
 
-func (svc *BankingService) balanceHandler(w http.ResponseWriter, _ *http.Request) {
+func (svc *BankingService) balanceHandler(w http.ResponseWriter, r *http.Request) {
+	balance, version, err := svc.bank.GetBalanceAndVersion(accountIDParam(r))
+	if err != nil {
+		writeError(w, "BALANCE_FAIL", err)
+		return
+	}
+
+	// the version may be sent back in an If-Match header to make a
+	// deposit or withdrawal conditional on the account being unchanged
+	w.Header().Set("ETag", versionETag(version))
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "SUCCESS: balance=%d", svc.bank.GetBalance())
+	fmt.Fprintf(w, "SUCCESS: balance=%s", balance)
+}
+
+func (svc *BankingService) currencyHandler(w http.ResponseWriter, r *http.Request) {
+	currency, err := svc.bank.GetAccountCurrency(accountIDParam(r))
+	if err != nil {
+		writeError(w, "CURRENCY_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: currency=%s", currency)
 }
 
 func (svc *BankingService) nameHandler(w http.ResponseWriter, _ *http.Request) {
@@ -41,86 +63,1043 @@ func (svc *BankingService) nameHandler(w http.ResponseWriter, _ *http.Request) {
 }
 
 func (svc *BankingService) depositHandler(w http.ResponseWriter, r *http.Request) {
-	amountParams, hasAmountParam := r.URL.Query()["amount"]
-	if !hasAmountParam {
-		http.Error(w, "ERROR: MISSING_AMOUNT_PARAM", http.StatusBadRequest)
+	amount, ok := amountParam(w, r)
+	if !ok {
 		return
 	}
 
-	amount, err := strconv.Atoi(amountParams[0])
-	if err != nil || amount < 1 {
-		http.Error(w, "ERROR: INVALID_AMOUNT", http.StatusBadRequest)
+	expectedVersion, ok := expectedVersionParam(w, r)
+	if !ok {
 		return
 	}
 
-	var idempotencyKey string
-	idempotencyKeyParams, hasIdempotencyKeyParam := r.URL.Query()["idempotency-key"]
-	if hasIdempotencyKeyParam {
-		idempotencyKey = idempotencyKeyParams[0]
+	idempotencyKey := idempotencyKeyParam(r)
+	currency := r.URL.Query().Get("currency")
+	txID, err := svc.bank.DepositToAccount(accountIDParam(r), amount, currency, idempotencyKey, expectedVersion)
+	if err != nil {
+		writeError(w, "DEPOSIT_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, fmt.Sprintf("SUCCESS: DEPOSIT_COMPLETE: transaction-id=%s%s", txID, svc.formatFee(txID)))
+}
+
+func (svc *BankingService) withdrawHandler(w http.ResponseWriter, r *http.Request) {
+	amount, ok := amountParam(w, r)
+	if !ok {
+		return
+	}
+
+	expectedVersion, ok := expectedVersionParam(w, r)
+	if !ok {
+		return
+	}
+
+	// a withdrawal that begins a transfer is charged the transfer fee
+	withdraw := svc.bank.WithdrawFromAccount
+	if r.URL.Query().Get("transfer") == "true" {
+		withdraw = svc.bank.WithdrawForTransfer
 	}
 
-	// TODO maybe expose specific errors such as insufficient funds,
-	// but for now I'll just expose as a generic deposit failure
-	txID, err := svc.bank.Deposit(amount, idempotencyKey)
+	idempotencyKey := idempotencyKeyParam(r)
+	currency := r.URL.Query().Get("currency")
+	txID, err := withdraw(accountIDParam(r), amount, currency, idempotencyKey, expectedVersion)
 	if err != nil {
-		message := fmt.Sprintf("ERROR: DEPOSIT_FAIL: %v", err)
-		http.Error(w, message, http.StatusBadRequest)
+		writeError(w, "WITHDRAW_FAIL", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, fmt.Sprintf("SUCCESS: DEPOSIT_COMPLETE: transaction-id=%s", txID))
+	fmt.Fprintf(w, fmt.Sprintf("SUCCESS: WITHDRAW_COMPLETE: transaction-id=%s%s", txID, svc.formatFee(txID)))
 }
 
-func (svc *BankingService) withdrawHandler(w http.ResponseWriter, r *http.Request) {
+// Formats the fee charged for the transaction as name=value pairs that
+// follow its ID, or returns an empty string if it was not charged a fee
+func (svc *BankingService) formatFee(txID string) string {
+	fee, charged := svc.bank.GetTransactionFee(txID)
+	if !charged {
+		return ""
+	}
+
+	return fmt.Sprintf(" fee=%s fee-transaction-id=%s", fee.Amount, fee.TransactionID)
+}
+
+func (svc *BankingService) availableBalanceHandler(w http.ResponseWriter, r *http.Request) {
+	available, err := svc.bank.GetAvailableBalance(accountIDParam(r))
+	if err != nil {
+		writeError(w, "BALANCE_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: available-balance=%s", available)
+}
+
+func (svc *BankingService) authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	amount, ok := amountParam(w, r)
+	if !ok {
+		return
+	}
+
+	holdID, err := svc.bank.AuthorizeHold(accountIDParam(r), amount, idempotencyKeyParam(r))
+	if err != nil {
+		writeError(w, "AUTHORIZE_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: AUTHORIZE_COMPLETE: hold-id=%s", holdID)
+}
+
+func (svc *BankingService) holdHandler(w http.ResponseWriter, r *http.Request) {
+	hold, err := svc.bank.GetHold(r.PathValue("holdID"))
+	if err != nil {
+		writeError(w, "HOLD_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: hold-id=%s account-id=%s amount=%s captured=%s status=%s expires-at=%s",
+		hold.ID, hold.AccountID, hold.Amount, hold.Captured, hold.Status, hold.ExpiresAt.Format(time.RFC3339))
+}
+
+func (svc *BankingService) captureHandler(w http.ResponseWriter, r *http.Request) {
+	// the amount is optional; without it, the full amount held is captured
+	amount := Money(0)
+	if r.URL.Query().Has("amount") {
+		var ok bool
+		amount, ok = amountParam(w, r)
+		if !ok {
+			return
+		}
+	}
+
+	txID, err := svc.bank.CaptureHold(r.PathValue("holdID"), amount, idempotencyKeyParam(r))
+	if err != nil {
+		writeError(w, "CAPTURE_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: CAPTURE_COMPLETE: transaction-id=%s%s", txID, svc.formatFee(txID))
+}
+
+func (svc *BankingService) releaseHandler(w http.ResponseWriter, r *http.Request) {
+	holdID := r.PathValue("holdID")
+	err := svc.bank.ReleaseHold(holdID)
+	if err != nil {
+		writeError(w, "RELEASE_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: RELEASE_COMPLETE: hold-id=%s", holdID)
+}
+
+func (svc *BankingService) reverseHandler(w http.ResponseWriter, r *http.Request) {
+	// the amount is optional; without it, the full amount is reversed
+	amount := Money(0)
+	if r.URL.Query().Has("amount") {
+		var ok bool
+		amount, ok = amountParam(w, r)
+		if !ok {
+			return
+		}
+	}
+
+	txID, err := svc.bank.ReverseTransaction(r.PathValue("txID"), amount, idempotencyKeyParam(r))
+	if err != nil {
+		writeError(w, "REVERSAL_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: REVERSAL_COMPLETE: transaction-id=%s", txID)
+}
+
+func (svc *BankingService) listTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := transactionFilterParams(r)
+	if err != nil {
+		writeError(w, "TRANSACTIONS_FAIL", err)
+		return
+	}
+
+	page, err := svc.bank.ListTransactions(filter)
+	if err != nil {
+		writeError(w, "TRANSACTIONS_FAIL", err)
+		return
+	}
+
+	// the first line summarizes the page, followed by one line per entry
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: count=%d next-cursor=%s", len(page.Transactions), page.NextCursor)
+	for _, entry := range page.Transactions {
+		fmt.Fprintf(w, "\n%s", formatLedgerEntry(entry))
+	}
+}
+
+func (svc *BankingService) transactionHandler(w http.ResponseWriter, r *http.Request) {
+	outcome, err := svc.bank.GetTransaction(r.PathValue("txID"))
+	if err != nil {
+		writeError(w, "TRANSACTION_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: %s", formatOutcome(outcome))
+}
+
+func (svc *BankingService) requestHandler(w http.ResponseWriter, r *http.Request) {
+	outcome, err := svc.bank.GetRequestOutcome(r.PathValue("key"))
+	if err != nil {
+		writeError(w, "REQUEST_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: %s", formatOutcome(outcome))
+}
+
+func (svc *BankingService) statementHandler(w http.ResponseWriter, r *http.Request) {
+	format := StatementCSV
+	if r.URL.Query().Has("format") {
+		var err error
+		format, err = ParseStatementFormat(r.URL.Query().Get("format"))
+		if err != nil {
+			writeError(w, "STATEMENT_FAIL", err)
+			return
+		}
+	}
+
+	from, err := statementTimeParam(r, "from", false)
+	if err != nil {
+		writeError(w, "STATEMENT_FAIL", err)
+		return
+	}
+
+	to, err := statementTimeParam(r, "to", true)
+	if err != nil {
+		writeError(w, "STATEMENT_FAIL", err)
+		return
+	}
+
+	statement, err := svc.bank.GetStatement(accountIDParam(r), from, to)
+	if err != nil {
+		writeError(w, "STATEMENT_FAIL", err)
+		return
+	}
+
+	// the statement is the entire response, rather than a SUCCESS line,
+	// so that it can be saved and imported as is
+	var sb strings.Builder
+	err = statement.Write(&sb, format)
+	if err != nil {
+		writeError(w, "STATEMENT_FAIL", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, sb.String())
+}
+
+func (svc *BankingService) overdraftHandler(w http.ResponseWriter, r *http.Request) {
+	limit, err := svc.bank.GetOverdraftLimit(accountIDParam(r))
+	if err != nil {
+		writeError(w, "OVERDRAFT_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: overdraft-limit=%s", limit)
+}
+
+func (svc *BankingService) setOverdraftHandler(w http.ResponseWriter, r *http.Request) {
+	limitParams, hasLimitParam := r.URL.Query()["limit"]
+	if !hasLimitParam {
+		http.Error(w, "ERROR: MISSING_LIMIT_PARAM", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := ParseMoney(limitParams[0])
+	if err != nil || limit < 0 {
+		http.Error(w, "ERROR: INVALID_LIMIT", http.StatusBadRequest)
+		return
+	}
+
+	err = svc.bank.SetOverdraftLimit(accountIDParam(r), limit)
+	if err != nil {
+		writeError(w, "OVERDRAFT_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: OVERDRAFT_UPDATED: overdraft-limit=%s", limit)
+}
+
+func (svc *BankingService) limitsHandler(w http.ResponseWriter, r *http.Request) {
+	limits, err := svc.bank.GetAccountLimits(accountIDParam(r))
+	if err != nil {
+		writeError(w, "LIMITS_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: %s", limits)
+}
+
+// Changes the limits named in the query parameters; the others keep
+// their current values
+func (svc *BankingService) setLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	changes := map[string]Money{}
+	for _, name := range []string{"max-withdrawal", "daily-withdrawal", "daily-deposit"} {
+		if !r.URL.Query().Has(name) {
+			continue
+		}
+
+		value, err := ParseMoney(r.URL.Query().Get(name))
+		if err != nil || value < 0 {
+			http.Error(w, "ERROR: INVALID_LIMIT", http.StatusBadRequest)
+			return
+		}
+		changes[name] = value
+	}
+
+	limits, err := svc.bank.UpdateAccountLimits(accountIDParam(r), func(limits *AccountLimits) {
+		params := map[string]*Money{
+			"max-withdrawal":   &limits.MaxWithdrawal,
+			"daily-withdrawal": &limits.DailyWithdrawal,
+			"daily-deposit":    &limits.DailyDeposit,
+		}
+		for name, value := range changes {
+			*params[name] = value
+		}
+	})
+	if err != nil {
+		writeError(w, "LIMITS_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: LIMITS_UPDATED: %s", limits)
+}
+
+func (svc *BankingService) interestHandler(w http.ResponseWriter, r *http.Request) {
+	interest, err := svc.bank.GetInterest(accountIDParam(r))
+	if err != nil {
+		writeError(w, "INTEREST_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: apr=%s accrued=%s", interest.APR, interest.Accrued)
+}
+
+func (svc *BankingService) setInterestHandler(w http.ResponseWriter, r *http.Request) {
+	aprParams, hasAPRParam := r.URL.Query()["apr"]
+	if !hasAPRParam {
+		http.Error(w, "ERROR: MISSING_APR_PARAM", http.StatusBadRequest)
+		return
+	}
+
+	err := svc.bank.SetInterestRate(accountIDParam(r), aprParams[0])
+	if err != nil {
+		writeError(w, "INTEREST_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: INTEREST_UPDATED: apr=%s", strings.TrimSpace(aprParams[0]))
+}
+
+func (svc *BankingService) statusHandler(w http.ResponseWriter, r *http.Request) {
+	state, err := svc.bank.GetAccountState(accountIDParam(r))
+	if err != nil {
+		writeError(w, "STATUS_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: %s", formatAccountState(state))
+}
+
+func (svc *BankingService) setStatusHandler(w http.ResponseWriter, r *http.Request) {
+	statusParams, hasStatusParam := r.URL.Query()["status"]
+	if !hasStatusParam {
+		http.Error(w, "ERROR: MISSING_STATUS_PARAM", http.StatusBadRequest)
+		return
+	}
+
+	status, err := ParseAccountStatus(statusParams[0])
+	if err != nil {
+		http.Error(w, "ERROR: INVALID_STATUS", http.StatusBadRequest)
+		return
+	}
+
+	reason := r.URL.Query().Get("reason")
+	if strings.TrimSpace(reason) == "" {
+		http.Error(w, "ERROR: MISSING_REASON_PARAM", http.StatusBadRequest)
+		return
+	}
+
+	err = svc.bank.SetAccountStatus(accountIDParam(r), status, reason)
+	if err != nil {
+		writeError(w, "STATUS_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: STATUS_UPDATED: status=%s", status)
+}
+
+func (svc *BankingService) createScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	amount, ok := amountParam(w, r)
+	if !ok {
+		return
+	}
+
+	schedule := Schedule{
+		AccountID: accountIDParam(r),
+		Type:      TransactionType(strings.ToUpper(r.URL.Query().Get("type"))),
+		Amount:    amount,
+		Currency:  r.URL.Query().Get("currency"),
+		Cron:      r.URL.Query().Get("cron"),
+	}
+
+	var err error
+	schedule.NextRun, err = statementTimeParam(r, "start", false)
+	if err != nil {
+		writeError(w, "SCHEDULE_FAIL", err)
+		return
+	}
+
+	if every := r.URL.Query().Get("every"); every != "" {
+		schedule.Every, err = ParseScheduleInterval(every)
+		if err != nil {
+			writeError(w, "SCHEDULE_FAIL", err)
+			return
+		}
+	}
+
+	scheduleID, err := svc.bank.CreateSchedule(schedule, idempotencyKeyParam(r))
+	if err != nil {
+		writeError(w, "SCHEDULE_FAIL", err)
+		return
+	}
+
+	created, err := svc.bank.GetSchedule(scheduleID)
+	if err != nil {
+		writeError(w, "SCHEDULE_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: SCHEDULE_CREATED: schedule-id=%s next-run=%s",
+		scheduleID, created.NextRun.Format(time.RFC3339))
+}
+
+func (svc *BankingService) scheduleHandler(w http.ResponseWriter, r *http.Request) {
+	schedule, err := svc.bank.GetSchedule(r.PathValue("scheduleID"))
+	if err != nil {
+		writeError(w, "SCHEDULE_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: %s", formatSchedule(schedule))
+}
+
+func (svc *BankingService) listSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	schedules, err := svc.bank.ListSchedules(r.PathValue("id"))
+	if err != nil {
+		writeError(w, "SCHEDULES_FAIL", err)
+		return
+	}
+
+	// the first line gives the count, followed by one line per schedule
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: count=%d", len(schedules))
+	for _, schedule := range schedules {
+		fmt.Fprintf(w, "\n%s", formatSchedule(schedule))
+	}
+}
+
+func (svc *BankingService) pauseScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	scheduleID := r.PathValue("scheduleID")
+	err := svc.bank.PauseSchedule(scheduleID)
+	if err != nil {
+		writeError(w, "PAUSE_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: SCHEDULE_PAUSED: schedule-id=%s", scheduleID)
+}
+
+func (svc *BankingService) resumeScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	scheduleID := r.PathValue("scheduleID")
+	err := svc.bank.ResumeSchedule(scheduleID)
+	if err != nil {
+		writeError(w, "RESUME_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: SCHEDULE_RESUMED: schedule-id=%s", scheduleID)
+}
+
+func (svc *BankingService) cancelScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	scheduleID := r.PathValue("scheduleID")
+	err := svc.bank.CancelSchedule(scheduleID)
+	if err != nil {
+		writeError(w, "CANCEL_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: SCHEDULE_CANCELLED: schedule-id=%s", scheduleID)
+}
+
+func (svc *BankingService) reviewHandler(w http.ResponseWriter, r *http.Request) {
+	review, err := svc.bank.GetReview(r.PathValue("reviewID"))
+	if err != nil {
+		writeError(w, "REVIEW_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: %s", formatReview(review))
+}
+
+func (svc *BankingService) listReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	var status ReviewStatus
+	if name := r.URL.Query().Get("status"); name != "" {
+		var err error
+		status, err = ParseReviewStatus(name)
+		if err != nil {
+			http.Error(w, "ERROR: INVALID_STATUS", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// the first line gives the count, followed by one line per review
+	reviews := svc.bank.ListReviews(status)
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: count=%d", len(reviews))
+	for _, review := range reviews {
+		fmt.Fprintf(w, "\n%s", formatReview(review))
+	}
+}
+
+func (svc *BankingService) approveReviewHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID := r.PathValue("reviewID")
+	txID, err := svc.bank.ApproveReview(reviewID, r.URL.Query().Get("note"))
+	if err != nil {
+		writeError(w, "APPROVE_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: REVIEW_APPROVED: review-id=%s transaction-id=%s", reviewID, txID)
+}
+
+func (svc *BankingService) declineReviewHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID := r.PathValue("reviewID")
+	err := svc.bank.DeclineReview(reviewID, r.URL.Query().Get("note"))
+	if err != nil {
+		writeError(w, "DECLINE_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: REVIEW_DECLINED: review-id=%s", reviewID)
+}
+
+func (svc *BankingService) reloadFraudRulesHandler(w http.ResponseWriter, _ *http.Request) {
+	count, err := svc.bank.ReloadFraudRules()
+	if err != nil {
+		writeError(w, "RELOAD_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: RULES_RELOADED: rules=%d", count)
+}
+
+func (svc *BankingService) listAccountsHandler(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: accounts=%s", strings.Join(svc.bank.ListAccounts(), ","))
+}
+
+func (svc *BankingService) openAccountHandler(w http.ResponseWriter, r *http.Request) {
+	accountID := accountIDParam(r)
+	err := svc.bank.OpenAccount(accountID, r.URL.Query().Get("currency"))
+	if err != nil {
+		writeError(w, "OPEN_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: OPEN_COMPLETE: account-id=%s", accountID)
+}
+
+func (svc *BankingService) closeAccountHandler(w http.ResponseWriter, r *http.Request) {
+	accountID := accountIDParam(r)
+	err := svc.bank.CloseAccount(accountID)
+	if err != nil {
+		writeError(w, "CLOSE_FAIL", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "SUCCESS: CLOSE_COMPLETE: account-id=%s", accountID)
+}
+
+// Returns the account ID from the request path, or the ID of the default
+// account for routes that do not include one (such as /balance)
+func accountIDParam(r *http.Request) string {
+	accountID := r.PathValue("id")
+	if accountID == "" {
+		return DefaultAccountID
+	}
+
+	return accountID
+}
+
+// Returns the value of the amount parameter, which must be at least one
+// cent. If it is missing or invalid, this writes an error response and
+// returns false.
+func amountParam(w http.ResponseWriter, r *http.Request) (Money, bool) {
 	amountParams, hasAmountParam := r.URL.Query()["amount"]
 	if !hasAmountParam {
 		http.Error(w, "ERROR: MISSING_AMOUNT_PARAM", http.StatusBadRequest)
-		return
+		return 0, false
 	}
 
-	amount, err := strconv.Atoi(amountParams[0])
-	if err != nil || amount < 1 {
+	amount, err := ParseMoney(amountParams[0])
+	if err != nil || amount < Cents(1) {
 		http.Error(w, "ERROR: INVALID_AMOUNT", http.StatusBadRequest)
-		return
+		return 0, false
 	}
 
+	return amount, true
+}
+
+// Returns the value of the idempotency key parameter, or an empty string
+// if the request does not have one
+func idempotencyKeyParam(r *http.Request) string {
 	var idempotencyKey string
 	idempotencyKeyParams, hasIdempotencyKeyParam := r.URL.Query()["idempotency-key"]
 	if hasIdempotencyKeyParam {
 		idempotencyKey = idempotencyKeyParams[0]
 	}
 
-	txID, err := svc.bank.Withdraw(amount, idempotencyKey)
+	return idempotencyKey
+}
+
+// Returns the version that the request expects the account to be at,
+// from the expected-version parameter or else the If-Match header, or
+// AnyVersion if it has neither (or it is "*" or zero). If the version
+// is invalid, this writes an error response and returns false.
+func expectedVersionParam(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	value := r.URL.Query().Get("expected-version")
+	if value == "" {
+		value = strings.Trim(r.Header.Get("If-Match"), `"`)
+	}
+
+	if value == "" || value == "*" {
+		return AnyVersion, true
+	}
+
+	version, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		http.Error(w, "ERROR: INVALID_VERSION", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return version, true
+}
+
+// Returns the entity tag for the specified version of an account
+func versionETag(version uint64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// Returns the filter described by the query parameters of a request to
+// list transactions, or an error if a parameter is invalid. The account
+// is taken from the path if present, and otherwise is optional.
+func transactionFilterParams(r *http.Request) (TransactionFilter, error) {
+	query := r.URL.Query()
+	filter := TransactionFilter{
+		AccountID:      r.PathValue("id"),
+		Type:           TransactionType(strings.ToUpper(query.Get("type"))),
+		IdempotencyKey: query.Get("idempotency-key"),
+		Cursor:         query.Get("cursor"),
+	}
+
+	if filter.AccountID == "" {
+		filter.AccountID = query.Get("account-id")
+	}
+
+	var err error
+	if query.Has("min-amount") {
+		if filter.MinAmount, err = ParseMoney(query.Get("min-amount")); err != nil {
+			return filter, err
+		}
+	}
+
+	if query.Has("max-amount") {
+		if filter.MaxAmount, err = ParseMoney(query.Get("max-amount")); err != nil {
+			return filter, err
+		}
+	}
+
+	if query.Has("since") {
+		if filter.Since, err = time.Parse(time.RFC3339, query.Get("since")); err != nil {
+			return filter, fmt.Errorf("invalid time: '%s'", query.Get("since"))
+		}
+	}
+
+	if query.Has("until") {
+		if filter.Until, err = time.Parse(time.RFC3339, query.Get("until")); err != nil {
+			return filter, fmt.Errorf("invalid time: '%s'", query.Get("until"))
+		}
+	}
+
+	if query.Has("limit") {
+		if filter.Limit, err = strconv.Atoi(query.Get("limit")); err != nil {
+			return filter, fmt.Errorf("invalid limit: '%s'", query.Get("limit"))
+		}
+	}
+
+	return filter, nil
+}
+
+// Returns the time given by the named parameter, which may be either an
+// RFC 3339 time or a date (such as 2024-01-31), interpreted as UTC. A
+// date that ends a period includes the whole day. This returns a zero
+// time if the parameter is missing.
+func statementTimeParam(r *http.Request, name string, endOfPeriod bool) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if date, err := time.Parse(time.DateOnly, value); err == nil {
+		if endOfPeriod {
+			date = date.AddDate(0, 0, 1)
+		}
+		return date, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
 	if err != nil {
-		message := fmt.Sprintf("ERROR: WITHDRAW_FAIL: %v", err)
-		// Expose insufficient funds error so that the client will recognize
-		// it and return it to the caller as a specific typed error
-		if strings.Contains(err.Error(), "insufficient funds:") {
-			// extract the details, which follows the colon
-			re := regexp.MustCompile(`:\s(.*)`)
-			matches := re.FindStringSubmatch(err.Error())
-			message = fmt.Sprintf("ERROR: INSUFFICIENT_FUNDS: %s", matches[1])
+		return time.Time{}, fmt.Errorf("invalid %s time: '%s' (use YYYY-MM-DD or RFC 3339)", name, value)
+	}
+
+	return t, nil
+}
+
+// Formats a ledger entry as space-separated name=value pairs, omitting
+// the fields that do not apply to it. The idempotency key is escaped,
+// since it may contain spaces or other special characters.
+func formatLedgerEntry(entry LedgerEntry) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "tx-id=%s account-id=%s type=%s amount=%s balance=%s currency=%s timestamp=%s",
+		entry.TransactionID, entry.AccountID, entry.Type, entry.Amount, entry.Balance, entry.Currency,
+		entry.Timestamp.Format(time.RFC3339Nano))
+
+	if entry.IdempotencyKey != "" {
+		fmt.Fprintf(&sb, " idempotency-key=%s", url.QueryEscape(entry.IdempotencyKey))
+	}
+
+	if entry.HoldID != "" {
+		fmt.Fprintf(&sb, " hold-id=%s", entry.HoldID)
+	}
+
+	if entry.ReversalOf != "" {
+		fmt.Fprintf(&sb, " reversal-of=%s", entry.ReversalOf)
+	}
+
+	if entry.FeeFor != "" {
+		fmt.Fprintf(&sb, " fee-for=%s", entry.FeeFor)
+	}
+
+	if entry.OriginalCurrency != "" {
+		fmt.Fprintf(&sb, " original-amount=%s original-currency=%s exchange-rate=%s conversion-fee=%s",
+			entry.OriginalAmount, entry.OriginalCurrency, entry.ExchangeRate, entry.ConversionFee)
+	}
+
+	return sb.String()
+}
+
+// Formats a schedule as space-separated name=value pairs, omitting the
+// fields that do not apply to it. The cron expression and the last
+// error are escaped, since they contain spaces.
+func formatSchedule(schedule Schedule) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "schedule-id=%s account-id=%s type=%s amount=%s status=%s runs=%d created=%s",
+		schedule.ID, schedule.AccountID, schedule.Type, schedule.Amount, schedule.Status, schedule.Runs,
+		schedule.Created.Format(time.RFC3339Nano))
+
+	if schedule.Currency != "" {
+		fmt.Fprintf(&sb, " currency=%s", schedule.Currency)
+	}
+
+	if schedule.Cron != "" {
+		fmt.Fprintf(&sb, " cron=%s", url.QueryEscape(schedule.Cron))
+	}
+
+	if schedule.Every != 0 {
+		fmt.Fprintf(&sb, " every=%s", schedule.Every)
+	}
+
+	if !schedule.NextRun.IsZero() {
+		fmt.Fprintf(&sb, " next-run=%s", schedule.NextRun.Format(time.RFC3339Nano))
+	}
+
+	if schedule.LastTransactionID != "" {
+		fmt.Fprintf(&sb, " last-tx-id=%s", schedule.LastTransactionID)
+	}
+
+	if schedule.LastError != "" {
+		fmt.Fprintf(&sb, " last-error=%s", url.QueryEscape(schedule.LastError))
+	}
+
+	return sb.String()
+}
+
+// Formats a review as space-separated name=value pairs, omitting the
+// fields that do not apply to it. The rule, reason, and note are
+// escaped, since they may contain spaces.
+func formatReview(review Review) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "review-id=%s account-id=%s type=%s amount=%s status=%s rule=%s reason=%s created=%s",
+		review.ID, review.AccountID, review.Type, review.Amount, review.Status, url.QueryEscape(review.Rule),
+		url.QueryEscape(review.Reason), review.Created.Format(time.RFC3339Nano))
+
+	if review.Currency != "" {
+		fmt.Fprintf(&sb, " currency=%s", review.Currency)
+	}
+
+	if !review.Resolved.IsZero() {
+		fmt.Fprintf(&sb, " resolved=%s", review.Resolved.Format(time.RFC3339Nano))
+	}
+
+	if review.Note != "" {
+		fmt.Fprintf(&sb, " note=%s", url.QueryEscape(review.Note))
+	}
+
+	if review.TransactionID != "" {
+		fmt.Fprintf(&sb, " transaction-id=%s", review.TransactionID)
+	}
+
+	return sb.String()
+}
+
+// Formats the state of an account as space-separated name=value pairs.
+// The reason is escaped, since it may contain spaces, and the time of the
+// last change is omitted if the account has always been open.
+func formatAccountState(state AccountState) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "status=%s", state.Status)
+
+	if state.Reason != "" {
+		fmt.Fprintf(&sb, " reason=%s", url.QueryEscape(state.Reason))
+	}
+
+	if !state.Changed.IsZero() {
+		fmt.Fprintf(&sb, " changed=%s", state.Changed.Format(time.RFC3339Nano))
+	}
+
+	return sb.String()
+}
+
+// Formats the outcome of a transaction as its status followed by the
+// fields of its ledger entry
+func formatOutcome(outcome TransactionOutcome) string {
+	return fmt.Sprintf("status=%s reversed-amount=%s %s",
+		outcome.Status, outcome.ReversedAmount, formatLedgerEntry(outcome.LedgerEntry))
+}
+
+// Writes an error response for a failed operation. Errors that the client
+// exposes as specific types are written with their own code and status;
+// all others are reported as the named failure with a 400 status.
+func writeError(w http.ResponseWriter, failure string, err error) {
+	var notFound AccountNotFoundError
+	if errors.As(err, &notFound) {
+		message := fmt.Sprintf("ERROR: ACCOUNT_NOT_FOUND: %v", err)
+		http.Error(w, message, http.StatusNotFound)
+		return
+	}
+
+	// Expose insufficient funds error so that the client will recognize
+	// it and return it to the caller as a specific typed error
+	var insufficientFunds InsufficientFundsError
+	if errors.As(err, &insufficientFunds) {
+		code := "INSUFFICIENT_FUNDS"
+		if insufficientFunds.OverdraftLimitExceeded() {
+			code = "OVERDRAFT_LIMIT_EXCEEDED"
 		}
 
+		message := fmt.Sprintf("ERROR: %s: %v", code, err)
 		http.Error(w, message, http.StatusBadRequest)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, fmt.Sprintf("SUCCESS: WITHDRAW_COMPLETE: transaction-id=%s", txID))
+	var limitExceeded LimitExceededError
+	if errors.As(err, &limitExceeded) {
+		message := fmt.Sprintf("ERROR: LIMIT_EXCEEDED: %v", err)
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+
+	var closed AccountClosedError
+	if errors.As(err, &closed) {
+		message := fmt.Sprintf("ERROR: ACCOUNT_CLOSED: %v", err)
+		http.Error(w, message, http.StatusForbidden)
+		return
+	}
+
+	// the code names the account's status, such as ACCOUNT_FROZEN
+	var restricted AccountRestrictedError
+	if errors.As(err, &restricted) {
+		message := fmt.Sprintf("ERROR: ACCOUNT_%s: %v", restricted.Status(), err)
+		http.Error(w, message, http.StatusForbidden)
+		return
+	}
+
+	var fraudSuspected FraudSuspectedError
+	if errors.As(err, &fraudSuspected) {
+		message := fmt.Sprintf("ERROR: FRAUD_SUSPECTED: %v", err)
+		http.Error(w, message, http.StatusForbidden)
+		return
+	}
+
+	// the transaction has been accepted, but is not made unless it is
+	// approved, and the location of the review lets the client find it
+	var pendingReview PendingReviewError
+	if errors.As(err, &pendingReview) {
+		w.Header().Set("Location", "/admin/reviews/"+url.PathEscape(pendingReview.ReviewID()))
+		message := fmt.Sprintf("ERROR: PENDING_REVIEW: %v", err)
+		http.Error(w, message, http.StatusAccepted)
+		return
+	}
+
+	var holdNotFound HoldNotFoundError
+	if errors.As(err, &holdNotFound) {
+		message := fmt.Sprintf("ERROR: HOLD_NOT_FOUND: %v", err)
+		http.Error(w, message, http.StatusNotFound)
+		return
+	}
+
+	var scheduleNotFound ScheduleNotFoundError
+	if errors.As(err, &scheduleNotFound) {
+		message := fmt.Sprintf("ERROR: SCHEDULE_NOT_FOUND: %v", err)
+		http.Error(w, message, http.StatusNotFound)
+		return
+	}
+
+	var reviewNotFound ReviewNotFoundError
+	if errors.As(err, &reviewNotFound) {
+		message := fmt.Sprintf("ERROR: REVIEW_NOT_FOUND: %v", err)
+		http.Error(w, message, http.StatusNotFound)
+		return
+	}
+
+	var txNotFound TransactionNotFoundError
+	if errors.As(err, &txNotFound) {
+		message := fmt.Sprintf("ERROR: TRANSACTION_NOT_FOUND: %v", err)
+		http.Error(w, message, http.StatusNotFound)
+		return
+	}
+
+	var requestNotFound RequestNotFoundError
+	if errors.As(err, &requestNotFound) {
+		message := fmt.Sprintf("ERROR: REQUEST_NOT_FOUND: %v", err)
+		http.Error(w, message, http.StatusNotFound)
+		return
+	}
+
+	var preconditionFailed PreconditionFailedError
+	if errors.As(err, &preconditionFailed) {
+		w.Header().Set("ETag", versionETag(preconditionFailed.CurrentVersion()))
+		message := fmt.Sprintf("ERROR: PRECONDITION_FAILED: %v", err)
+		http.Error(w, message, http.StatusPreconditionFailed)
+		return
+	}
+
+	var conflict IdempotencyConflictError
+	if errors.As(err, &conflict) {
+		message := fmt.Sprintf("ERROR: IDEMPOTENCY_CONFLICT: %v", err)
+		http.Error(w, message, http.StatusConflict)
+		return
+	}
+
+	message := fmt.Sprintf("ERROR: %s: %v", failure, err)
+	http.Error(w, message, http.StatusBadRequest)
 }
 
 // Start starts the BankingService, allowing it to handle client reqests
 func (svc *BankingService) Start() error {
-	http.HandleFunc("/balance", svc.balanceHandler)
-	http.HandleFunc("/name", svc.nameHandler)
-	http.HandleFunc("/withdraw", svc.withdrawHandler)
-	http.HandleFunc("/deposit", svc.depositHandler)
+	svc.registerHandlers(http.DefaultServeMux)
+
+	// scheduled payments are made while the service is running
+	svc.bank.StartSchedules()
 
 	return svc.server.ListenAndServe()
 }
 
+// Registers the handlers for the service's requests with the mux
+func (svc *BankingService) registerHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/balance", svc.balanceHandler)
+	mux.HandleFunc("/name", svc.nameHandler)
+	mux.HandleFunc("/withdraw", svc.withdrawHandler)
+	mux.HandleFunc("/deposit", svc.depositHandler)
+
+	mux.HandleFunc("/accounts", svc.listAccountsHandler)
+	mux.HandleFunc("/accounts/{id}/open", svc.openAccountHandler)
+	mux.HandleFunc("/accounts/{id}/close", svc.closeAccountHandler)
+	mux.HandleFunc("/accounts/{id}/balance", svc.balanceHandler)
+	mux.HandleFunc("/accounts/{id}/currency", svc.currencyHandler)
+	mux.HandleFunc("/accounts/{id}/overdraft", svc.overdraftHandler)
+	mux.HandleFunc("/accounts/{id}/limits", svc.limitsHandler)
+	mux.HandleFunc("/accounts/{id}/interest", svc.interestHandler)
+	mux.HandleFunc("/accounts/{id}/status", svc.statusHandler)
+	mux.HandleFunc("/accounts/{id}/available", svc.availableBalanceHandler)
+	mux.HandleFunc("/accounts/{id}/authorize", svc.authorizeHandler)
+
+	mux.HandleFunc("/holds/{holdID}", svc.holdHandler)
+	mux.HandleFunc("/holds/{holdID}/capture", svc.captureHandler)
+	mux.HandleFunc("/holds/{holdID}/release", svc.releaseHandler)
+	mux.HandleFunc("/accounts/{id}/withdraw", svc.withdrawHandler)
+	mux.HandleFunc("/accounts/{id}/deposit", svc.depositHandler)
+	mux.HandleFunc("/accounts/{id}/schedule", svc.createScheduleHandler)
+	mux.HandleFunc("/accounts/{id}/schedules", svc.listSchedulesHandler)
+	mux.HandleFunc("/schedules", svc.listSchedulesHandler)
+	mux.HandleFunc("/schedules/{scheduleID}", svc.scheduleHandler)
+	mux.HandleFunc("/schedules/{scheduleID}/pause", svc.pauseScheduleHandler)
+	mux.HandleFunc("/schedules/{scheduleID}/resume", svc.resumeScheduleHandler)
+	mux.HandleFunc("/schedules/{scheduleID}/cancel", svc.cancelScheduleHandler)
+	mux.HandleFunc("/accounts/{id}/transactions", svc.listTransactionsHandler)
+	mux.HandleFunc("/accounts/{id}/statement", svc.statementHandler)
+	mux.HandleFunc("/transactions", svc.listTransactionsHandler)
+	mux.HandleFunc("/transactions/{txID}", svc.transactionHandler)
+	mux.HandleFunc("/transactions/{txID}/reverse", svc.reverseHandler)
+	mux.HandleFunc("/requests/{key}", svc.requestHandler)
+
+	mux.HandleFunc("/admin/accounts/{id}/overdraft", svc.setOverdraftHandler)
+	mux.HandleFunc("/admin/accounts/{id}/limits", svc.setLimitsHandler)
+	mux.HandleFunc("/admin/accounts/{id}/interest", svc.setInterestHandler)
+	mux.HandleFunc("/admin/accounts/{id}/status", svc.setStatusHandler)
+	mux.HandleFunc("/admin/reviews", svc.listReviewsHandler)
+	mux.HandleFunc("/admin/reviews/{reviewID}", svc.reviewHandler)
+	mux.HandleFunc("/admin/reviews/{reviewID}/approve", svc.approveReviewHandler)
+	mux.HandleFunc("/admin/reviews/{reviewID}/decline", svc.declineReviewHandler)
+	mux.HandleFunc("/admin/fraud-rules/reload", svc.reloadFraudRulesHandler)
+}
+
 // Shutdown stops the BankingService, preventing it from handling client reqests
 func (svc *BankingService) Shutdown() error {
 	log.Printf("Shut down requested for '%s' banking service", svc.bank.GetName())
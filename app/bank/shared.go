@@ -1,11 +1,192 @@
 package banking
 
 // InsufficientFundsError occurs when an account lacks the funds to
-// successfully perform the requested operation.
+// successfully perform the requested operation. For an account with
+// an overdraft limit, this means the operation would take the balance
+// below that limit rather than simply below zero.
 type InsufficientFundsError struct {
-	message string
+	message                string
+	overdraftLimitExceeded bool
 }
 
 func (e InsufficientFundsError) Error() string {
 	return e.message
 }
+
+// OverdraftLimitExceeded reports whether the operation failed because
+// it would exceed the account's overdraft limit, as opposed to the
+// balance of an account that has no overdraft.
+func (e InsufficientFundsError) OverdraftLimitExceeded() bool {
+	return e.overdraftLimitExceeded
+}
+
+// LimitExceededError occurs when an operation would exceed one of the
+// limits configured for an account, such as its maximum withdrawal or
+// the total that may be deposited or withdrawn in a day. Unlike an
+// InsufficientFundsError, it does not depend on the balance.
+type LimitExceededError struct {
+	message string
+}
+
+func (e LimitExceededError) Error() string {
+	return e.message
+}
+
+// AccountNotFoundError occurs when an operation refers to an account
+// that does not exist at the bank.
+type AccountNotFoundError struct {
+	message string
+}
+
+func (e AccountNotFoundError) Error() string {
+	return e.message
+}
+
+// AccountClosedError occurs when an operation would move money into or
+// out of an account that has been closed. Unlike an
+// AccountNotFoundError, the account exists, and its balance and history
+// may still be examined.
+type AccountClosedError struct {
+	message string
+}
+
+func (e AccountClosedError) Error() string {
+	return e.message
+}
+
+// AccountRestrictedError occurs when money would be withdrawn from an
+// account that is frozen or dormant. Such accounts still accept
+// deposits.
+type AccountRestrictedError struct {
+	message string
+	status  AccountStatus
+}
+
+func (e AccountRestrictedError) Error() string {
+	return e.message
+}
+
+// Status returns the status of the account that caused the operation
+// to be refused, which is AccountFrozen or AccountDormant.
+func (e AccountRestrictedError) Status() AccountStatus {
+	return e.status
+}
+
+// HoldNotFoundError occurs when an operation refers to a hold that
+// does not exist at the bank.
+type HoldNotFoundError struct {
+	message string
+}
+
+func (e HoldNotFoundError) Error() string {
+	return e.message
+}
+
+// ScheduleNotFoundError occurs when an operation refers to a schedule
+// that does not exist at the bank.
+type ScheduleNotFoundError struct {
+	message string
+}
+
+func (e ScheduleNotFoundError) Error() string {
+	return e.message
+}
+
+// ReviewNotFoundError occurs when an operation refers to a review that
+// does not exist at the bank.
+type ReviewNotFoundError struct {
+	message string
+}
+
+func (e ReviewNotFoundError) Error() string {
+	return e.message
+}
+
+// TransactionNotFoundError occurs when an operation refers to a
+// transaction that does not exist at the bank.
+type TransactionNotFoundError struct {
+	message string
+}
+
+func (e TransactionNotFoundError) Error() string {
+	return e.message
+}
+
+// RequestNotFoundError occurs when the bank has no record of a request
+// made with the specified idempotency key, meaning that it was never
+// processed.
+type RequestNotFoundError struct {
+	message string
+}
+
+func (e RequestNotFoundError) Error() string {
+	return e.message
+}
+
+// PreconditionFailedError occurs when an operation is made conditional
+// on the version of an account, and the account has changed since the
+// caller saw that version. Performing the operation anyway could undo
+// the effect of a change that the caller does not know about.
+type PreconditionFailedError struct {
+	message        string
+	currentVersion uint64
+}
+
+func (e PreconditionFailedError) Error() string {
+	return e.message
+}
+
+// CurrentVersion returns the version of the account when the operation
+// was refused, or zero if it is not known.
+func (e PreconditionFailedError) CurrentVersion() uint64 {
+	return e.currentVersion
+}
+
+// IdempotencyConflictError occurs when an idempotency key is reused
+// for a request whose parameters differ from those of the original
+// request made with that key.
+type IdempotencyConflictError struct {
+	message string
+}
+
+func (e IdempotencyConflictError) Error() string {
+	return e.message
+}
+
+// FraudSuspectedError occurs when a deposit or withdrawal is declined
+// by one of the bank's fraud rules, or was held for review and then
+// declined by an administrator.
+type FraudSuspectedError struct {
+	message string
+	rule    string
+}
+
+func (e FraudSuspectedError) Error() string {
+	return e.message
+}
+
+// Rule returns the name of the fraud rule that the transaction matched,
+// or an empty string if it is not known.
+func (e FraudSuspectedError) Rule() string {
+	return e.rule
+}
+
+// PendingReviewError occurs when a deposit or withdrawal matches one of
+// the bank's fraud rules that holds it for review by an administrator.
+// The transaction has not been made, but will be if it is approved;
+// retrying the request with the same idempotency key returns its outcome
+// once the review is resolved.
+type PendingReviewError struct {
+	message  string
+	reviewID string
+}
+
+func (e PendingReviewError) Error() string {
+	return e.message
+}
+
+// ReviewID returns the ID of the review in which the transaction is
+// held, or an empty string if it is not known.
+func (e PendingReviewError) ReviewID() string {
+	return e.reviewID
+}
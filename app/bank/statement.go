@@ -0,0 +1,262 @@
+package banking
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// StatementFormat identifies a file format in which a statement can be
+// written
+type StatementFormat string
+
+const (
+	// StatementCSV is a comma-separated values file, suitable for
+	// spreadsheets
+	StatementCSV StatementFormat = "csv"
+	// StatementOFX is an Open Financial Exchange (version 2) file, which
+	// most personal finance applications can import
+	StatementOFX StatementFormat = "ofx"
+	// StatementQIF is a Quicken Interchange Format file
+	StatementQIF StatementFormat = "qif"
+)
+
+// ContentType returns the MIME type of files in this format
+func (format StatementFormat) ContentType() string {
+	switch format {
+	case StatementOFX:
+		return "application/x-ofx"
+	case StatementQIF:
+		return "application/qif"
+	}
+
+	return "text/csv"
+}
+
+// Statement lists the transactions posted to an account during a
+// period, along with its balance at the start and end of that period.
+// Each entry's Balance is the running balance after that transaction.
+type Statement struct {
+	BankName       string
+	AccountID      string
+	Currency       string
+	From           time.Time // inclusive
+	To             time.Time // exclusive
+	OpeningBalance Money
+	ClosingBalance Money
+	Entries        []LedgerEntry
+}
+
+// GetStatement returns the statement for the specified account covering
+// the period from one time (inclusive) to another (exclusive). A zero
+// From starts the statement with the account's first transaction, and
+// a zero To ends it at the current time (or at From, if that is later).
+// This returns an AccountNotFoundError if there is no such account.
+func (bank *Bank) GetStatement(accountID string, from time.Time, to time.Time) (Statement, error) {
+	bank.lock.RLock()
+	defer bank.lock.RUnlock()
+
+	entries, err := bank.accountLedger(accountID)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	if to.IsZero() {
+		to = bank.now().UTC()
+		if to.Before(from) {
+			to = from
+		}
+	}
+
+	if from.IsZero() {
+		from = to
+		if len(entries) > 0 && entries[0].Timestamp.Before(to) {
+			from = entries[0].Timestamp
+		}
+	}
+
+	if to.Before(from) {
+		return Statement{}, fmt.Errorf("statement period ends (%s) before it starts (%s)",
+			to.Format(time.RFC3339), from.Format(time.RFC3339))
+	}
+
+	acct, err := bank.getAccount(accountID)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	statement := Statement{
+		BankName:  bank.name,
+		AccountID: accountID,
+		Currency:  acct.Currency,
+		From:      from,
+		To:        to,
+		Entries:   []LedgerEntry{},
+	}
+
+	// the balance after the last entry before the period is the opening
+	// balance, and the balance after the last entry within it is the
+	// closing balance
+	for _, entry := range entries {
+		if entry.Timestamp.Before(from) {
+			statement.OpeningBalance = entry.Balance
+		} else if entry.Timestamp.Before(to) {
+			statement.Entries = append(statement.Entries, entry)
+		}
+	}
+
+	statement.ClosingBalance = statement.OpeningBalance
+	if len(statement.Entries) > 0 {
+		statement.ClosingBalance = statement.Entries[len(statement.Entries)-1].Balance
+	}
+
+	return statement, nil
+}
+
+// ParseStatementFormat returns the format with the specified name (such
+// as "csv" or "OFX"), or an error if there is no such format
+func ParseStatementFormat(name string) (StatementFormat, error) {
+	format := StatementFormat(strings.ToLower(name))
+	switch format {
+	case StatementCSV, StatementOFX, StatementQIF:
+		return format, nil
+	}
+
+	return "", fmt.Errorf("unsupported statement format: '%s' (must be csv, ofx, or qif)", name)
+}
+
+// Write writes the statement to w in the specified format
+func (statement Statement) Write(w io.Writer, format StatementFormat) error {
+	switch format {
+	case StatementCSV:
+		return statement.writeCSV(w)
+	case StatementOFX:
+		return statement.writeOFX(w)
+	case StatementQIF:
+		return statement.writeQIF(w)
+	}
+
+	return fmt.Errorf("unsupported statement format: '%s'", format)
+}
+
+// Writes the statement as CSV, with a row for the opening balance, one
+// row for each transaction (with its amount signed by its effect on the
+// balance), and a row for the closing balance
+func (statement Statement) writeCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	_ = out.Write([]string{"Date", "Transaction ID", "Type", "Description", "Amount", "Balance", "Currency"})
+	_ = out.Write([]string{statement.From.Format(time.RFC3339), "", "", "Opening balance", "",
+		statement.OpeningBalance.String(), statement.Currency})
+
+	for _, entry := range statement.Entries {
+		_ = out.Write([]string{entry.Timestamp.Format(time.RFC3339), entry.TransactionID, string(entry.Type),
+			entry.description(), entry.delta().String(), entry.Balance.String(), statement.Currency})
+	}
+
+	_ = out.Write([]string{statement.To.Format(time.RFC3339), "", "", "Closing balance", "",
+		statement.ClosingBalance.String(), statement.Currency})
+
+	out.Flush()
+	return out.Error()
+}
+
+// Writes the statement as an OFX 2 bank statement response. OFX has no
+// field for the opening balance or running balances, so the running
+// balance is included in each transaction's memo, and the closing
+// balance is reported as the ledger balance.
+func (statement Statement) writeOFX(w io.Writer) error {
+	const ofxTime = "20060102150405"
+	var sb strings.Builder
+
+	sb.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	sb.WriteString("<?OFX OFXHEADER=\"200\" VERSION=\"220\" SECURITY=\"NONE\" OLDFILEUID=\"NONE\" NEWFILEUID=\"NONE\"?>\n")
+	sb.WriteString("<OFX>\n")
+	sb.WriteString("  <SIGNONMSGSRSV1><SONRS>\n")
+	sb.WriteString("    <STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\n")
+	fmt.Fprintf(&sb, "    <DTSERVER>%s</DTSERVER><LANGUAGE>ENG</LANGUAGE>\n", time.Now().UTC().Format(ofxTime))
+	sb.WriteString("  </SONRS></SIGNONMSGSRSV1>\n")
+	sb.WriteString("  <BANKMSGSRSV1><STMTTRNRS>\n")
+	sb.WriteString("    <TRNUID>0</TRNUID>\n")
+	sb.WriteString("    <STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\n")
+	sb.WriteString("    <STMTRS>\n")
+	fmt.Fprintf(&sb, "      <CURDEF>%s</CURDEF>\n", escapeXML(statement.Currency))
+	fmt.Fprintf(&sb, "      <BANKACCTFROM><BANKID>%s</BANKID><ACCTID>%s</ACCTID><ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTFROM>\n",
+		escapeXML(statement.BankName), escapeXML(statement.AccountID))
+	sb.WriteString("      <BANKTRANLIST>\n")
+	fmt.Fprintf(&sb, "        <DTSTART>%s</DTSTART><DTEND>%s</DTEND>\n",
+		statement.From.UTC().Format(ofxTime), statement.To.UTC().Format(ofxTime))
+
+	for _, entry := range statement.Entries {
+		trnType := "CREDIT"
+		if entry.delta() < 0 {
+			trnType = "DEBIT"
+		}
+
+		sb.WriteString("        <STMTTRN>\n")
+		fmt.Fprintf(&sb, "          <TRNTYPE>%s</TRNTYPE><DTPOSTED>%s</DTPOSTED><TRNAMT>%s</TRNAMT>\n",
+			trnType, entry.Timestamp.UTC().Format(ofxTime), entry.delta())
+		fmt.Fprintf(&sb, "          <FITID>%s</FITID><NAME>%s</NAME><MEMO>%s</MEMO>\n",
+			escapeXML(entry.TransactionID), escapeXML(string(entry.Type)),
+			escapeXML(fmt.Sprintf("%s; balance %s", entry.description(), entry.Balance)))
+		sb.WriteString("        </STMTTRN>\n")
+	}
+
+	sb.WriteString("      </BANKTRANLIST>\n")
+	fmt.Fprintf(&sb, "      <LEDGERBAL><BALAMT>%s</BALAMT><DTASOF>%s</DTASOF></LEDGERBAL>\n",
+		statement.ClosingBalance, statement.To.UTC().Format(ofxTime))
+	sb.WriteString("    </STMTRS>\n")
+	sb.WriteString("  </STMTTRNRS></BANKMSGSRSV1>\n")
+	sb.WriteString("</OFX>\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// Writes the statement as a QIF bank account. By convention, the first
+// record is the opening balance, transferred from the account itself.
+// The running balance is included in each transaction's memo.
+func (statement Statement) writeQIF(w io.Writer) error {
+	const qifDate = "01/02/2006"
+	var sb strings.Builder
+
+	sb.WriteString("!Type:Bank\n")
+	fmt.Fprintf(&sb, "D%s\nT%s\nPOpening Balance\nL[%s]\n^\n",
+		statement.From.Format(qifDate), statement.OpeningBalance, statement.AccountID)
+
+	for _, entry := range statement.Entries {
+		fmt.Fprintf(&sb, "D%s\nT%s\nN%s\nP%s\nM%s; balance %s\n^\n",
+			entry.Timestamp.Format(qifDate), entry.delta(), entry.TransactionID, entry.Type,
+			entry.description(), entry.Balance)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// Returns a short description of the entry for statements, which notes
+// the details that its type alone does not convey
+func (entry LedgerEntry) description() string {
+	switch {
+	case entry.ReversalOf != "":
+		return fmt.Sprintf("Reversal of %s", entry.ReversalOf)
+	case entry.FeeFor != "":
+		return fmt.Sprintf("Fee for %s", entry.FeeFor)
+	case entry.HoldID != "":
+		return fmt.Sprintf("Capture of hold %s", entry.HoldID)
+	case entry.OriginalCurrency != "":
+		return fmt.Sprintf("%s %s at %s (fee %s)",
+			entry.OriginalAmount, entry.OriginalCurrency, entry.ExchangeRate, entry.ConversionFee)
+	}
+
+	return strings.ReplaceAll(strings.ToLower(string(entry.Type)), "_", " ")
+}
+
+// Returns the text with the characters that are special in XML escaped
+func escapeXML(text string) string {
+	var sb strings.Builder
+	_ = xml.EscapeText(&sb, []byte(text))
+	return sb.String()
+}
@@ -0,0 +1,162 @@
+package banking
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns a bank with a deposit of 100.00 on February 2nd, followed by
+// a withdrawal of 30.00 on the 3rd and a reversal of 10.00 of it on the
+// 4th, along with the IDs of the withdrawal and the reversal
+func newStatementTestBank(t *testing.T) (*Bank, string, string) {
+	t.Helper()
+	bank := newTestBank(t, StorageMemory, false)
+	clock := &fakeClock{now: time.Date(2026, time.February, 2, 9, 0, 0, 0, time.UTC)}
+	bank.SetClock(clock)
+
+	if _, err := bank.Deposit(Dollars(100), ""); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(24 * time.Hour)
+	withdrawalID, err := bank.Withdraw(Dollars(30), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(24 * time.Hour)
+	reversalID, err := bank.ReverseTransaction(withdrawalID, Dollars(10), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(24 * time.Hour)
+
+	return bank, withdrawalID, reversalID
+}
+
+func TestGetStatement(t *testing.T) {
+	bank, withdrawalID, reversalID := newStatementTestBank(t)
+
+	from := time.Date(2026, time.February, 3, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, time.February, 5, 0, 0, 0, 0, time.UTC)
+	statement, err := bank.GetStatement(DefaultAccountID, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statement.OpeningBalance != Dollars(100) || statement.ClosingBalance != Dollars(80) || len(statement.Entries) != 2 ||
+		statement.Entries[0].TransactionID != withdrawalID || statement.Entries[1].TransactionID != reversalID {
+		t.Errorf("statement is %+v, want the withdrawal and reversal from 100.00 to 80.00", statement)
+	}
+
+	// an open period covers every transaction, and a period without
+	// any has the same opening and closing balance
+	statement, err = bank.GetStatement(DefaultAccountID, time.Time{}, time.Time{})
+	if err != nil || statement.OpeningBalance != 0 || statement.ClosingBalance != Dollars(80) || len(statement.Entries) != 3 {
+		t.Errorf("statement for open period is %+v (error: %v), want all 3 transactions", statement, err)
+	}
+	statement, err = bank.GetStatement(DefaultAccountID, to, time.Time{})
+	if err != nil || statement.OpeningBalance != Dollars(80) || statement.ClosingBalance != Dollars(80) || len(statement.Entries) != 0 {
+		t.Errorf("statement for period without transactions is %+v (error: %v), want 80.00 throughout", statement, err)
+	}
+
+	if _, err := bank.GetStatement(DefaultAccountID, to, from); err == nil {
+		t.Error("returned a statement for a period that ends before it starts")
+	}
+	var notFound AccountNotFoundError
+	if _, err := bank.GetStatement("missing", from, to); !errors.As(err, &notFound) {
+		t.Errorf("statement for unknown account returned %v, want an AccountNotFoundError", err)
+	}
+}
+
+func TestStatementFormats(t *testing.T) {
+	bank, withdrawalID, reversalID := newStatementTestBank(t)
+	from := time.Date(2026, time.February, 3, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, time.February, 5, 0, 0, 0, 0, time.UTC)
+	statement, err := bank.GetStatement(DefaultAccountID, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(format StatementFormat) string {
+		t.Helper()
+		var sb strings.Builder
+		if err := statement.Write(&sb, format); err != nil {
+			t.Fatalf("writing %s statement failed: %v", format, err)
+		}
+		return sb.String()
+	}
+
+	// amounts are signed by their effect on the balance
+	wantCSV := "Date,Transaction ID,Type,Description,Amount,Balance,Currency\n" +
+		"2026-02-03T00:00:00Z,,,Opening balance,,100.00,USD\n" +
+		"2026-02-03T09:00:00Z," + withdrawalID + ",WITHDRAWAL,withdrawal,-30.00,70.00,USD\n" +
+		"2026-02-04T09:00:00Z," + reversalID + ",WITHDRAWAL_REVERSAL,Reversal of " + withdrawalID + ",10.00,80.00,USD\n" +
+		"2026-02-05T00:00:00Z,,,Closing balance,,80.00,USD\n"
+	if csv := write(StatementCSV); csv != wantCSV {
+		t.Errorf("CSV statement is\n%s\nwant\n%s", csv, wantCSV)
+	}
+
+	wantQIF := "!Type:Bank\n" +
+		"D02/03/2026\nT100.00\nPOpening Balance\nL[" + DefaultAccountID + "]\n^\n" +
+		"D02/03/2026\nT-30.00\nN" + withdrawalID + "\nPWITHDRAWAL\nMwithdrawal; balance 70.00\n^\n" +
+		"D02/04/2026\nT10.00\nN" + reversalID + "\nPWITHDRAWAL_REVERSAL\nMReversal of " + withdrawalID + "; balance 80.00\n^\n"
+	if qif := write(StatementQIF); qif != wantQIF {
+		t.Errorf("QIF statement is\n%s\nwant\n%s", qif, wantQIF)
+	}
+
+	ofx := write(StatementOFX)
+	for _, want := range []string{
+		"<CURDEF>USD</CURDEF>",
+		"<DTSTART>20260203000000</DTSTART><DTEND>20260205000000</DTEND>",
+		"<TRNTYPE>DEBIT</TRNTYPE><DTPOSTED>20260203090000</DTPOSTED><TRNAMT>-30.00</TRNAMT>",
+		"<FITID>" + withdrawalID + "</FITID><NAME>WITHDRAWAL</NAME><MEMO>withdrawal; balance 70.00</MEMO>",
+		"<TRNTYPE>CREDIT</TRNTYPE><DTPOSTED>20260204090000</DTPOSTED><TRNAMT>10.00</TRNAMT>",
+		"<LEDGERBAL><BALAMT>80.00</BALAMT><DTASOF>20260205000000</DTASOF></LEDGERBAL>",
+	} {
+		if !strings.Contains(ofx, want) {
+			t.Errorf("OFX statement does not contain %s:\n%s", want, ofx)
+		}
+	}
+
+	// text in OFX statements is escaped, so that they remain valid XML
+	statement.BankName = "Smith & <Sons>"
+	ofx = write(StatementOFX)
+	if !strings.Contains(ofx, "<BANKID>Smith &amp; &lt;Sons&gt;</BANKID>") {
+		t.Errorf("OFX statement does not escape the bank name:\n%s", ofx)
+	}
+	decoder := xml.NewDecoder(strings.NewReader(ofx))
+	for {
+		if _, err := decoder.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("OFX statement is not valid XML: %v", err)
+		}
+	}
+
+	// the client receives the statement as written
+	client, _ := newTestClient(t, bank)
+	if csv, err := client.GetStatement(DefaultAccountID, from, to, StatementCSV); err != nil || csv != wantCSV {
+		t.Errorf("client returned CSV statement (error: %v)\n%s\nwant\n%s", err, csv, wantCSV)
+	}
+	if qif, err := client.GetStatement(DefaultAccountID, from, to, StatementQIF); err != nil || qif != wantQIF {
+		t.Errorf("client returned QIF statement (error: %v)\n%s\nwant\n%s", err, qif, wantQIF)
+	}
+}
+
+func TestParseStatementFormat(t *testing.T) {
+	for name, want := range map[string]StatementFormat{"csv": StatementCSV, "OFX": StatementOFX, "Qif": StatementQIF} {
+		if format, err := ParseStatementFormat(name); err != nil || format != want {
+			t.Errorf("format '%s' is (%s, %v), want %s", name, format, err, want)
+		}
+	}
+	for _, name := range []string{"", "pdf", "csv "} {
+		if format, err := ParseStatementFormat(name); err == nil {
+			t.Errorf("format '%s' is %s, want an error", name, format)
+		}
+	}
+	if contentType := StatementOFX.ContentType(); contentType != "application/x-ofx" {
+		t.Errorf("content type of OFX is %s, want application/x-ofx", contentType)
+	}
+}
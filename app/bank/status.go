@@ -0,0 +1,198 @@
+package banking
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// AccountStatus is the stage of its lifecycle that an account is in,
+// which determines the operations that it accepts
+type AccountStatus string
+
+const (
+	// AccountOpen is the status of an account that accepts every
+	// operation, which is the status of every new account
+	AccountOpen AccountStatus = "OPEN"
+
+	// AccountFrozen is the status of an account that accepts deposits
+	// but refuses withdrawals, such as while suspicious activity is
+	// investigated
+	AccountFrozen AccountStatus = "FROZEN"
+
+	// AccountDormant is the status of an account that has been unused
+	// for a long time. It accepts deposits but refuses withdrawals until
+	// it is reactivated, so that a forgotten account cannot be emptied
+	// without its owner noticing.
+	AccountDormant AccountStatus = "DORMANT"
+
+	// AccountClosed is the status of an account that refuses every
+	// operation that would move money into or out of it. Its balance
+	// and history are kept, so it can still be examined.
+	AccountClosed AccountStatus = "CLOSED"
+)
+
+// the statuses to which an account in each status may be changed. A
+// closed account may be reopened, such as when it was closed in error.
+var accountTransitions = map[AccountStatus][]AccountStatus{
+	AccountOpen:    {AccountFrozen, AccountDormant, AccountClosed},
+	AccountFrozen:  {AccountOpen, AccountClosed},
+	AccountDormant: {AccountOpen, AccountFrozen, AccountClosed},
+	AccountClosed:  {AccountOpen},
+}
+
+// AccountState describes the status of an account, along with the
+// reason it was last changed and when
+type AccountState struct {
+	Status  AccountStatus `json:"status"`
+	Reason  string        `json:"reason,omitempty"`
+	Changed time.Time     `json:"changed"` // zero if the account has always been open
+}
+
+// ParseAccountStatus returns the account status with the specified
+// name, such as "frozen", regardless of case
+func ParseAccountStatus(name string) (AccountStatus, error) {
+	status := AccountStatus(strings.ToUpper(strings.TrimSpace(name)))
+	if _, valid := accountTransitions[status]; !valid {
+		return "", fmt.Errorf("invalid account status: '%s'", name)
+	}
+
+	return status, nil
+}
+
+// GetAccountState returns the status of the specified account, or an
+// AccountNotFoundError if there is no such account.
+func (bank *Bank) GetAccountState(accountID string) (AccountState, error) {
+	bank.lock.RLock()
+	defer bank.lock.RUnlock()
+
+	acct, err := bank.getAccount(accountID)
+	if err != nil {
+		return AccountState{}, err
+	}
+
+	if acct.State == nil {
+		return AccountState{Status: AccountOpen}, nil
+	}
+
+	return *acct.State, nil
+}
+
+// SetAccountStatus changes the status of the specified account, giving
+// the reason for the change, which is required. Unlike CloseAccount,
+// this may close any account, including the default account and one
+// with a balance, since the balance is kept and is available again if
+// the account is reopened. Closing an account cancels its schedules,
+// and no interest is accrued while it is closed. This returns an error
+// if the status is invalid or cannot follow the account's current
+// status, or an AccountNotFoundError if there is no such account.
+func (bank *Bank) SetAccountStatus(accountID string, status AccountStatus, reason string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return fmt.Errorf("a reason is required to change the status of an account")
+	}
+
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	acct, err := bank.getAccount(accountID)
+	if err != nil {
+		return err
+	}
+
+	return bank.changeAccountStatus(acct, status, reason)
+}
+
+// Changes the status of the account as described for SetAccountStatus.
+// The caller must hold lock exclusively.
+func (bank *Bank) changeAccountStatus(acct *account, status AccountStatus, reason string) error {
+	current := acct.status()
+	if !acct.canChangeTo(status) {
+		return fmt.Errorf("account '%s' cannot be changed from %s to %s", acct.ID, current, status)
+	}
+
+	now := bank.now()
+	change := walRecord{}
+	if status == AccountClosed {
+		// interest up to now is accrued before it stops
+		if acct.Interest != nil {
+			entry, err := bank.accrueInterest(acct, now)
+			if err != nil {
+				return err
+			}
+			if entry != nil {
+				change.Ledger = append(change.Ledger, *entry)
+			}
+		}
+		change.Schedules = bank.cancelAccountSchedules(acct.ID)
+	} else if current == AccountClosed && acct.Interest != nil {
+		// no interest is earned for the time the account was closed
+		interest := *acct.Interest
+		interest.AccruedThrough = bank.interestDay(now)
+		acct.Interest = &interest
+	}
+
+	acct.State = &AccountState{Status: status, Reason: reason, Changed: now.UTC()}
+	acct.Version++
+	change.Accounts = []account{*acct}
+
+	err := bank.commit(change)
+	if err != nil {
+		log.Printf("ERROR: could not save account data following status change: %v\n", err)
+		return err
+	}
+
+	log.Printf("Changed status of '%s' account '%s' from %s to %s: %s", bank.name, acct.ID, current, status, reason)
+	return nil
+}
+
+// Returns the status of the account. Accounts saved before statuses
+// were introduced have no state, and are open.
+func (acct *account) status() AccountStatus {
+	if acct.State == nil {
+		return AccountOpen
+	}
+
+	return acct.State.Status
+}
+
+// Reports whether the account's status may be changed to the specified
+// one
+func (acct *account) canChangeTo(status AccountStatus) bool {
+	for _, allowed := range accountTransitions[acct.status()] {
+		if allowed == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns an AccountClosedError if the account is closed, since money
+// may be deposited to an account in any other status
+func (acct *account) checkCanDeposit() error {
+	if acct.status() == AccountClosed {
+		return AccountClosedError{message: fmt.Sprintf("account '%s' is closed", acct.ID)}
+	}
+
+	return nil
+}
+
+// Returns an AccountClosedError if the account is closed, or an
+// AccountRestrictedError if it is frozen or dormant, since money may
+// only be withdrawn from an open account
+func (acct *account) checkCanWithdraw() error {
+	switch status := acct.status(); status {
+	case AccountOpen:
+		return nil
+	case AccountClosed:
+		return AccountClosedError{message: fmt.Sprintf("account '%s' is closed", acct.ID)}
+	default:
+		msg := "account '%s' is %s, so no money may be withdrawn from it"
+		return AccountRestrictedError{
+			message: fmt.Sprintf(msg, acct.ID, strings.ToLower(string(status))),
+			status:  status,
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package banking
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestAccountStatusRestrictsOperations(t *testing.T) {
+	discardLogOutput(t)
+	path := filepath.Join(t.TempDir(), "bank-test.dat")
+
+	bank := NewBankWithStorage("test", NewFileStorage(path))
+	if err := bank.OpenAccount("checking", DefaultCurrency); err != nil {
+		t.Fatal(err)
+	}
+	depositID, err := bank.DepositToAccount("checking", Dollars(100), "", "first-deposit", AnyVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a frozen account accepts deposits but not withdrawals or holds
+	if err := bank.SetAccountStatus("checking", AccountFrozen, "suspicious activity"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bank.DepositToAccount("checking", Dollars(10), "", "", AnyVersion); err != nil {
+		t.Errorf("deposit to frozen account failed: %v", err)
+	}
+
+	var restricted AccountRestrictedError
+	_, err = bank.WithdrawFromAccount("checking", Dollars(10), "", "", AnyVersion)
+	if !errors.As(err, &restricted) || restricted.Status() != AccountFrozen {
+		t.Errorf("withdrawal from frozen account returned %v, want an AccountRestrictedError", err)
+	}
+	if _, err := bank.AuthorizeHold("checking", Dollars(10), ""); !errors.As(err, &restricted) {
+		t.Errorf("hold on frozen account returned %v, want an AccountRestrictedError", err)
+	}
+
+	// only some changes of status are allowed
+	if err := bank.SetAccountStatus("checking", AccountDormant, "unused"); err == nil {
+		t.Error("changed a frozen account to dormant")
+	}
+	if err := bank.SetAccountStatus("checking", AccountOpen, ""); err == nil {
+		t.Error("changed the status of an account without a reason")
+	}
+
+	// an administrator may close an account with a balance, which is
+	// kept across sessions
+	if err := bank.SetAccountStatus("checking", AccountClosed, "fraud confirmed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bank.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bank = NewBankWithStorage("test", NewFileStorage(path))
+	t.Cleanup(func() { bank.Close() })
+
+	state, err := bank.GetAccountState("checking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Status != AccountClosed || state.Reason != "fraud confirmed" || state.Changed.IsZero() {
+		t.Errorf("state after closing is %+v, want it closed for fraud", state)
+	}
+
+	// a closed account accepts no deposits or withdrawals, but a retried
+	// request returns its original result
+	var closed AccountClosedError
+	if _, err := bank.DepositToAccount("checking", Dollars(10), "", "", AnyVersion); !errors.As(err, &closed) {
+		t.Errorf("deposit to closed account returned %v, want an AccountClosedError", err)
+	}
+	if _, err := bank.WithdrawFromAccount("checking", Dollars(10), "", "", AnyVersion); !errors.As(err, &closed) {
+		t.Errorf("withdrawal from closed account returned %v, want an AccountClosedError", err)
+	}
+	if txID, err := bank.DepositToAccount("checking", Dollars(100), "", "first-deposit", AnyVersion); err != nil || txID != depositID {
+		t.Errorf("retried deposit returned (%s, %v), want (%s, nil)", txID, err, depositID)
+	}
+	if balance, err := bank.GetAccountBalance("checking"); err != nil || balance != Dollars(110) {
+		t.Errorf("balance of closed account is %s (error: %v), want 110.00", balance, err)
+	}
+
+	// once reopened, the balance may be withdrawn and the account closed
+	// by its owner
+	if err := bank.SetAccountStatus("checking", AccountOpen, "closed in error"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bank.WithdrawFromAccount("checking", Dollars(110), "", "", AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	if err := bank.CloseAccount("checking"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bank.CloseAccount("checking"); !errors.As(err, &closed) {
+		t.Errorf("closing a closed account returned %v, want an AccountClosedError", err)
+	}
+	if err := bank.OpenAccount("checking", DefaultCurrency); err == nil {
+		t.Error("opened an account with the ID of a closed account")
+	}
+	checkLedger(t, bank)
+}
+
+func TestClientReturnsAccountStatusErrors(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	if _, err := bank.Deposit(Dollars(100), ""); err != nil {
+		t.Fatal(err)
+	}
+	client, _ := newTestClient(t, bank)
+
+	if err := bank.SetAccountStatus(DefaultAccountID, AccountDormant, "no activity for a year"); err != nil {
+		t.Fatal(err)
+	}
+	var restricted AccountRestrictedError
+	if _, err := client.Withdraw(Dollars(10), ""); !errors.As(err, &restricted) || restricted.Status() != AccountDormant {
+		t.Errorf("withdrawal from dormant account returned %v, want an AccountRestrictedError", err)
+	}
+
+	// the default account may be closed by an administrator
+	if err := bank.SetAccountStatus(DefaultAccountID, AccountClosed, "customer deceased"); err != nil {
+		t.Fatal(err)
+	}
+	var closed AccountClosedError
+	if _, err := client.Deposit(Dollars(10), ""); !errors.As(err, &closed) {
+		t.Errorf("deposit to closed account returned %v, want an AccountClosedError", err)
+	}
+}
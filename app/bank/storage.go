@@ -0,0 +1,335 @@
+package banking
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Storage persists the data of a Bank between sessions. The Bank
+// encodes its data as a single document (see datafile.go), which it
+// saves periodically as a snapshot, and records each change made since
+// the last snapshot in a write-ahead log (see wal.go). A backend only
+// needs to store and retrieve the document as a whole and keep the log
+// as a sequence of opaque records. Implementations must be safe for use
+// by multiple goroutines.
+type Storage interface {
+	// Load returns the document that was most recently saved, or nil
+	// if nothing has been saved.
+	Load() ([]byte, error)
+	// Save replaces the saved document. If it returns an error, the
+	// previously saved document must remain intact.
+	Save(content []byte) error
+	// AppendLog appends records to the write-ahead log, in order. It
+	// must not return until the records are durable, meaning that they
+	// would be returned by ReadLog even if the process crashed
+	// immediately after. Appending several records at once allows the
+	// backend to make them durable together, which is much faster than
+	// doing so for each one.
+	AppendLog(records ...[]byte) error
+	// ReadLog returns the records in the write-ahead log, oldest first.
+	// A record that was only partly written when a crash occurred is
+	// discarded.
+	ReadLog() ([][]byte, error)
+	// TruncateLog removes every record from the write-ahead log, once
+	// the changes they record are included in a saved document.
+	TruncateLog() error
+	// Backup keeps a copy of the saved document under the specified
+	// label, such as before it is migrated to a new format, so that it
+	// is not lost when the document is next saved.
+	Backup(label string, content []byte) error
+	// Close releases any resources held by the backend.
+	Close() error
+	// String describes where the data is stored, for log messages.
+	String() string
+}
+
+// The kinds of storage backend that OpenStorage can open
+const (
+	// StorageFile keeps the data in a JSON file in the working directory
+	StorageFile = "file"
+	// StorageMemory keeps the data in memory, so it is lost when the
+	// process exits; this is useful for tests
+	StorageMemory = "memory"
+	// StorageBolt keeps the data in a bbolt database in the working
+	// directory
+	StorageBolt = "bolt"
+)
+
+// OpenStorage opens the specified kind of storage backend (StorageFile,
+// StorageMemory, or StorageBolt) for the named bank, using a file name
+// based on the bank's name for backends that store data on disk.
+func OpenStorage(kind string, bankName string) (Storage, error) {
+	switch strings.ToLower(kind) {
+	case StorageFile:
+		return NewFileStorage(dataPath(bankName, "dat")), nil
+	case StorageMemory:
+		return NewMemoryStorage(), nil
+	case StorageBolt:
+		return OpenBoltStorage(dataPath(bankName, "db"))
+	}
+
+	return nil, fmt.Errorf("unsupported storage: '%s' (must be %s, %s, or %s)", kind, StorageFile, StorageMemory, StorageBolt)
+}
+
+// MemoryStorage is a Storage backend that keeps the data in memory.
+type MemoryStorage struct {
+	content []byte
+	log     [][]byte
+	backups map[string][]byte
+	lock    sync.Mutex
+}
+
+// NewMemoryStorage returns an empty MemoryStorage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{backups: make(map[string][]byte)}
+}
+
+// Load returns a copy of the document that was most recently saved,
+// or nil if nothing has been saved.
+func (storage *MemoryStorage) Load() ([]byte, error) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if storage.content == nil {
+		return nil, nil
+	}
+
+	return append([]byte(nil), storage.content...), nil
+}
+
+// Save replaces the saved document with a copy of the content
+func (storage *MemoryStorage) Save(content []byte) error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	storage.content = append([]byte(nil), content...)
+	return nil
+}
+
+// AppendLog appends copies of the records to the log
+func (storage *MemoryStorage) AppendLog(records ...[]byte) error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	for _, record := range records {
+		storage.log = append(storage.log, append([]byte(nil), record...))
+	}
+	return nil
+}
+
+// ReadLog returns the records in the log, oldest first
+func (storage *MemoryStorage) ReadLog() ([][]byte, error) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	return append([][]byte(nil), storage.log...), nil
+}
+
+// TruncateLog removes every record from the log
+func (storage *MemoryStorage) TruncateLog() error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	storage.log = nil
+	return nil
+}
+
+// Backup keeps a copy of the content under the specified label
+func (storage *MemoryStorage) Backup(label string, content []byte) error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	storage.backups[label] = append([]byte(nil), content...)
+	return nil
+}
+
+// Close has no effect, since the data is only held in memory
+func (storage *MemoryStorage) Close() error {
+	return nil
+}
+
+func (storage *MemoryStorage) String() string {
+	return "memory"
+}
+
+// FileStorage is a Storage backend that keeps the data in a file. The
+// file is replaced atomically each time it is saved, and backups are
+// kept alongside it, named by adding their label as a suffix. The
+// write-ahead log is kept in another file alongside it, with a .wal
+// suffix, which is flushed to disk each time records are appended.
+type FileStorage struct {
+	path    string
+	walFile *os.File // opened for appending when first needed
+	lock    sync.Mutex
+}
+
+// NewFileStorage returns a FileStorage that keeps the data in the file
+// at the specified path, which need not exist yet.
+func NewFileStorage(path string) *FileStorage {
+	return &FileStorage{path: path}
+}
+
+// Load returns the contents of the file, or nil if it does not exist.
+// Temporary files left behind by a save that was interrupted by a
+// crash are removed.
+func (storage *FileStorage) Load() ([]byte, error) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	removeTempFiles(storage.path)
+
+	content, err := os.ReadFile(storage.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return content, err
+}
+
+// Save atomically replaces the file with one containing the content
+func (storage *FileStorage) Save(content []byte) error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	return writeFileAtomically(storage.path, content)
+}
+
+// AppendLog appends the records to the log file with a single write,
+// and then flushes it to disk
+func (storage *FileStorage) AppendLog(records ...[]byte) error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if storage.walFile == nil {
+		_, statErr := os.Stat(storage.walPath())
+		file, err := os.OpenFile(storage.walPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+
+		// the log file itself must survive a crash, not just its contents
+		if os.IsNotExist(statErr) {
+			if err := syncDir(filepath.Dir(storage.path)); err != nil {
+				file.Close()
+				return err
+			}
+		}
+
+		storage.walFile = file
+	}
+
+	info, err := storage.walFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	var frames []byte
+	for _, record := range records {
+		frames = append(frames, encodeLogRecord(record)...)
+	}
+
+	// a failed write may leave part of a record in the file, which
+	// would hide every record appended after it
+	if _, err := storage.walFile.Write(frames); err != nil {
+		storage.walFile.Truncate(info.Size())
+		return err
+	}
+
+	return storage.walFile.Sync()
+}
+
+// ReadLog returns the records in the log file, oldest first. If the
+// file ends with a record that was only partly written, that record is
+// discarded and the file is truncated, so that later records are not
+// appended after it.
+func (storage *FileStorage) ReadLog() ([][]byte, error) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	content, err := os.ReadFile(storage.walPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	records, valid := decodeLogRecords(content)
+	if valid < len(content) {
+		log.Printf("WARNING: discarding %d bytes of incomplete records at the end of '%s'",
+			len(content)-valid, storage.walPath())
+		if err := storage.truncateLog(int64(valid)); err != nil {
+			return nil, err
+		}
+	}
+
+	return records, nil
+}
+
+// TruncateLog empties the log file
+func (storage *FileStorage) TruncateLog() error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	return storage.truncateLog(0)
+}
+
+// Truncates the log file to the specified size and flushes it to disk.
+// The caller must hold lock.
+func (storage *FileStorage) truncateLog(size int64) error {
+	if storage.walFile != nil {
+		if err := storage.walFile.Truncate(size); err != nil {
+			return err
+		}
+		return storage.walFile.Sync()
+	}
+
+	file, err := os.OpenFile(storage.walPath(), os.O_WRONLY, 0644)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := file.Truncate(size); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+// Returns the path of the log file
+func (storage *FileStorage) walPath() string {
+	return storage.path + ".wal"
+}
+
+// Backup writes the content to a file next to the data file, named by
+// adding the label as a suffix
+func (storage *FileStorage) Backup(label string, content []byte) error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	return writeFileAtomically(storage.path+"."+label, content)
+}
+
+// Close closes the log file, if it is open
+func (storage *FileStorage) Close() error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if storage.walFile == nil {
+		return nil
+	}
+
+	err := storage.walFile.Close()
+	storage.walFile = nil
+	return err
+}
+
+func (storage *FileStorage) String() string {
+	return storage.path
+}
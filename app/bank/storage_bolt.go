@@ -0,0 +1,134 @@
+package banking
+
+import (
+	"encoding/binary"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// bucket holding the saved document under dataKey
+	dataBucket = []byte("bank")
+	dataKey    = []byte("data")
+	// bucket holding backups of the document, keyed by label
+	backupBucket = []byte("backups")
+	// bucket holding the write-ahead log, keyed by sequence number
+	walBucket = []byte("wal")
+)
+
+// BoltStorage is a Storage backend that keeps the data in a bbolt
+// database, an embedded key/value store written in pure Go. Each save
+// is a transaction, so the saved document is replaced atomically.
+type BoltStorage struct {
+	db *bolt.DB
+}
+
+// OpenBoltStorage opens (or creates) the bbolt database at the
+// specified path. The database is locked until the storage is closed,
+// so it cannot be used by two processes at once.
+func OpenBoltStorage(path string) (*BoltStorage, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{dataBucket, backupBucket, walBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStorage{db: db}, nil
+}
+
+// Load returns the document that was most recently saved, or nil if
+// nothing has been saved
+func (storage *BoltStorage) Load() ([]byte, error) {
+	var content []byte
+	err := storage.db.View(func(tx *bolt.Tx) error {
+		// values are only valid during the transaction, so copy it
+		if value := tx.Bucket(dataBucket).Get(dataKey); value != nil {
+			content = append([]byte(nil), value...)
+		}
+		return nil
+	})
+
+	return content, err
+}
+
+// Save replaces the saved document in a single transaction
+func (storage *BoltStorage) Save(content []byte) error {
+	return storage.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(dataBucket).Put(dataKey, content)
+	})
+}
+
+// AppendLog appends the records to the log in a single transaction,
+// which bbolt flushes to disk before it commits
+func (storage *BoltStorage) AppendLog(records ...[]byte) error {
+	return storage.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(walBucket)
+		for _, record := range records {
+			sequence, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			// big-endian keys sort in the order the records were appended
+			key := binary.BigEndian.AppendUint64(nil, sequence)
+			if err := bucket.Put(key, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ReadLog returns the records in the log, oldest first. Records are
+// appended in transactions, so there are no partial records.
+func (storage *BoltStorage) ReadLog() ([][]byte, error) {
+	var records [][]byte
+	err := storage.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(walBucket).ForEach(func(_, value []byte) error {
+			records = append(records, append([]byte(nil), value...))
+			return nil
+		})
+	})
+
+	return records, err
+}
+
+// TruncateLog removes every record from the log
+func (storage *BoltStorage) TruncateLog() error {
+	return storage.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(walBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(walBucket)
+		return err
+	})
+}
+
+// Backup keeps a copy of the content under the specified label
+func (storage *BoltStorage) Backup(label string, content []byte) error {
+	return storage.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(backupBucket).Put([]byte(label), content)
+	})
+}
+
+// Close closes the database, releasing its lock
+func (storage *BoltStorage) Close() error {
+	return storage.db.Close()
+}
+
+func (storage *BoltStorage) String() string {
+	return "bolt:" + storage.db.Path()
+}
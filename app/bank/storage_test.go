@@ -0,0 +1,157 @@
+package banking
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Returns the records as strings, for comparison
+func logStrings(records [][]byte) []string {
+	strs := []string{}
+	for _, record := range records {
+		strs = append(strs, string(record))
+	}
+
+	return strs
+}
+
+func TestStorageBackends(t *testing.T) {
+	dir := t.TempDir()
+	memory := NewMemoryStorage()
+	backends := []struct {
+		kind   string
+		open   func() (Storage, error)
+		backup func(storage Storage, label string) []byte
+	}{
+		{
+			StorageMemory,
+			func() (Storage, error) { return memory, nil },
+			func(storage Storage, label string) []byte { return memory.backups[label] },
+		},
+		{
+			StorageFile,
+			func() (Storage, error) { return NewFileStorage(filepath.Join(dir, "bank-test.dat")), nil },
+			func(storage Storage, label string) []byte {
+				content, _ := os.ReadFile(filepath.Join(dir, "bank-test.dat."+label))
+				return content
+			},
+		},
+		{
+			StorageBolt,
+			func() (Storage, error) { return OpenBoltStorage(filepath.Join(dir, "bank-test.db")) },
+			func(storage Storage, label string) []byte {
+				var content []byte
+				_ = storage.(*BoltStorage).db.View(func(tx *bolt.Tx) error {
+					content = append(content, tx.Bucket(backupBucket).Get([]byte(label))...)
+					return nil
+				})
+				return content
+			},
+		},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.kind, func(t *testing.T) {
+			storage, err := backend.open()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if content, err := storage.Load(); err != nil || content != nil {
+				t.Errorf("new storage loaded '%s' (error: %v), want nothing", content, err)
+			}
+			if records, err := storage.ReadLog(); err != nil || len(records) != 0 {
+				t.Errorf("new storage has log %v (error: %v), want it empty", logStrings(records), err)
+			}
+
+			if err := storage.Save([]byte("first")); err != nil {
+				t.Fatal(err)
+			}
+			if err := storage.Save([]byte("second")); err != nil {
+				t.Fatal(err)
+			}
+			if err := storage.AppendLog([]byte("a"), []byte("b")); err != nil {
+				t.Fatal(err)
+			}
+			if err := storage.AppendLog([]byte("c")); err != nil {
+				t.Fatal(err)
+			}
+			if err := storage.Backup("v1.bak", []byte("original")); err != nil {
+				t.Fatal(err)
+			}
+
+			// everything is kept when the storage is reopened
+			if err := storage.Close(); err != nil {
+				t.Fatal(err)
+			}
+			storage, err = backend.open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer storage.Close()
+
+			if content, err := storage.Load(); err != nil || string(content) != "second" {
+				t.Errorf("storage loaded '%s' (error: %v), want 'second'", content, err)
+			}
+			if records, err := storage.ReadLog(); err != nil || !reflect.DeepEqual(logStrings(records), []string{"a", "b", "c"}) {
+				t.Errorf("log is %v (error: %v), want [a b c]", logStrings(records), err)
+			}
+			if backup := backend.backup(storage, "v1.bak"); string(backup) != "original" {
+				t.Errorf("backup is '%s', want 'original'", backup)
+			}
+
+			// records appended after the log is truncated are kept
+			if err := storage.TruncateLog(); err != nil {
+				t.Fatal(err)
+			}
+			if records, err := storage.ReadLog(); err != nil || len(records) != 0 {
+				t.Errorf("truncated log is %v (error: %v), want it empty", logStrings(records), err)
+			}
+			if err := storage.AppendLog([]byte("d")); err != nil {
+				t.Fatal(err)
+			}
+			if records, err := storage.ReadLog(); err != nil || !reflect.DeepEqual(logStrings(records), []string{"d"}) {
+				t.Errorf("log after truncation is %v (error: %v), want [d]", logStrings(records), err)
+			}
+		})
+	}
+}
+
+func TestFileStorageRemovesTempFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bank-test.dat")
+	storage := NewFileStorage(path)
+	defer storage.Close()
+	if err := storage.Save([]byte("saved")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a save interrupted by a crash leaves a temporary file behind
+	temp := path + ".tmp-12345"
+	if err := os.WriteFile(temp, []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := storage.Load(); err != nil || string(content) != "saved" {
+		t.Errorf("storage loaded '%s' (error: %v), want 'saved'", content, err)
+	}
+	if _, err := os.Stat(temp); !os.IsNotExist(err) {
+		t.Errorf("temporary file remains after loading (error: %v)", err)
+	}
+}
+
+func TestOpenStorage(t *testing.T) {
+	storage, err := OpenStorage("Memory", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := storage.(*MemoryStorage); !ok {
+		t.Errorf("opened %T for memory storage, want *MemoryStorage", storage)
+	}
+
+	if _, err := OpenStorage("cloud", "test"); err == nil {
+		t.Error("opened an unsupported kind of storage")
+	}
+}
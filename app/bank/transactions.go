@@ -0,0 +1,264 @@
+package banking
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultTransactionPageSize is the number of transactions returned
+	// by ListTransactions when the filter does not specify a limit.
+	DefaultTransactionPageSize = 50
+	// MaxTransactionPageSize is the largest number of transactions that
+	// ListTransactions returns at once.
+	MaxTransactionPageSize = 1000
+)
+
+// TransactionFilter selects the ledger entries returned by
+// ListTransactions. Fields with their zero value do not filter; for
+// example, an empty AccountID matches entries for every account and a
+// zero MaxAmount places no upper limit on the amount.
+type TransactionFilter struct {
+	AccountID      string
+	Type           TransactionType
+	MinAmount      Money     // inclusive
+	MaxAmount      Money     // inclusive
+	Since          time.Time // inclusive
+	Until          time.Time // exclusive
+	IdempotencyKey string
+
+	// Cursor continues a previous query from where its page ended; it
+	// is the NextCursor of that page, or empty to start at the beginning
+	Cursor string
+	// Limit is the maximum number of entries to return, or zero for
+	// DefaultTransactionPageSize
+	Limit int
+}
+
+// TransactionPage is one page of the results of ListTransactions.
+// NextCursor is empty when there are no more matching transactions.
+type TransactionPage struct {
+	Transactions []LedgerEntry
+	NextCursor   string
+}
+
+// ListTransactions returns the ledger entries that match the filter,
+// oldest first, one page at a time. Because the ledger is append-only,
+// a cursor remains valid as new transactions are posted, which are
+// returned by later pages. This returns an AccountNotFoundError if the
+// filter names an account that does not exist, or an error if the
+// cursor or limit is invalid.
+func (bank *Bank) ListTransactions(filter TransactionFilter) (TransactionPage, error) {
+	bank.lock.RLock()
+	defer bank.lock.RUnlock()
+
+	return bank.listTransactions(filter)
+}
+
+// Returns the page of ledger entries that match the filter, as described
+// for ListTransactions
+func (bank *Bank) listTransactions(filter TransactionFilter) (TransactionPage, error) {
+	if filter.AccountID != "" {
+		if _, err := bank.getAccount(filter.AccountID); err != nil {
+			return TransactionPage{}, err
+		}
+	}
+
+	limit := filter.Limit
+	if limit == 0 {
+		limit = DefaultTransactionPageSize
+	}
+
+	if limit < 0 || limit > MaxTransactionPageSize {
+		return TransactionPage{}, fmt.Errorf("invalid limit: %d (must be 1 to %d)", limit, MaxTransactionPageSize)
+	}
+
+	bank.ledgerLock.Lock()
+	defer bank.ledgerLock.Unlock()
+
+	// the cursor is the ID of the last transaction on the previous page
+	start := 0
+	if filter.Cursor != "" {
+		start = -1
+		for i, entry := range bank.ledger {
+			if entry.TransactionID == filter.Cursor {
+				start = i + 1
+				break
+			}
+		}
+
+		if start < 0 {
+			return TransactionPage{}, fmt.Errorf("invalid cursor: '%s'", filter.Cursor)
+		}
+	}
+
+	page := TransactionPage{Transactions: []LedgerEntry{}}
+	for _, entry := range bank.ledger[start:] {
+		if !filter.matches(entry) {
+			continue
+		}
+
+		if len(page.Transactions) == limit {
+			page.NextCursor = page.Transactions[limit-1].TransactionID
+			break
+		}
+
+		page.Transactions = append(page.Transactions, entry)
+	}
+
+	return page, nil
+}
+
+// Reports whether the ledger entry satisfies every criterion of the filter
+func (filter TransactionFilter) matches(entry LedgerEntry) bool {
+	switch {
+	case filter.AccountID != "" && entry.AccountID != filter.AccountID:
+		return false
+	case filter.Type != "" && entry.Type != filter.Type:
+		return false
+	case entry.Amount < filter.MinAmount:
+		return false
+	case filter.MaxAmount != 0 && entry.Amount > filter.MaxAmount:
+		return false
+	case !filter.Since.IsZero() && entry.Timestamp.Before(filter.Since):
+		return false
+	case !filter.Until.IsZero() && !entry.Timestamp.Before(filter.Until):
+		return false
+	case filter.IdempotencyKey != "" && entry.IdempotencyKey != filter.IdempotencyKey:
+		return false
+	}
+
+	return true
+}
+
+// TransactionStatus describes the outcome of a request that was
+// processed by the bank.
+type TransactionStatus string
+
+const (
+	// TransactionCompleted means the transaction was posted to the ledger
+	TransactionCompleted TransactionStatus = "COMPLETED"
+	// TransactionPartiallyReversed means the transaction was posted, and
+	// later reversed by less than its full amount
+	TransactionPartiallyReversed TransactionStatus = "PARTIALLY_REVERSED"
+	// TransactionReversed means the transaction was posted, and later
+	// reversed by its full amount
+	TransactionReversed TransactionStatus = "REVERSED"
+)
+
+// TransactionOutcome reports what became of a transaction, such as a
+// withdrawal whose response the caller never received. The embedded
+// ledger entry includes the amount and the balance that resulted from
+// the transaction. The outcome of a request that placed a hold has the
+// type HOLD and the hold's status instead, and has no resulting balance
+// since a hold does not change the balance.
+type TransactionOutcome struct {
+	LedgerEntry
+	Status         TransactionStatus
+	ReversedAmount Money
+}
+
+// GetTransaction returns the outcome of the transaction with the
+// specified ID, or a TransactionNotFoundError if there is no such
+// transaction. The transaction may still be waiting for its change to
+// become durable, so this waits for that as described for awaitLog,
+// and returns an error instead if it could not be written.
+func (bank *Bank) GetTransaction(txID string) (TransactionOutcome, error) {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	entry, found := bank.findLedgerEntry(txID)
+	if !found {
+		msg := fmt.Sprintf("no transaction with ID '%s' at '%s' bank", txID, bank.name)
+		return TransactionOutcome{}, TransactionNotFoundError{message: msg}
+	}
+
+	return bank.durableOutcome(bank.outcomeOf(entry))
+}
+
+// GetRequestOutcome returns the outcome of the request that was made
+// with the specified idempotency key. This allows a caller that does
+// not know whether a request succeeded, such as after a timeout, to
+// find out without retrying it. The ledger is consulted for keys that
+// are no longer retained for detecting duplicates. This returns a
+// RequestNotFoundError if the bank has no record of a request with
+// that key, meaning that the request was not processed. As with
+// GetTransaction, this waits for the request's change to be durable.
+func (bank *Bank) GetRequestOutcome(idempotencyKey string) (TransactionOutcome, error) {
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+
+	bank.requestsLock.Lock()
+	record, keyExists := bank.requests[idempotencyKey]
+	bank.requestsLock.Unlock()
+
+	if keyExists {
+		if entry, found := bank.findLedgerEntry(record.TransactionID); found {
+			return bank.durableOutcome(bank.outcomeOf(entry))
+		}
+
+		if hold, err := bank.currentHold(record.TransactionID); err == nil {
+			return bank.durableOutcome(bank.outcomeOfHold(hold))
+		}
+	}
+
+	page, _ := bank.listTransactions(TransactionFilter{IdempotencyKey: idempotencyKey, Limit: 1})
+	if idempotencyKey == "" || len(page.Transactions) == 0 {
+		msg := fmt.Sprintf("no request with idempotency key '%s' at '%s' bank", idempotencyKey, bank.name)
+		return TransactionOutcome{}, RequestNotFoundError{message: msg}
+	}
+
+	return bank.durableOutcome(bank.outcomeOf(page.Transactions[0]))
+}
+
+// Returns the outcome once the changes that it reflects are durable,
+// or an error if they could not be written to the log, in which case
+// they have been undone. Every change that the caller could see was
+// queued to be written before it acquired lock, which it must hold
+// exclusively, as described for awaitLog.
+func (bank *Bank) durableOutcome(outcome TransactionOutcome) (TransactionOutcome, error) {
+	if err := bank.awaitLog(); err != nil {
+		return TransactionOutcome{}, err
+	}
+
+	return outcome, nil
+}
+
+// Returns the outcome of the transaction recorded by the ledger entry
+func (bank *Bank) outcomeOf(entry LedgerEntry) TransactionOutcome {
+	outcome := TransactionOutcome{
+		LedgerEntry:    entry,
+		Status:         TransactionCompleted,
+		ReversedAmount: bank.reversedAmount(entry.TransactionID),
+	}
+
+	if outcome.ReversedAmount == entry.Amount {
+		outcome.Status = TransactionReversed
+	} else if outcome.ReversedAmount > 0 {
+		outcome.Status = TransactionPartiallyReversed
+	}
+
+	return outcome
+}
+
+// Returns the outcome of a request that placed the hold
+func (bank *Bank) outcomeOfHold(hold Hold) TransactionOutcome {
+	currency := ""
+	if acct, err := bank.getAccount(hold.AccountID); err == nil {
+		currency = acct.Currency
+	}
+
+	return TransactionOutcome{
+		LedgerEntry: LedgerEntry{
+			TransactionID:  hold.ID,
+			AccountID:      hold.AccountID,
+			Type:           holdRequest,
+			Amount:         hold.Amount,
+			IdempotencyKey: hold.IdempotencyKey,
+			Timestamp:      hold.Created,
+			Currency:       currency,
+			HoldID:         hold.ID,
+		},
+		Status: TransactionStatus(hold.Status),
+	}
+}
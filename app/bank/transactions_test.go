@@ -0,0 +1,224 @@
+package banking
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Returns the IDs of the transactions on the page
+func transactionIDs(page TransactionPage) []string {
+	ids := []string{}
+	for _, entry := range page.Transactions {
+		ids = append(ids, entry.TransactionID)
+	}
+
+	return ids
+}
+
+func TestListTransactionsPages(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	clock := &fakeClock{now: time.Date(2026, time.February, 2, 9, 0, 0, 0, time.UTC)}
+	bank.SetClock(clock)
+	if err := bank.OpenAccount("savings", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// deposits of 1.00 to 7.00 an hour apart, with others in between
+	var depositIDs []string
+	for i := int64(1); i <= 7; i++ {
+		txID, err := bank.Deposit(Dollars(i), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		depositIDs = append(depositIDs, txID)
+		if _, err := bank.DepositToAccount("savings", Dollars(100), "", "", AnyVersion); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(time.Hour)
+	}
+
+	filter := TransactionFilter{AccountID: DefaultAccountID, Limit: 3}
+	first, err := bank.ListTransactions(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := transactionIDs(first); !slices.Equal(ids, depositIDs[0:3]) || first.NextCursor != depositIDs[2] {
+		t.Errorf("first page is %v (next: %s), want %v (next: %s)", ids, first.NextCursor, depositIDs[0:3], depositIDs[2])
+	}
+
+	filter.Cursor = first.NextCursor
+	second, err := bank.ListTransactions(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := transactionIDs(second); !slices.Equal(ids, depositIDs[3:6]) {
+		t.Errorf("second page is %v, want %v", ids, depositIDs[3:6])
+	}
+
+	// a transaction posted while paging appears on a later page
+	latestID, err := bank.Withdraw(Dollars(1), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter.Cursor = second.NextCursor
+	last, err := bank.ListTransactions(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := transactionIDs(last); !slices.Equal(ids, []string{depositIDs[6], latestID}) || last.NextCursor != "" {
+		t.Errorf("last page is %v (next: %s), want %v with no next page", ids, last.NextCursor, []string{depositIDs[6], latestID})
+	}
+
+	invalid := []TransactionFilter{
+		{Limit: -1},
+		{Limit: MaxTransactionPageSize + 1},
+		{Cursor: "D0000000000"},
+	}
+	for _, filter := range invalid {
+		if _, err := bank.ListTransactions(filter); err == nil {
+			t.Errorf("listed transactions with invalid filter %+v", filter)
+		}
+	}
+	var notFound AccountNotFoundError
+	if _, err := bank.ListTransactions(TransactionFilter{AccountID: "missing"}); !errors.As(err, &notFound) {
+		t.Errorf("listing transactions of unknown account returned %v, want an AccountNotFoundError", err)
+	}
+}
+
+func TestListTransactionsFilters(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	clock := &fakeClock{now: time.Date(2026, time.February, 2, 9, 0, 0, 0, time.UTC)}
+	bank.SetClock(clock)
+	client, _ := newTestClient(t, bank)
+
+	var ids []string
+	for _, amount := range []Money{Dollars(10), Dollars(20), Dollars(30)} {
+		txID, err := bank.Deposit(amount, "key-"+amount.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, txID)
+		clock.Advance(time.Hour)
+	}
+	withdrawalID, err := bank.Withdraw(Dollars(20), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2026, time.February, 2, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		filter TransactionFilter
+		want   []string
+	}{
+		{TransactionFilter{}, []string{ids[0], ids[1], ids[2], withdrawalID}},
+		{TransactionFilter{Type: TransactionWithdrawal}, []string{withdrawalID}},
+		{TransactionFilter{MinAmount: Dollars(20)}, []string{ids[1], ids[2], withdrawalID}},
+		{TransactionFilter{MaxAmount: Dollars(20)}, []string{ids[0], ids[1], withdrawalID}},
+		{TransactionFilter{Type: TransactionDeposit, MinAmount: Dollars(20), MaxAmount: Dollars(20)}, []string{ids[1]}},
+		{TransactionFilter{Since: start.Add(time.Hour)}, []string{ids[1], ids[2], withdrawalID}},
+		{TransactionFilter{Until: start.Add(2 * time.Hour)}, []string{ids[0], ids[1]}},
+		{TransactionFilter{IdempotencyKey: "key-30.00"}, []string{ids[2]}},
+		{TransactionFilter{IdempotencyKey: "unknown"}, []string{}},
+	}
+	for _, test := range tests {
+		page, err := bank.ListTransactions(test.filter)
+		if err != nil || !slices.Equal(transactionIDs(page), test.want) {
+			t.Errorf("transactions matching %+v are %v (error: %v), want %v", test.filter, transactionIDs(page), err, test.want)
+		}
+
+		// the client sends the same filter to the service
+		page, err = client.ListTransactions(test.filter)
+		if err != nil || !slices.Equal(transactionIDs(page), test.want) {
+			t.Errorf("client returned transactions matching %+v as %v (error: %v), want %v", test.filter, transactionIDs(page), err, test.want)
+		}
+	}
+
+	page, err := client.ListTransactions(TransactionFilter{Limit: 2})
+	if err != nil || !slices.Equal(transactionIDs(page), ids[0:2]) || page.NextCursor != ids[1] {
+		t.Errorf("client returned first page %v (next: %s, error: %v), want %v (next: %s)",
+			transactionIDs(page), page.NextCursor, err, ids[0:2], ids[1])
+	}
+	if len(page.Transactions) > 0 && page.Transactions[0].Amount != Dollars(10) {
+		t.Errorf("client returned first transaction %+v, want a deposit of 10.00", page.Transactions[0])
+	}
+}
+
+func TestRequestOutcome(t *testing.T) {
+	bank := newTestBank(t, StorageMemory, false)
+	client, _ := newTestClient(t, bank)
+
+	depositID, err := bank.Deposit(Dollars(100), "deposit-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	holdID, err := bank.AuthorizeHold(DefaultAccountID, Dollars(25), "hold-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkOutcome := func(name string, outcome TransactionOutcome, err error, status TransactionStatus, reversed Money) {
+		t.Helper()
+		if err != nil || outcome.TransactionID != depositID || outcome.Status != status ||
+			outcome.ReversedAmount != reversed || outcome.Amount != Dollars(100) {
+			t.Errorf("%s is %+v (error: %v), want deposit %s %s with %s reversed", name, outcome, err, depositID, status, reversed)
+		}
+	}
+
+	outcome, err := bank.GetRequestOutcome("deposit-key")
+	checkOutcome("outcome of deposit", outcome, err, TransactionCompleted, 0)
+	if outcome.Balance != Dollars(100) {
+		t.Errorf("outcome of deposit has balance %s, want 100.00", outcome.Balance)
+	}
+
+	// a hold is reported with its status
+	for _, status := range []HoldStatus{HoldActive, HoldReleased} {
+		if status == HoldReleased {
+			if err := bank.ReleaseHold(holdID); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, lookup := range []func(string) (TransactionOutcome, error){bank.GetRequestOutcome, client.GetRequestOutcome} {
+			outcome, err := lookup("hold-key")
+			if err != nil || outcome.TransactionID != holdID || outcome.Type != holdRequest ||
+				outcome.Status != TransactionStatus(status) || outcome.Amount != Dollars(25) {
+				t.Errorf("outcome of hold is %+v (error: %v), want %s hold %s of 25.00", outcome, err, status, holdID)
+			}
+		}
+	}
+
+	if _, err := bank.ReverseTransaction(depositID, Dollars(30), ""); err != nil {
+		t.Fatal(err)
+	}
+	outcome, err = bank.GetTransaction(depositID)
+	checkOutcome("outcome of partly reversed deposit", outcome, err, TransactionPartiallyReversed, Dollars(30))
+	outcome, err = client.GetTransaction(depositID)
+	checkOutcome("client outcome of partly reversed deposit", outcome, err, TransactionPartiallyReversed, Dollars(30))
+
+	if _, err := bank.ReverseTransaction(depositID, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	outcome, err = client.GetRequestOutcome("deposit-key")
+	checkOutcome("client outcome of reversed deposit", outcome, err, TransactionReversed, Dollars(100))
+
+	// the ledger is consulted for a key that is no longer retained
+	bank.SetIdempotencyRetention(0, 1)
+	outcome, err = bank.GetRequestOutcome("deposit-key")
+	checkOutcome("outcome of deposit with evicted key", outcome, err, TransactionReversed, Dollars(100))
+
+	var requestNotFound RequestNotFoundError
+	var transactionNotFound TransactionNotFoundError
+	if _, err := bank.GetRequestOutcome("unknown-key"); !errors.As(err, &requestNotFound) {
+		t.Errorf("outcome of unknown key returned %v, want a RequestNotFoundError", err)
+	}
+	if _, err := client.GetRequestOutcome("unknown-key"); !errors.As(err, &requestNotFound) {
+		t.Errorf("client outcome of unknown key returned %v, want a RequestNotFoundError", err)
+	}
+	if _, err := bank.GetTransaction("D0000000000"); !errors.As(err, &transactionNotFound) {
+		t.Errorf("outcome of unknown transaction returned %v, want a TransactionNotFoundError", err)
+	}
+	if _, err := client.GetTransaction("D0000000000"); !errors.As(err, &transactionNotFound) {
+		t.Errorf("client outcome of unknown transaction returned %v, want a TransactionNotFoundError", err)
+	}
+}
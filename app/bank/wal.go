@@ -0,0 +1,437 @@
+package banking
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"runtime"
+)
+
+// DefaultSnapshotInterval is the number of changes recorded in the
+// write-ahead log after which the bank saves a snapshot of its data
+// and compacts the log, unless it is configured otherwise.
+const DefaultSnapshotInterval = 1000
+
+// walRecord is an entry in the write-ahead log, which records a change
+// made to the bank's data since the last snapshot. Rather than the
+// operation that was performed, it records the resulting state of what
+// changed, so that replaying a record more than once has no further
+// effect; this matters because a crash between saving a snapshot and
+// compacting the log leaves records of changes the snapshot includes.
+type walRecord struct {
+	Sequence       uint64                       `json:"seq"`
+	Accounts       []account                    `json:"accounts,omitempty"` // state after the change
+	ClosedAccounts []string                     `json:"closedAccounts,omitempty"`
+	Ledger         []LedgerEntry                `json:"ledger,omitempty"` // appended entries
+	Requests       map[string]idempotencyRecord `json:"idempotencyKeys,omitempty"`
+	Holds          []Hold                       `json:"holds,omitempty"`     // state after the change
+	Schedules      []Schedule                   `json:"schedules,omitempty"` // state after the change
+	Reviews        []Review                     `json:"reviews,omitempty"`   // state after the change
+}
+
+// SetSnapshotInterval configures how many changes are recorded in the
+// write-ahead log before the bank saves a snapshot of its data and
+// compacts the log. A smaller interval makes startup faster, since
+// fewer changes need to be replayed, at the cost of saving snapshots
+// more often. Zero disables snapshots, other than those taken when the
+// bank is created.
+func (bank *Bank) SetSnapshotInterval(interval int) {
+	bank.walLock.Lock()
+	bank.snapshotInterval = interval
+	bank.walLock.Unlock()
+
+	log.Printf("Saving a snapshot of '%s' bank every %d changes", bank.name, interval)
+}
+
+// SetGroupCommit enables or disables group commit. Without it, each
+// change is written to the log and flushed to disk on its own, so
+// concurrent operations wait for each other's flushes in turn. With
+// it, the changes from concurrent operations that arrive while a flush
+// is in progress are written together and flushed once, which greatly
+// increases throughput under load. Either way, an operation does not
+// return until its own change is durable.
+func (bank *Bank) SetGroupCommit(enabled bool) {
+	bank.walLock.Lock()
+	bank.groupCommit = enabled
+	bank.walLock.Unlock()
+
+	log.Printf("Group commit for '%s' bank enabled: %v", bank.name, enabled)
+}
+
+// pendingChange is a change that is waiting to be written to the log,
+// along with a channel that receives the result of writing it. A change
+// without a record is written along with the changes queued before it,
+// but adds nothing to the log.
+type pendingChange struct {
+	record []byte
+	done   chan error
+}
+
+// sent to the caller waiting for the oldest pending change when the
+// caller that was writing changes to the log has written its own, so
+// that it writes the remaining changes itself
+var errTakeOver = errors.New("take over writing changes to the log")
+
+// returned for a change that is made after an earlier change could not
+// be written to the log, until the bank's data has been reloaded
+var errLogFailed = errors.New("an earlier change could not be written to the log")
+
+// Records a change that has already been applied to the bank's data by
+// appending it to the write-ahead log, which is durable once this
+// returns. If enough changes have been recorded since the last
+// snapshot, this also saves a new one and compacts the log. It returns
+// an error if the change could not be recorded, in which case the
+// bank's data is reloaded from storage (see recoverFromLogFailure), so
+// the change is undone and not reported as made by a retried request.
+// The caller must hold lock exclusively, which is released while
+// waiting for the change to be written, as described for enqueue.
+func (bank *Bank) commit(change walRecord) error {
+	bank.walLock.Lock()
+	bank.walSequence++
+	change.Sequence = bank.walSequence
+
+	record, err := json.Marshal(change)
+	if err != nil {
+		bank.walLock.Unlock()
+		log.Printf("ERROR: failed to encode change to account data: %v\n", err)
+		return err
+	}
+
+	err = bank.enqueue(record)
+	if err != nil {
+		log.Printf("ERROR: failed to write change to log in '%s': %v\n", bank.storage, err)
+		bank.recoverFromLogFailure()
+	}
+
+	return err
+}
+
+// Waits until every change that has been recorded so far is durable,
+// for an operation that returns the result of an earlier one, which may
+// still be waiting for its change to be written. The caller must hold
+// lock exclusively, as described for commit.
+func (bank *Bank) awaitLog() error {
+	bank.walLock.Lock()
+	err := bank.enqueue(nil)
+	if err != nil {
+		bank.recoverFromLogFailure()
+	}
+
+	return err
+}
+
+// Reloads the bank's data from storage after a change could not be
+// written to the log, discarding every change in memory that is not
+// durable. Since each change is applied before it is written, and
+// other operations may proceed while it is being written, the changes
+// queued after one that fails may depend on it, so they fail as well,
+// and no further changes are accepted until the data has been
+// reloaded. If the data cannot be reloaded, the next failed change
+// tries again. The caller must hold lock exclusively.
+func (bank *Bank) recoverFromLogFailure() {
+	bank.walLock.Lock()
+	failed := bank.logFailed
+	bank.walLock.Unlock()
+	if !failed {
+		return
+	}
+
+	bank.accounts = make(map[string]*account)
+	bank.ledger = nil
+	bank.requests = make(map[string]idempotencyRecord)
+	bank.requestOrder = nil
+	bank.holds = make(map[string]*Hold)
+	bank.schedules = make(map[string]*Schedule)
+	bank.reviews = make(map[string]*Review)
+
+	_, err := bank.read()
+	if err != nil {
+		log.Printf("ERROR: could not reload '%s' account data after a failed change: %v\n", bank.name, err)
+		return
+	}
+	bank.addDefaultAccount()
+
+	bank.walLock.Lock()
+	bank.logFailed = false
+	bank.walLock.Unlock()
+
+	log.Printf("Reloaded '%s' account data from '%s', discarding the changes that were not written", bank.name, bank.storage)
+}
+
+// Queues a change to be written to the log, and waits until it has
+// been. If no other caller is writing changes to the log, this writes
+// them itself, until its own change has been written. The caller must
+// hold walLock, which this releases, and hold lock exclusively, which
+// is released while waiting so that other operations can proceed (and
+// with group commit, have their changes written along with this one)
+// and reacquired before returning. Since changes are queued while lock
+// is held, they are written in the order in which they were applied.
+// Operations that only read may see a change while it is being
+// written, as noted for GetAccountBalance.
+// This returns errLogFailed without waiting if an earlier change could
+// not be written, as described for recoverFromLogFailure.
+func (bank *Bank) enqueue(record []byte) error {
+	if bank.logFailed {
+		bank.walLock.Unlock()
+		return errLogFailed
+	}
+
+	done := make(chan error, 1)
+	bank.pending = append(bank.pending, pendingChange{record: record, done: done})
+	writing := !bank.flushing
+	bank.flushing = true
+	bank.walLock.Unlock()
+
+	bank.lock.Unlock()
+	defer bank.lock.Lock()
+
+	if writing {
+		bank.flushPending(done)
+	}
+
+	err := <-done
+	if err == errTakeOver {
+		bank.flushPending(done)
+		err = <-done
+	}
+
+	return err
+}
+
+// Writes the pending changes to the log, oldest first, until the change
+// whose result is sent to done has been written, notifying the caller
+// waiting for each change once it is durable. With group commit, all
+// of the changes that are pending are written together; otherwise,
+// each is written on its own. The caller must be the one writing
+// changes to the log, which it then hands over to the caller waiting
+// for the oldest change that is still pending, if any, so that no
+// caller is kept writing other callers' changes indefinitely.
+func (bank *Bank) flushPending(done chan error) {
+	bank.walLock.Lock()
+	defer bank.walLock.Unlock()
+
+	for written := false; !written; {
+		if bank.groupCommit {
+			// give other operations that are ready to record changes a
+			// chance to queue them, so they are written in this batch
+			bank.walLock.Unlock()
+			runtime.Gosched()
+			bank.walLock.Lock()
+		}
+
+		written = bank.writeBatch(done)
+		if !bank.logFailed && bank.snapshotInterval > 0 && bank.walLength >= bank.snapshotInterval {
+			bank.snapshotLog()
+		}
+	}
+
+	if len(bank.pending) > 0 {
+		bank.pending[0].done <- errTakeOver
+	} else {
+		bank.flushing = false
+	}
+}
+
+// Writes the next batch of pending changes to the log, as described for
+// flushPending, and returns whether the change whose result is sent to
+// done was among them. The caller must hold walLock, which is released
+// while the changes are written.
+func (bank *Bank) writeBatch(done chan error) bool {
+	batch := bank.pending
+	if !bank.groupCommit {
+		batch = batch[:1]
+	}
+	bank.pending = bank.pending[len(batch):]
+
+	var records [][]byte
+	for _, change := range batch {
+		if change.record != nil {
+			records = append(records, change.record)
+		}
+	}
+
+	var err error
+	if len(records) > 0 {
+		bank.walLock.Unlock()
+		err = bank.storage.AppendLog(records...)
+		bank.walLock.Lock()
+	}
+
+	if err != nil {
+		// the changes queued since were applied after these, so they
+		// cannot be written either (see recoverFromLogFailure)
+		batch = append(batch, bank.pending...)
+		bank.pending = nil
+		bank.logFailed = true
+	} else {
+		bank.walLength += len(records)
+	}
+
+	written := false
+	for _, change := range batch {
+		written = written || change.done == done
+		change.done <- err
+	}
+
+	return written
+}
+
+// Saves a snapshot and compacts the log, once enough changes have been
+// written to it. Other operations may have applied changes that are
+// still waiting to be written, which the snapshot would otherwise
+// include before they are durable, so those are written first; no more
+// can be applied meanwhile, since the snapshot waits for lock. The
+// caller must be the one writing changes to the log, and hold walLock.
+func (bank *Bank) snapshotLog() {
+	bank.walLock.Unlock()
+	bank.lock.Lock()
+	defer bank.lock.Unlock()
+	bank.walLock.Lock()
+
+	for len(bank.pending) > 0 && !bank.logFailed {
+		bank.writeBatch(nil)
+	}
+
+	if bank.logFailed {
+		return
+	}
+
+	bank.walLock.Unlock()
+	err := bank.snapshot()
+	bank.walLock.Lock()
+
+	// the changes are already durable, so a failed snapshot is only
+	// logged; the log is compacted by the next successful one
+	if err != nil {
+		log.Printf("ERROR: failed to save snapshot after %d changes: %v\n", bank.walLength, err)
+	}
+}
+
+// Returns the records for the idempotency keys, for inclusion in a
+// change; keys that are empty or not being retained are omitted
+func (bank *Bank) requestRecords(idempotencyKeys ...string) map[string]idempotencyRecord {
+	bank.requestsLock.Lock()
+	defer bank.requestsLock.Unlock()
+
+	var records map[string]idempotencyRecord
+	for _, idempotencyKey := range idempotencyKeys {
+		if record, exists := bank.requests[idempotencyKey]; exists && idempotencyKey != "" {
+			if records == nil {
+				records = make(map[string]idempotencyRecord)
+			}
+			records[idempotencyKey] = record
+		}
+	}
+
+	return records
+}
+
+// Applies the changes recorded in the write-ahead log after the
+// snapshot that was loaded, whose sequence number is given, and returns
+// how many were applied. Ledger entries that are already present are
+// skipped.
+func (bank *Bank) replayLog(snapshotSequence uint64) (int, error) {
+	records, err := bank.storage.ReadLog()
+	if err != nil {
+		return 0, err
+	}
+
+	bank.walSequence = snapshotSequence
+	posted := make(map[string]bool, len(bank.ledger))
+	for _, entry := range bank.ledger {
+		posted[entry.TransactionID] = true
+	}
+
+	replayed := 0
+	for _, record := range records {
+		var change walRecord
+		if err := json.Unmarshal(record, &change); err != nil {
+			return replayed, fmt.Errorf("could not parse log record %d: %w", replayed+1, err)
+		}
+
+		if change.Sequence <= snapshotSequence {
+			continue
+		}
+
+		for _, acct := range change.Accounts {
+			acct := acct
+			bank.accounts[acct.ID] = &acct
+		}
+
+		// earlier versions removed accounts when they were closed
+		for _, id := range change.ClosedAccounts {
+			delete(bank.accounts, id)
+		}
+
+		for _, entry := range change.Ledger {
+			if !posted[entry.TransactionID] {
+				bank.ledger = append(bank.ledger, entry)
+				posted[entry.TransactionID] = true
+			}
+		}
+
+		for idempotencyKey, request := range change.Requests {
+			bank.addRequest(idempotencyKey, request)
+		}
+
+		for _, hold := range change.Holds {
+			hold := hold
+			bank.holds[hold.ID] = &hold
+		}
+
+		for _, schedule := range change.Schedules {
+			schedule := schedule
+			bank.schedules[schedule.ID] = &schedule
+		}
+
+		for _, review := range change.Reviews {
+			review := review
+			bank.reviews[review.ID] = &review
+		}
+
+		bank.walSequence = change.Sequence
+		replayed++
+	}
+
+	bank.walLength = len(records)
+	return replayed, nil
+}
+
+// Returns a log record containing the content, framed by its length
+// and a checksum so that a record that was only partly written can be
+// detected: a 4-byte length, a 4-byte CRC-32 of the content, and then
+// the content itself
+func encodeLogRecord(content []byte) []byte {
+	frame := make([]byte, 8, 8+len(content))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(content)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(content))
+	return append(frame, content...)
+}
+
+// Returns the contents of the log records in data, along with the
+// length of the data that they occupy, stopping at the first record
+// that is incomplete or fails its checksum
+func decodeLogRecords(data []byte) ([][]byte, int) {
+	var records [][]byte
+	offset := 0
+	for len(data)-offset >= 8 {
+		length := int(binary.BigEndian.Uint32(data[offset : offset+4]))
+		sum := binary.BigEndian.Uint32(data[offset+4 : offset+8])
+		if length > len(data)-offset-8 {
+			break
+		}
+
+		content := data[offset+8 : offset+8+length]
+		if crc32.ChecksumIEEE(content) != sum {
+			break
+		}
+
+		records = append(records, content)
+		offset += 8 + length
+	}
+
+	return records, offset
+}
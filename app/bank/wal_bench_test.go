@@ -0,0 +1,66 @@
+package banking
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// The number of goroutines per CPU making deposits concurrently, as
+// when a service is handling many requests at once
+const benchmarkParallelism = 16
+
+// BenchmarkDeposit measures deposits to a bank kept in file storage,
+// where every change is flushed to disk before the deposit returns,
+// with and without group commit
+func BenchmarkDeposit(b *testing.B) {
+	for _, groupCommit := range []bool{false, true} {
+		b.Run(fmt.Sprintf("sequential/group-commit=%v", groupCommit), func(b *testing.B) {
+			bank := newTestBank(b, StorageFile, groupCommit)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := bank.Deposit(1, ""); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("parallel/group-commit=%v", groupCommit), func(b *testing.B) {
+			bank := newTestBank(b, StorageFile, groupCommit)
+			benchmarkParallelDeposits(b, bank)
+		})
+	}
+}
+
+// BenchmarkDepositStorage measures concurrent deposits with group commit
+// enabled for each kind of storage backend
+func BenchmarkDepositStorage(b *testing.B) {
+	for _, kind := range []string{StorageMemory, StorageFile, StorageBolt} {
+		b.Run(kind, func(b *testing.B) {
+			bank := newTestBank(b, kind, true)
+			benchmarkParallelDeposits(b, bank)
+		})
+	}
+}
+
+// Makes b.N deposits from many goroutines at once, each to its own
+// account so that the accounts themselves are not contended
+func benchmarkParallelDeposits(b *testing.B, bank *Bank) {
+	var workers atomic.Int64
+	b.SetParallelism(benchmarkParallelism)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		accountID := fmt.Sprintf("bench-%d", workers.Add(1))
+		if err := bank.OpenAccount(accountID, DefaultCurrency); err != nil {
+			b.Error(err)
+			return
+		}
+
+		for pb.Next() {
+			if _, err := bank.DepositToAccount(accountID, 1, DefaultCurrency, "", AnyVersion); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,330 @@
+package banking
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// failingStorage is a Storage that fails to append to the log a given
+// number of times, such as when the disk is full
+type failingStorage struct {
+	Storage
+	failures atomic.Int32
+}
+
+func (storage *failingStorage) AppendLog(records ...[]byte) error {
+	if storage.failures.Add(-1) >= 0 {
+		return errors.New("no space left on device")
+	}
+	storage.failures.Store(0)
+	return storage.Storage.AppendLog(records...)
+}
+
+// blockingStorage is a failingStorage whose first append to the log
+// waits until it is released, so that other changes queue behind it
+type blockingStorage struct {
+	failingStorage
+	blocked chan struct{} // closed once the first append is waiting
+	release chan struct{}
+	once    sync.Once
+}
+
+func (storage *blockingStorage) AppendLog(records ...[]byte) error {
+	first := false
+	storage.once.Do(func() {
+		first = true
+		close(storage.blocked)
+		<-storage.release
+	})
+	if first {
+		return storage.Storage.AppendLog(records...)
+	}
+	return storage.failingStorage.AppendLog(records...)
+}
+
+func TestFailedLogWriteIsUndone(t *testing.T) {
+	forEachCommitMode(t, func(t *testing.T, groupCommit bool) {
+		path := filepath.Join(t.TempDir(), "bank-test.dat")
+		discardLogOutput(t)
+
+		storage := &failingStorage{Storage: NewFileStorage(path)}
+		bank := NewBankWithStorage("test", storage)
+		bank.SetGroupCommit(groupCommit)
+		bank.SetSnapshotInterval(0)
+
+		if _, err := bank.Deposit(Dollars(10), "first"); err != nil {
+			t.Fatal(err)
+		}
+
+		// a change that is not durable is not made, so a retry makes it
+		storage.failures.Store(1)
+		if _, err := bank.Deposit(Dollars(20), "second"); err == nil {
+			t.Fatal("deposit succeeded although it could not be written to the log")
+		}
+		if balance := bank.GetBalance(); balance != Dollars(10) {
+			t.Errorf("balance after failed deposit is %s, want 10.00", balance)
+		}
+		secondID, err := bank.Deposit(Dollars(20), "second")
+		if err != nil {
+			t.Fatalf("retried deposit failed: %v", err)
+		}
+
+		// of concurrent deposits, those queued after one that fails also
+		// fail, and only those that succeed are made
+		storage.failures.Store(1)
+		var lock sync.Mutex
+		made := map[string]string{}
+		runConcurrently(concurrentClients, func(client int) {
+			key := "request-" + strconv.Itoa(client)
+			if txID, err := bank.Deposit(Cents(125), key); err == nil {
+				lock.Lock()
+				made[key] = txID
+				lock.Unlock()
+			}
+		})
+		if len(made) == concurrentClients {
+			t.Error("every concurrent deposit succeeded although a write to the log failed")
+		}
+
+		want := Dollars(30) + Cents(125)*Money(len(made))
+		if balance := bank.GetBalance(); balance != want {
+			t.Errorf("balance after concurrent deposits is %s, want %s", balance, want)
+		}
+		checkLedger(t, bank)
+		if err := bank.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		reopened := NewBankWithStorage("test", NewFileStorage(path))
+		defer reopened.Close()
+
+		if balance := reopened.GetBalance(); balance != want {
+			t.Errorf("balance after restart is %s, want %s", balance, want)
+		}
+		if txID, err := reopened.Deposit(Dollars(20), "second"); err != nil || txID != secondID {
+			t.Errorf("deposit retried after restart returned (%s, %v), want (%s, nil)", txID, err, secondID)
+		}
+		for key, madeID := range made {
+			if txID, err := reopened.Deposit(Cents(125), key); err != nil || txID != madeID {
+				t.Errorf("deposit '%s' retried after restart returned (%s, %v), want (%s, nil)", key, txID, err, madeID)
+			}
+		}
+		checkLedger(t, reopened)
+	})
+}
+
+func TestLogIsReplayedAfterSnapshot(t *testing.T) {
+	discardLogOutput(t)
+	storage := NewMemoryStorage()
+
+	bank := NewBankWithStorage("test", storage)
+	t.Cleanup(func() { bank.Close() })
+	bank.SetSnapshotInterval(3)
+	var depositIDs []string
+	for i := int64(1); i <= 5; i++ {
+		txID, err := bank.Deposit(Dollars(i), "deposit-"+strconv.FormatInt(i, 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		depositIDs = append(depositIDs, txID)
+	}
+
+	// the first three deposits are in the snapshot, and the others are
+	// only in the log
+	tail, err := storage.ReadLog()
+	if err != nil || len(tail) != 2 {
+		t.Fatalf("log after snapshot has %d records (error: %v), want 2", len(tail), err)
+	}
+
+	// after a crash, and after a crash between saving the next snapshot
+	// and compacting the log, which leaves records the snapshot includes
+	for session := 0; session < 2; session++ {
+		reopened := NewBankWithStorage("test", storage)
+		t.Cleanup(func() { reopened.Close() })
+
+		if balance := reopened.GetBalance(); balance != Dollars(15) {
+			t.Errorf("balance after restart %d is %s, want 15.00", session+1, balance)
+		}
+		if length := len(reopened.ledger); length != 5 {
+			t.Errorf("ledger after restart %d has %d entries, want 5", session+1, length)
+		}
+		if txID, err := reopened.Deposit(Dollars(5), "deposit-5"); err != nil || txID != depositIDs[4] {
+			t.Errorf("deposit retried after restart %d returned (%s, %v), want (%s, nil)", session+1, txID, err, depositIDs[4])
+		}
+		checkLedger(t, reopened)
+
+		if records, err := storage.ReadLog(); err != nil || len(records) != 0 {
+			t.Errorf("log after restart %d has %d records (error: %v), want it compacted", session+1, len(records), err)
+		}
+		if err := storage.AppendLog(tail...); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTornLogRecordIsDiscarded(t *testing.T) {
+	var data []byte
+	for _, content := range []string{"first", "second"} {
+		data = append(data, encodeLogRecord([]byte(content))...)
+	}
+	last := encodeLogRecord([]byte("third"))
+	corrupt := append([]byte(nil), last...)
+	corrupt[len(corrupt)-1] ^= 0xff
+
+	// a record is discarded if it is incomplete or fails its checksum
+	for _, torn := range [][]byte{last[:3], last[:8], last[:len(last)-1], corrupt} {
+		records, valid := decodeLogRecords(append(append([]byte(nil), data...), torn...))
+		if strs := logStrings(records); !slices.Equal(strs, []string{"first", "second"}) || valid != len(data) {
+			t.Errorf("decoded log ending in %x as %v (%d bytes), want [first second] (%d bytes)", torn, strs, valid, len(data))
+		}
+	}
+
+	discardLogOutput(t)
+	path := filepath.Join(t.TempDir(), "bank-test.dat")
+	storage := NewFileStorage(path)
+	defer storage.Close()
+	if err := storage.AppendLog([]byte("first"), []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a crash while a record was being written leaves part of it
+	info, err := os.Stat(path + ".wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(path+".wal", os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write(last[:len(last)-1]); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	// the partial record is removed, so that later ones are not hidden
+	// behind it
+	records, err := storage.ReadLog()
+	if err != nil || len(records) != 2 {
+		t.Errorf("log with torn record has %d records (error: %v), want 2", len(records), err)
+	}
+	truncated, err := os.Stat(path + ".wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if truncated.Size() != info.Size() {
+		t.Errorf("log with torn record was truncated to %d bytes, want %d", truncated.Size(), info.Size())
+	}
+	if err := storage.AppendLog([]byte("appended")); err != nil {
+		t.Fatal(err)
+	}
+	if records, err := storage.ReadLog(); err != nil || len(records) != 3 || string(records[2]) != "appended" {
+		t.Errorf("log after torn record has %v (error: %v), want the record appended after it", logStrings(records), err)
+	}
+}
+
+func TestBankRecoversFromTornLogRecord(t *testing.T) {
+	discardLogOutput(t)
+	path := filepath.Join(t.TempDir(), "bank-test.dat")
+
+	bank := NewBankWithStorage("test", NewFileStorage(path))
+	bank.SetSnapshotInterval(0)
+	for _, amount := range []Money{Dollars(10), Dollars(20)} {
+		if _, err := bank.Deposit(amount, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bank.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	record := encodeLogRecord([]byte(`{"seq":99,"accounts":[{"id":"primary","balance":1000}]}`))
+	file, err := os.OpenFile(path+".wal", os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write(record[:len(record)-5]); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	// the changes before the torn record are kept, and the bank goes on
+	// recording changes after them
+	for session, want := range []Money{Dollars(30), Dollars(35)} {
+		bank = NewBankWithStorage("test", NewFileStorage(path))
+		bank.SetSnapshotInterval(0)
+		if balance := bank.GetBalance(); balance != want {
+			t.Errorf("balance after restart %d is %s, want %s", session+1, balance, want)
+		}
+		checkLedger(t, bank)
+		if _, err := bank.Deposit(Dollars(5), ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := bank.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSnapshotExcludesChangesNotWritten(t *testing.T) {
+	discardLogOutput(t)
+	path := filepath.Join(t.TempDir(), "bank-test.dat")
+	storage := &blockingStorage{
+		failingStorage: failingStorage{Storage: NewFileStorage(path)},
+		blocked:        make(chan struct{}),
+		release:        make(chan struct{}),
+	}
+
+	bank := NewBankWithStorage("test", storage)
+	bank.SetSnapshotInterval(1)
+	bank.SetGroupCommit(false)
+
+	// the second deposit is applied while the first is being written,
+	// so it is still waiting to be written when the snapshot is due
+	first := make(chan error, 1)
+	go func() {
+		_, err := bank.Deposit(Dollars(10), "first")
+		first <- err
+	}()
+	<-storage.blocked
+
+	second := make(chan error, 1)
+	go func() {
+		_, err := bank.Deposit(Dollars(20), "second")
+		second <- err
+	}()
+	for queued := false; !queued; runtime.Gosched() {
+		bank.walLock.Lock()
+		queued = len(bank.pending) > 0
+		bank.walLock.Unlock()
+	}
+
+	storage.failures.Store(1)
+	close(storage.release)
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-second; err == nil {
+		t.Error("deposit succeeded although it could not be written to the log")
+	}
+
+	if balance := bank.GetBalance(); balance != Dollars(10) {
+		t.Errorf("balance after failed deposit is %s, want 10.00", balance)
+	}
+	if err := bank.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := NewBankWithStorage("test", NewFileStorage(path))
+	defer reopened.Close()
+	if balance := reopened.GetBalance(); balance != Dollars(10) {
+		t.Errorf("balance after restart is %s, want 10.00", balance)
+	}
+	checkLedger(t, reopened)
+}
@@ -121,16 +121,26 @@ func updateRecipientName(name string) {
 	window.Content().Refresh()
 }
 
-func updateSenderBalance(newBalance int) {
-	senderBankBalance.SetText(fmt.Sprintf("Balance: $%d.00", newBalance))
+func updateSenderBalance(newBalance banking.Money) {
+	senderBankBalance.SetText(fmt.Sprintf("Balance: %s", formatBalance(newBalance)))
 	window.Content().Refresh()
 }
 
-func updateRecipientBalance(newBalance int) {
-	recipientBankBalance.SetText(fmt.Sprintf("Balance: $%d.00", newBalance))
+func updateRecipientBalance(newBalance banking.Money) {
+	recipientBankBalance.SetText(fmt.Sprintf("Balance: %s", formatBalance(newBalance)))
 	window.Content().Refresh()
 }
 
+// formats a balance in dollars, placing the sign of an overdrawn
+// balance before the currency symbol (for example, -$12.50)
+func formatBalance(balance banking.Money) string {
+	if balance < 0 {
+		return fmt.Sprintf("-$%s", -balance)
+	}
+
+	return fmt.Sprintf("$%s", balance)
+}
+
 func markSenderBankOffline() {
 	senderBankStatus.SetText("Service Status: Offline")
 	senderBankStatus.Importance = widget.DangerImportance
@@ -2,21 +2,112 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"github.com/spf13/cobra"
 	banking "github.com/tomwheeler/demo-bank/app/bank"
 )
 
 var (
-	name string
-	port int
+	name               string
+	port               int
+	idempotencyTTL     time.Duration
+	idempotencyMaxKeys int
+	fxRatesPath        string
+	feesPath           string
+	fraudRulesPath     string
+	overdraftLimit     string
+	maxWithdrawal      string
+	dailyWithdrawal    string
+	dailyDeposit       string
+	holdExpiry         time.Duration
+	interestRate       string
+	interestPeriod     time.Duration
+	storageKind        string
+	snapshotInterval   int
+	groupCommit        bool
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "Bank Service for sender",
 	Short: "Starts the service for the sender's bank",
-	RunE: func(*cobra.Command, []string) error {
-		bank := banking.NewBank(name)
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		storage, err := banking.OpenStorage(storageKind, name)
+		if err != nil {
+			return err
+		}
+		bank := banking.NewBankWithStorage(name, storage)
+		defer bank.Close()
+		bank.SetIdempotencyRetention(idempotencyTTL, idempotencyMaxKeys)
+		bank.SetHoldExpiry(holdExpiry)
+		bank.SetSnapshotInterval(snapshotInterval)
+		bank.SetGroupCommit(groupCommit)
+		if fxRatesPath != "" {
+			rates, err := banking.LoadStaticRateProvider(fxRatesPath)
+			if err != nil {
+				return err
+			}
+			bank.SetExchangeRateProvider(rates)
+		}
+		if feesPath != "" {
+			fees, err := banking.LoadFeeSchedule(feesPath)
+			if err != nil {
+				return err
+			}
+			bank.SetFeeSchedule(fees)
+		}
+		if fraudRulesPath != "" {
+			err = bank.WatchFraudRules(fraudRulesPath)
+			if err != nil {
+				return err
+			}
+		}
+		if cmd.Flags().Changed("overdraft-limit") {
+			limit, err := banking.ParseMoney(overdraftLimit)
+			if err != nil {
+				return err
+			}
+			err = bank.SetOverdraftLimit(banking.DefaultAccountID, limit)
+			if err != nil {
+				return err
+			}
+		}
+		limits, err := bank.GetAccountLimits(banking.DefaultAccountID)
+		if err != nil {
+			return err
+		}
+		limitsChanged := false
+		for _, flag := range []struct {
+			name  string
+			value string
+			limit *banking.Money
+		}{
+			{"max-withdrawal", maxWithdrawal, &limits.MaxWithdrawal},
+			{"daily-withdrawal-limit", dailyWithdrawal, &limits.DailyWithdrawal},
+			{"daily-deposit-limit", dailyDeposit, &limits.DailyDeposit},
+		} {
+			if cmd.Flags().Changed(flag.name) {
+				*flag.limit, err = banking.ParseMoney(flag.value)
+				if err != nil {
+					return err
+				}
+				limitsChanged = true
+			}
+		}
+		if limitsChanged {
+			err = bank.SetAccountLimits(banking.DefaultAccountID, limits)
+			if err != nil {
+				return err
+			}
+		}
+		bank.SetInterestPeriod(interestPeriod)
+		if cmd.Flags().Changed("interest-rate") {
+			err = bank.SetInterestRate(banking.DefaultAccountID, interestRate)
+			if err != nil {
+				return err
+			}
+		}
+		bank.StartInterestAccrual()
 		data := bank.GetDataPath()
 
 		log.Println("Starting the sender's banking service")
@@ -35,5 +126,39 @@ func main() {
 	rootCmd.PersistentFlags().IntVarP(&port,
 		"port", "p", 8888, "Port for sender's banking service")
 
+	rootCmd.PersistentFlags().DurationVar(&idempotencyTTL,
+		"idempotency-ttl", banking.DefaultIdempotencyTTL, "How long idempotency keys are retained (0 for no limit)")
+	rootCmd.PersistentFlags().IntVar(&idempotencyMaxKeys,
+		"idempotency-max-keys", banking.DefaultIdempotencyMaxKeys, "Maximum number of idempotency keys retained (0 for no limit)")
+	rootCmd.PersistentFlags().StringVar(&fxRatesPath,
+		"fx-rates", "", "JSON file of exchange rates (uses built-in rates if omitted)")
+	rootCmd.PersistentFlags().StringVar(&feesPath,
+		"fees", "", "JSON file of fees for deposits, withdrawals, and transfers (charges no fees if omitted)")
+	rootCmd.PersistentFlags().StringVar(&fraudRulesPath,
+		"fraud-rules", "", "JSON file of fraud rules, reloaded when it changes (approves every transaction if omitted)")
+	rootCmd.PersistentFlags().StringVar(&overdraftLimit,
+		"overdraft-limit", "0", "Overdraft limit for the default account (keeps the current limit if omitted)")
+	rootCmd.PersistentFlags().StringVar(&maxWithdrawal,
+		"max-withdrawal", "0", "Largest single withdrawal from the default account (keeps the current limit if omitted)")
+	rootCmd.PersistentFlags().StringVar(&dailyWithdrawal,
+		"daily-withdrawal-limit", "0", "Total that may be withdrawn from the default account per day (keeps the current limit if omitted)")
+	rootCmd.PersistentFlags().StringVar(&dailyDeposit,
+		"daily-deposit-limit", "0", "Total that may be deposited to the default account per day (keeps the current limit if omitted)")
+	rootCmd.PersistentFlags().DurationVar(&holdExpiry,
+		"hold-expiry", banking.DefaultHoldExpiry, "How long a hold reserves funds before it expires")
+
+	rootCmd.PersistentFlags().StringVar(&interestRate,
+		"interest-rate", "0", "Annual percentage rate of interest for the default account (keeps the current rate if omitted)")
+	rootCmd.PersistentFlags().DurationVar(&interestPeriod,
+		"interest-period", banking.InterestMonthly, "How often interest is posted: 0 for monthly, or a duration such as 30s for a demo in which each period counts as a day")
+
+	rootCmd.PersistentFlags().StringVar(&storageKind,
+		"storage", banking.StorageFile, "Where account data is stored: file, memory, or bolt")
+
+	rootCmd.PersistentFlags().IntVar(&snapshotInterval,
+		"snapshot-interval", banking.DefaultSnapshotInterval, "Number of changes after which a snapshot is saved and the log is compacted")
+	rootCmd.PersistentFlags().BoolVar(&groupCommit,
+		"group-commit", false, "Flush changes from concurrent requests to disk together")
+
 	cobra.CheckErr(rootCmd.Execute())
 }
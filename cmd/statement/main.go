@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	banking "github.com/tomwheeler/demo-bank/app/bank"
+)
+
+var (
+	host       string
+	port       int
+	accountID  string
+	from       string
+	to         string
+	format     string
+	outputPath string
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "statement",
+	Short: "Exports an account statement from a banking service",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		statementFormat, err := banking.ParseStatementFormat(format)
+		if err != nil {
+			return err
+		}
+
+		start, err := parseDate(from, false)
+		if err != nil {
+			return err
+		}
+
+		end, err := parseDate(to, true)
+		if err != nil {
+			return err
+		}
+
+		client := banking.NewBankClient(host, port)
+		statement, err := client.GetStatement(accountID, start, end, statementFormat)
+		if err != nil {
+			return err
+		}
+
+		if outputPath == "" {
+			fmt.Print(statement)
+			return nil
+		}
+
+		return os.WriteFile(outputPath, []byte(statement), 0644)
+	},
+}
+
+// Parses a date such as 2024-01-31 as UTC, returning a zero time if the
+// value is empty. A date that ends a period includes the whole day.
+func parseDate(value string, endOfPeriod bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date: '%s' (use YYYY-MM-DD)", value)
+	}
+
+	if endOfPeriod {
+		date = date.AddDate(0, 0, 1)
+	}
+
+	return date, nil
+}
+
+func main() {
+	rootCmd.PersistentFlags().StringVar(&host,
+		"host", "localhost", "Host of the banking service")
+	rootCmd.PersistentFlags().IntVarP(&port,
+		"port", "p", 8888, "Port of the banking service")
+	rootCmd.PersistentFlags().StringVarP(&accountID,
+		"account", "a", banking.DefaultAccountID, "Account to export")
+	rootCmd.PersistentFlags().StringVar(&from,
+		"from", "", "First day of the statement, as YYYY-MM-DD (from the first transaction if omitted)")
+	rootCmd.PersistentFlags().StringVar(&to,
+		"to", "", "Last day of the statement, as YYYY-MM-DD (until now if omitted)")
+	rootCmd.PersistentFlags().StringVarP(&format,
+		"format", "f", "csv", "Format of the statement: csv, ofx, or qif")
+	rootCmd.PersistentFlags().StringVarP(&outputPath,
+		"output", "o", "", "File to write the statement to (standard output if omitted)")
+
+	cobra.CheckErr(rootCmd.Execute())
+}
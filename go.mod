@@ -5,6 +5,7 @@ go 1.22
 require (
 	fyne.io/fyne/v2 v2.4.5
 	github.com/spf13/cobra v1.8.1
+	go.etcd.io/bbolt v1.3.11
 )
 
 require (